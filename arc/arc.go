@@ -0,0 +1,253 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package arc 实现了一个 ARC（自适应替换）缓存。
+//
+// ARC 把只被访问过一次的条目（t1）和被多次访问的条目（t2）分开，
+// 并用最近淘汰的键（幽灵列表 b1、b2）自适应地调整两者的目标比例，
+// 因此一次性的扫描不会把经常访问的工作集挤出缓存。
+package arc
+
+import (
+	"container/list"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// Cache 是一个 ARC 缓存。它不是并发安全的。
+type Cache struct {
+	// MaxEntries 是在项目被淘汰前的最大缓存条目数。
+	// 零表示没有限制，此时以当前条目数作为 ARC 的容量，
+	// 假定淘汰由调用者完成。
+	MaxEntries int
+
+	// OnEvicted 可选地指定一个回调函数，在条目
+	// 从缓存中清除时执行。
+	OnEvicted func(key Key, value interface{})
+
+	p      int        // t1 的目标大小
+	t1, t2 *list.List // 驻留条目，元素为 *entry，最近使用的在前
+	b1, b2 *list.List // 幽灵键，元素为 *ghost，最近淘汰的在前
+	cache  map[interface{}]*list.Element
+	ghosts map[interface{}]*list.Element
+}
+
+// Key 可以是任何可比较的值，与 lru.Key 相同。
+type Key = lru.Key
+
+type entry struct {
+	key      Key
+	value    interface{}
+	frequent bool // 在 t2 中
+}
+
+type ghost struct {
+	key      Key
+	frequent bool // 在 b2 中
+}
+
+// New 创建一个新的 Cache。
+func New(maxEntries int) *Cache {
+	c := &Cache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *Cache) init() {
+	c.p = 0
+	c.t1, c.t2 = list.New(), list.New()
+	c.b1, c.b2 = list.New(), list.New()
+	c.cache = make(map[interface{}]*list.Element)
+	c.ghosts = make(map[interface{}]*list.Element)
+}
+
+// capacity 返回 ARC 的容量 c。
+func (c *Cache) capacity() int {
+	if c.MaxEntries > 0 {
+		return c.MaxEntries
+	}
+	if n := len(c.cache); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// Add 向缓存添加一个值。
+func (c *Cache) Add(key Key, value interface{}) {
+	if c.cache == nil {
+		c.init()
+	}
+	if ele, ok := c.cache[key]; ok {
+		ele.Value.(*entry).value = value
+		c.hit(ele)
+		return
+	}
+	e := &entry{key: key, value: value}
+	if g, ok := c.ghosts[key]; ok {
+		// 幽灵命中说明对应的列表淘汰得太早，向它倾斜目标大小。
+		if g.Value.(*ghost).frequent {
+			c.p -= max(1, c.b1.Len()/max(1, c.b2.Len()))
+			if c.p < 0 {
+				c.p = 0
+			}
+		} else {
+			c.p += max(1, c.b2.Len()/max(1, c.b1.Len()))
+			if cp := c.capacity(); c.p > cp {
+				c.p = cp
+			}
+		}
+		c.removeGhost(g)
+		e.frequent = true
+		c.cache[key] = c.t2.PushFront(e)
+	} else {
+		c.cache[key] = c.t1.PushFront(e)
+	}
+	if c.MaxEntries != 0 && len(c.cache) > c.MaxEntries {
+		c.RemoveOldest()
+	}
+}
+
+// Get 从缓存中查找键的值。
+func (c *Cache) Get(key Key) (value interface{}, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		c.hit(ele)
+		return c.cache[key].Value.(*entry).value, true
+	}
+	return
+}
+
+// hit 把被再次访问的条目移到 t2 的前端。
+func (c *Cache) hit(ele *list.Element) {
+	e := ele.Value.(*entry)
+	if e.frequent {
+		c.t2.MoveToFront(ele)
+		return
+	}
+	c.t1.Remove(ele)
+	e.frequent = true
+	c.cache[e.key] = c.t2.PushFront(e)
+}
+
+// Peek 查找键的值，但不改变条目的顺序或访问次数。
+func (c *Cache) Peek(key Key) (value interface{}, ok bool) {
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// Remove 从缓存中移除提供的键。被显式移除的键不会留下幽灵。
+func (c *Cache) Remove(key Key) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		c.removeElement(ele, false)
+	}
+}
+
+// RemoveOldest 按 ARC 的替换规则淘汰一个条目：t1 超过目标大小时
+// 淘汰 t1 中最久未使用的条目，否则淘汰 t2 中的。
+func (c *Cache) RemoveOldest() {
+	if c.cache == nil {
+		return
+	}
+	if c.t1.Len() > 0 && (c.t1.Len() > c.p || c.t2.Len() == 0) {
+		c.removeElement(c.t1.Back(), true)
+	} else if c.t2.Len() > 0 {
+		c.removeElement(c.t2.Back(), true)
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element, remember bool) {
+	e := ele.Value.(*entry)
+	if e.frequent {
+		c.t2.Remove(ele)
+	} else {
+		c.t1.Remove(ele)
+	}
+	delete(c.cache, e.key)
+	if remember {
+		g := &ghost{key: e.key, frequent: e.frequent}
+		if e.frequent {
+			c.ghosts[e.key] = c.b2.PushFront(g)
+		} else {
+			c.ghosts[e.key] = c.b1.PushFront(g)
+		}
+		c.trimGhosts()
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// trimGhosts 将幽灵列表的总长度限制在容量以内。
+func (c *Cache) trimGhosts() {
+	for c.b1.Len()+c.b2.Len() > c.capacity() {
+		if c.b1.Len() > c.b2.Len() {
+			c.removeGhost(c.b1.Back())
+		} else {
+			c.removeGhost(c.b2.Back())
+		}
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	g := ele.Value.(*ghost)
+	if g.frequent {
+		c.b2.Remove(ele)
+	} else {
+		c.b1.Remove(ele)
+	}
+	delete(c.ghosts, g.key)
+}
+
+// Range 对每个驻留条目调用 f，直到 f 返回 false：先是 t1 再是 t2，
+// 各自从最久未使用的开始，大致是淘汰的先后顺序。它不访问幽灵键，
+// 也不改变条目的位置，f 不能修改缓存。
+func (c *Cache) Range(f func(key Key, value interface{}) bool) {
+	if c.cache == nil {
+		return
+	}
+	for _, l := range []*list.List{c.t1, c.t2} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			e := ele.Value.(*entry)
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// Len 返回缓存中的项目数，不包括幽灵键。
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Clear 清除缓存中所有存储的项目。
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, ele := range c.cache {
+			e := ele.Value.(*entry)
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+	c.cache = nil
+	c.ghosts = nil
+}
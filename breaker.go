@@ -0,0 +1,189 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 由熔断器打开的对等体立即返回，请求不会被发出。
+var ErrCircuitOpen = errors.New("groupcache: peer circuit open")
+
+// CircuitState 是对等体熔断器的状态。
+type CircuitState int
+
+const (
+	// CircuitClosed 表示对等体健康，请求正常发往它。
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen 表示对等体连续失败，在冷却时间过去之前
+	// 不再向它发送请求。
+	CircuitOpen
+
+	// CircuitHalfOpen 表示冷却时间已过，一个探测请求正在确认
+	// 对等体是否恢复。
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// MarshalText 使 CircuitState 在 JSON 中编码为它的名称。
+func (s CircuitState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// CircuitStats 是一个对等体的熔断器的快照。
+type CircuitStats struct {
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	Opens               int64        `json:"opens"`     // 熔断器打开的次数
+	OpenedAt            time.Time    `json:"opened_at"` // 最近一次打开的时间
+}
+
+// breaker 是一个对等体的熔断器。连续 threshold 次失败后打开；打开
+// cooldown 之后转为半开，只放行一个探测请求，探测成功则关闭，失败则
+// 重新打开。探测请求超过 cooldown 仍未结束时，放行下一个探测请求。
+// nil 的 *breaker 总是放行。
+type breaker struct {
+	peer      string // 用于日志
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int       // 连续失败的次数
+	openedAt time.Time // 最近一次打开的时间
+	probeAt  time.Time // 进行中的探测请求开始的时间，零值表示没有
+	opens    int64
+}
+
+func newBreaker(peer string, threshold int, cooldown time.Duration) *breaker {
+	return &breaker{peer: peer, threshold: threshold, cooldown: cooldown}
+}
+
+// ready 报告现在是否应该选择这个对等体，但不占用探测请求。
+func (b *breaker) ready() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	switch b.state {
+	case CircuitOpen:
+		return now.Sub(b.openedAt) >= b.cooldown
+	case CircuitHalfOpen:
+		return b.probeAt.IsZero() || now.Sub(b.probeAt) >= b.cooldown
+	}
+	return true
+}
+
+// acquire 报告是否可以向对等体发送一个请求。打开或半开时，
+// 放行的请求成为探测请求。放行的请求结束后必须调用 done。
+func (b *breaker) acquire() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		logger().Info("对等体熔断器半开", "peer", b.peer)
+	case CircuitHalfOpen:
+		if !b.probeAt.IsZero() && now.Sub(b.probeAt) < b.cooldown {
+			return false
+		}
+	default:
+		return true
+	}
+	b.probeAt = now
+	return true
+}
+
+// done 根据请求的结果更新熔断器。调用者取消的请求不影响状态。
+func (b *breaker) done(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if errors.Is(err, context.Canceled) {
+		b.probeAt = time.Time{}
+		return
+	}
+	if !isPeerFailure(err) {
+		if b.state != CircuitClosed {
+			logger().Info("对等体熔断器关闭", "peer", b.peer)
+		}
+		b.state = CircuitClosed
+		b.failures = 0
+		b.probeAt = time.Time{}
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.threshold) {
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+		b.probeAt = time.Time{}
+		b.opens++
+		logger().Warn("对等体熔断器打开", "peer", b.peer, "failures", b.failures, "err", err)
+	}
+}
+
+func (b *breaker) stats() CircuitStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return CircuitStats{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Opens:               b.opens,
+		OpenedAt:            b.openedAt,
+	}
+}
+
+// isPeerFailure 报告 err 是否说明对等体不健康：网络错误、超时、
+// 无法解析的响应和对等体自身的 5xx 响应。键不存在、过大的响应、
+// 4xx 响应和对等体转达的 Getter 或后端数据源的错误不算，否则数据源
+// 故障会打开所有健康对等体的熔断器。
+func isPeerFailure(err error) bool {
+	var se *statusError
+	switch {
+	case err == nil, errors.Is(err, ErrNotFound), errors.Is(err, ErrResponseTooLarge):
+		return false
+	case errors.As(err, &se):
+		return se.code >= 500 && !se.getter
+	}
+	return true
+}
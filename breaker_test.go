@@ -0,0 +1,85 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker("peer", 2, 20*time.Millisecond)
+	failure := errors.New("connection refused")
+
+	b.acquire()
+	b.done(failure)
+	b.acquire()
+	b.done(nil) // a success resets the count
+	for i := 0; i < 2; i++ {
+		if !b.acquire() {
+			t.Fatalf("closed breaker rejected request %d", i)
+		}
+		b.done(failure)
+	}
+	if st := b.stats(); st.State != CircuitOpen || st.Opens != 1 || st.ConsecutiveFailures != 2 {
+		t.Fatalf("after 2 failures stats = %+v; want open once", st)
+	}
+	if b.ready() || b.acquire() {
+		t.Fatal("open breaker let a request through before the cooldown")
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if !b.ready() || !b.acquire() {
+		t.Fatal("breaker did not allow a probe after the cooldown")
+	}
+	if b.stats().State != CircuitHalfOpen || b.ready() || b.acquire() {
+		t.Fatal("half-open breaker allowed a second probe")
+	}
+	b.done(failure)
+	if st := b.stats(); st.State != CircuitOpen || st.Opens != 2 {
+		t.Fatalf("after a failed probe stats = %+v; want open twice", st)
+	}
+
+	// A cancelled probe frees the slot without changing the state.
+	time.Sleep(25 * time.Millisecond)
+	b.acquire()
+	b.done(context.Canceled)
+	if b.stats().State != CircuitHalfOpen || !b.acquire() {
+		t.Fatal("cancelled probe did not free the probe slot")
+	}
+	b.done(nil)
+	if st := b.stats(); st.State != CircuitClosed || st.ConsecutiveFailures != 0 {
+		t.Fatalf("after a successful probe stats = %+v; want closed", st)
+	}
+
+	// Answers that come from a healthy peer do not count as failures.
+	for _, err := range []error{ErrNotFound, &statusError{code: 404, status: "404 Not Found"}, &statusError{code: 502, status: "502 Bad Gateway", getter: true}} {
+		b.done(err)
+	}
+	b.done(&statusError{code: 503, status: "503 Service Unavailable"})
+	if st := b.stats(); st.ConsecutiveFailures != 1 {
+		t.Errorf("consecutive failures = %d; want only the 503 counted", st.ConsecutiveFailures)
+	}
+
+	var nb *breaker
+	if !nb.ready() || !nb.acquire() {
+		t.Error("nil breaker rejected a request")
+	}
+	nb.done(failure)
+}
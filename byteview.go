@@ -20,8 +20,8 @@ import (
 	"bytes"
 	"errors"
 	"io"
-	"log"
 	"strings"
+	"time"
 )
 
 // ByteView 持有字节的不可变视图。
@@ -34,6 +34,23 @@ type ByteView struct {
 	// 如果 b 非 nil，则使用 b，否则使用 s。
 	b []byte
 	s string
+	// e 是值的过期时间；零值表示永不过期。
+	e time.Time
+	// notFound 标记缓存的否定结果，即键在数据源中不存在。
+	notFound bool
+	// codec 不为 nil 时，b 是用它压缩的值。压缩的视图只保存在缓存中，
+	// 交给调用者之前由 setSinkView 解压。
+	codec Codec
+}
+
+// Expire 返回视图的过期时间。零值表示永不过期。
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// expired 报告视图在 now 时刻是否已经过期。
+func (v ByteView) expired(now time.Time) bool {
+	return !v.e.IsZero() && !now.Before(v.e)
 }
 
 // Len 返回视图的长度。
@@ -47,20 +64,16 @@ func (v ByteView) Len() int {
 // ByteSlice 返回数据的副本，作为字节切片。
 func (v ByteView) ByteSlice() []byte {
 	if v.b != nil {
-		log.Printf("ByteView: ByteSlice() called, returning copy of b (len %d)", len(v.b))
 		return cloneBytes(v.b)
 	}
-	log.Printf("ByteView: ByteSlice() called, returning new []byte from s (len %d)", len(v.s))
 	return []byte(v.s)
 }
 
 // String 返回数据作为字符串，如有必要会进行复制。
 func (v ByteView) String() string {
 	if v.b != nil {
-		log.Printf("ByteView: String() called, returning string from b (len %d)", len(v.b))
 		return string(v.b)
 	}
-	log.Printf("ByteView: String() called, returning s (len %d)", len(v.s))
 	return v.s
 }
 
@@ -75,17 +88,17 @@ func (v ByteView) At(i int) byte {
 // Slice 在提供的 from 和 to 索引之间对视图进行切片。
 func (v ByteView) Slice(from, to int) ByteView {
 	if v.b != nil {
-		return ByteView{b: v.b[from:to]}
+		return ByteView{b: v.b[from:to], e: v.e}
 	}
-	return ByteView{s: v.s[from:to]}
+	return ByteView{s: v.s[from:to], e: v.e}
 }
 
 // SliceFrom 从提供的索引到末尾对视图进行切片。
 func (v ByteView) SliceFrom(from int) ByteView {
 	if v.b != nil {
-		return ByteView{b: v.b[from:]}
+		return ByteView{b: v.b[from:], e: v.e}
 	}
-	return ByteView{s: v.s[from:]}
+	return ByteView{s: v.s[from:], e: v.e}
 }
 
 // Copy 将 b 复制到 dest 并返回复制的字节数。
@@ -0,0 +1,202 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const defaultCompressMinBytes = 512
+
+// 对等体之间协商值的编码使用的 HTTP 头。请求列出调用者接受的编码，
+// 响应中的值被压缩时注明使用的编码。
+const (
+	acceptEncodingHeader = "Groupcache-Accept-Encoding"
+	valueEncodingHeader  = "Groupcache-Value-Encoding"
+)
+
+// Codec 压缩和解压值，例如 gzip、snappy 或 zstd。实现必须可以被
+// 并发使用。GzipCodec 是基于标准库的实现，其他算法可以包装
+// 第三方库实现这个接口。
+type Codec interface {
+	// Name 返回编码的名称，例如 "gzip"，对等体之间用它协商编码。
+	// 集群中同名的 Codec 必须兼容。
+	Name() string
+
+	// Encode 返回压缩后的 src。
+	Encode(src []byte) ([]byte, error)
+
+	// Decode 返回 Encode 的结果解压后的数据。max 大于零时，解压的数据
+	// 一旦超过 max 字节就停止并返回 ErrResponseTooLarge，不能先把全部
+	// 数据解压到内存中再检查大小。
+	Decode(src []byte, max int64) ([]byte, error)
+}
+
+// GzipCodec 返回使用 compress/gzip 的 Codec，level 与 gzip.NewWriterLevel
+// 的相同，零表示 gzip.DefaultCompression。
+func GzipCodec(level int) Codec {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return &gzipCodec{level: level}
+}
+
+type gzipCodec struct {
+	level   int
+	writers sync.Pool // *gzip.Writer
+	readers sync.Pool // *gzip.Reader
+}
+
+func (c *gzipCodec) Name() string {
+	return "gzip"
+}
+
+func (c *gzipCodec) Encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, _ := c.writers.Get().(*gzip.Writer)
+	if w == nil {
+		var err error
+		if w, err = gzip.NewWriterLevel(&buf, c.level); err != nil {
+			return nil, err
+		}
+	} else {
+		w.Reset(&buf)
+	}
+	defer c.writers.Put(w)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCodec) Decode(src []byte, max int64) ([]byte, error) {
+	r, err := c.decodeReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if max <= 0 {
+		return io.ReadAll(r)
+	}
+	b, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err == nil && int64(len(b)) > max {
+		return nil, ErrResponseTooLarge
+	}
+	return b, err
+}
+
+// readerCodec 由可以边读边解压的 Codec 实现。流式的 Get 响应用它直接
+// 从响应体解压，不必先把压缩的值读入内存。
+type readerCodec interface {
+	decodeReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// decodeReader 返回解压 r 的 Reader，关闭它时 gzip.Reader 被放回池中。
+func (c *gzipCodec) decodeReader(r io.Reader) (io.ReadCloser, error) {
+	zr, _ := c.readers.Get().(*gzip.Reader)
+	var err error
+	if zr == nil {
+		zr, err = gzip.NewReader(r)
+	} else {
+		err = zr.Reset(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return gzipReader{zr, c}, nil
+}
+
+type gzipReader struct {
+	*gzip.Reader
+	c *gzipCodec
+}
+
+func (r gzipReader) Close() error {
+	r.c.readers.Put(r.Reader)
+	return nil
+}
+
+// decodeValue 用 c 解压 b，解压的数据至多 max 个字节。
+func decodeValue(c Codec, b []byte, max int64) ([]byte, error) {
+	v, err := c.Decode(b, max)
+	if err != nil && err != ErrResponseTooLarge {
+		return nil, fmt.Errorf("decoding value: %v", err)
+	}
+	return v, err
+}
+
+// findCodec 返回 codecs 中第一个名称出现在 names 中的 Codec，
+// names 是逗号分隔的编码名称。没有时返回 nil。
+func findCodec(codecs []Codec, names string) Codec {
+	if names == "" {
+		return nil
+	}
+	for _, c := range codecs {
+		for _, name := range strings.Split(names, ",") {
+			if strings.TrimSpace(name) == c.Name() {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// codecNames 返回 codecs 的逗号分隔的名称。
+func codecNames(codecs []Codec) string {
+	names := make([]string, len(codecs))
+	for i, c := range codecs {
+		names[i] = c.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// bytes 返回视图的字节，视图包装 string 时复制。
+func (v ByteView) bytes() []byte {
+	if v.b != nil {
+		return v.b
+	}
+	return []byte(v.s)
+}
+
+// encode 返回用 c 压缩的视图。压缩失败或没有变小时返回 v。
+func (v ByteView) encode(c Codec) ByteView {
+	b, err := c.Encode(v.bytes())
+	if err != nil || len(b) >= v.Len() {
+		return v
+	}
+	return ByteView{b: b, e: v.e, codec: c}
+}
+
+// decode 返回解压的视图。视图没有压缩时返回 v。
+func (v ByteView) decode() (ByteView, error) {
+	if v.codec == nil {
+		return v, nil
+	}
+	b, err := v.codec.Decode(v.b, 0)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return ByteView{b: b, e: v.e}, nil
+}
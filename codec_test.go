@@ -0,0 +1,212 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+// countingCodec counts the calls to a wrapped Codec.
+type countingCodec struct {
+	Codec
+	encodes, decodes atomic.Int64
+}
+
+func (c *countingCodec) Encode(src []byte) ([]byte, error) {
+	c.encodes.Add(1)
+	return c.Codec.Encode(src)
+}
+
+func (c *countingCodec) Decode(src []byte, max int64) ([]byte, error) {
+	c.decodes.Add(1)
+	return c.Codec.Decode(src, max)
+}
+
+var jsonValue = strings.Repeat(`{"id":42,"name":"item","tags":["a","b"]},`, 100)
+
+func TestGzipCodec(t *testing.T) {
+	c := GzipCodec(0)
+	for _, in := range []string{"", "x", jsonValue} {
+		enc, err := c.Encode([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := c.Decode(enc, 0)
+		if err != nil || string(out) != in {
+			t.Errorf("round trip of %d bytes = %d bytes, %v", len(in), len(out), err)
+		}
+	}
+	enc, _ := c.Encode([]byte(jsonValue))
+	if _, err := c.Decode(enc, int64(len(jsonValue)-1)); err != ErrResponseTooLarge {
+		t.Errorf("Decode over the limit = %v; want ErrResponseTooLarge", err)
+	}
+	if out, err := c.Decode(enc, int64(len(jsonValue))); err != nil || string(out) != jsonValue {
+		t.Errorf("Decode at the limit = %d bytes, %v", len(out), err)
+	}
+	if _, err := c.Decode([]byte("not gzip"), 0); err == nil {
+		t.Error("Decode of garbage succeeded")
+	}
+	if got := findCodec([]Codec{c}, "zstd, gzip"); got != c {
+		t.Errorf("findCodec = %v; want gzip", got)
+	}
+	if got := findCodec([]Codec{c}, "zstd"); got != nil {
+		t.Errorf("findCodec of an unknown name = %v", got)
+	}
+}
+
+func TestCacheCodec(t *testing.T) {
+	codec := &countingCodec{Codec: GzipCodec(0)}
+	g := NewRegistry().NewGroupOpts("cacheCodec", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "small" {
+			return dest.SetString("tiny")
+		}
+		return dest.SetString(jsonValue)
+	}), &GroupOptions{CacheCodec: codec})
+
+	for i := 0; i < 2; i++ {
+		var s string
+		if err := g.Get(dummyCtx, "big", StringSink(&s)); err != nil || s != jsonValue {
+			t.Fatalf("Get #%d = %d bytes, %v", i, len(s), err)
+		}
+	}
+	if n := codec.decodes.Load(); n != 1 {
+		t.Errorf("decodes = %d; want 1 for the cache hit", n)
+	}
+	if st := g.CacheStats(MainCache); st.Bytes >= int64(len(jsonValue))/4 {
+		t.Errorf("cache holds %d bytes for a %d byte value", st.Bytes, len(jsonValue))
+	}
+
+	var s string
+	g.Get(dummyCtx, "small", StringSink(&s))
+	g.Get(dummyCtx, "small", StringSink(&s))
+	if s != "tiny" || codec.encodes.Load() != 1 {
+		t.Errorf("small value = %q after %d encodes; want it stored uncompressed", s, codec.encodes.Load())
+	}
+}
+
+// TestHTTPPoolCodecs checks that peers negotiate a value encoding, and that
+// a value cached compressed with that encoding is sent without recompressing.
+func TestHTTPPoolCodecs(t *testing.T) {
+	codec := &countingCodec{Codec: GzipCodec(0)}
+	reg := NewRegistry()
+	var encoding atomic.Value
+	var server *HTTPPool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, r)
+		encoding.Store(rec.Header().Get(valueEncodingHeader))
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer ts.Close()
+	server = NewHTTPPoolOpts(ts.URL, &HTTPPoolOptions{Registry: reg, Codecs: []Codec{codec}})
+	server.Set(ts.URL)
+	reg.NewGroupOpts("codecs", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(jsonValue)
+	}), &GroupOptions{CacheCodec: codec})
+
+	get := func(codecs []Codec) string {
+		t.Helper()
+		p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry(), Codecs: codecs})
+		p.Set(ts.URL)
+		peer, _ := p.PickPeer("key")
+		res := &pb.GetResponse{}
+		if err := peer.Get(dummyCtx, &pb.GetRequest{Group: proto.String("codecs"), Key: proto.String("key")}, res); err != nil || !bytes.Equal(res.Value, []byte(jsonValue)) {
+			t.Fatalf("Get = %d bytes, %v", len(res.Value), err)
+		}
+		return encoding.Load().(string)
+	}
+	if enc := get([]Codec{GzipCodec(0)}); enc != "gzip" {
+		t.Errorf("value encoding = %q; want gzip", enc)
+	}
+	// A codec that cannot decode from a reader gets the whole value.
+	if enc := get([]Codec{&countingCodec{Codec: GzipCodec(0)}}); enc != "gzip" {
+		t.Errorf("value encoding = %q; want gzip", enc)
+	}
+	// A cache hit sends the value as it is stored in the cache.
+	encodes := codec.encodes.Load()
+	if enc := get([]Codec{GzipCodec(0)}); enc != "gzip" {
+		t.Errorf("value encoding of a cache hit = %q; want gzip", enc)
+	}
+	if n := codec.encodes.Load(); n != encodes {
+		t.Errorf("cache hit was compressed again: %d encodes; want %d", n, encodes)
+	}
+	if n := codec.decodes.Load(); n != 0 {
+		t.Errorf("server decodes = %d; want 0", n)
+	}
+	if enc := get(nil); enc != "" {
+		t.Errorf("value encoding for a peer without codecs = %q", enc)
+	}
+	if n := codec.decodes.Load(); n != 1 {
+		t.Errorf("server decodes = %d; want 1 for a peer without codecs", n)
+	}
+}
+
+// TestHTTPPoolGzipBomb checks that a compressed value is inflated only up to
+// MaxResponseBytes, not in full before the size check.
+func TestHTTPPoolGzipBomb(t *testing.T) {
+	const inflated = 64 << 20
+	bomb, err := GzipCodec(gzip.BestCompression).Encode(make([]byte, inflated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := proto.Marshal(&pb.GetResponse{Value: bomb})
+	// The bomb is sent both inside a GetResponse and as a streamed value.
+	for contentType, body := range map[string][]byte{
+		protoContentType:  body,
+		streamContentType: bomb,
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set(valueEncodingHeader, "gzip")
+			w.Write(body)
+		}))
+		defer ts.Close()
+
+		p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+			Registry:         NewRegistry(),
+			Codecs:           []Codec{GzipCodec(0)},
+			MaxResponseBytes: 1 << 20,
+		})
+		p.Set(ts.URL)
+		peer, _ := p.PickPeer("key")
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		err = peer.Get(dummyCtx, &pb.GetRequest{Group: proto.String("g"), Key: proto.String("key")}, &pb.GetResponse{})
+		runtime.ReadMemStats(&after)
+		if err != ErrResponseTooLarge {
+			t.Fatalf("%s: Get = %v; want ErrResponseTooLarge", contentType, err)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 16<<20 {
+			t.Errorf("%s: Get allocated %d bytes for a %d byte limit", contentType, n, 1<<20)
+		}
+	}
+}
@@ -19,18 +19,31 @@ package consistenthash
 
 import (
 	"hash/crc32"
-	"log"
+	"math"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 type Hash func(data []byte) uint32
 
+// Map 是一致性哈希环。Add、AddWeighted、Remove 和 SetLoadFactor
+// 不能与 Get 或它们彼此并发调用；Inc 和 Done 可以与任何方法并发调用。
 type Map struct {
 	hash     Hash
 	replicas int
-	keys     []int // 已排序
+	keys     []int // 已排序；修改时总是替换为新的切片
 	hashMap  map[int]string
+
+	weights     map[string]int // 每个节点的权重
+	totalWeight int
+
+	// loadFactor 大于零时启用有界负载，参见 SetLoadFactor。
+	loadFactor float64
+	loadsMu    sync.RWMutex             // 保护 loads 映射本身，计数器是原子的
+	loads      map[string]*atomic.Int64 // 每个节点进行中的请求数；节点移除后保留
+	totalLoad  atomic.Int64
 }
 
 func New(replicas int, fn Hash) *Map {
@@ -38,6 +51,8 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
+		loads:    make(map[string]*atomic.Int64),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -50,46 +65,240 @@ func (m *Map) IsEmpty() bool {
 	return len(m.keys) == 0
 }
 
-// Add 向哈希中添加一些键。
-func (m *Map) Add(keys ...string) {
+// Add 向哈希中添加一些键，每个键的权重为 1，并返回因此移动到
+// 这些键的区间。已有的键的权重被改为 1。
+func (m *Map) Add(keys ...string) []Range {
 	if len(keys) == 0 {
-		return
+		return nil
+	}
+	before := m.snapshot()
+	var hashes []int
+	for _, key := range keys {
+		m.remove(key)
+		hashes = append(hashes, m.add(key, 1)...)
+	}
+	sort.Ints(hashes)
+	m.keys = mergeSorted(m.keys, hashes)
+	return m.movedSince(before)
+}
+
+// AddWeighted 向哈希中添加一个权重为 weight 的键，它在环上有
+// weight 倍的虚拟节点，因此分到的键也大约是权重为 1 的键的 weight 倍。
+// 键已存在时，其权重被改为 weight。weight 小于 1 时视为 1。
+// 返回因此移动的区间。
+func (m *Map) AddWeighted(key string, weight int) []Range {
+	if weight < 1 {
+		weight = 1
+	}
+	before := m.snapshot()
+	m.remove(key)
+	hashes := m.add(key, weight)
+	sort.Ints(hashes)
+	m.keys = mergeSorted(m.keys, hashes)
+	return m.movedSince(before)
+}
+
+// Remove 从哈希中移除键，并返回因此从该键移走的区间。
+// 键不存在时返回 nil。
+func (m *Map) Remove(key string) []Range {
+	if _, ok := m.weights[key]; !ok {
+		return nil
+	}
+	before := m.snapshot()
+	m.remove(key)
+	return m.movedSince(before)
+}
+
+// Update 在一次变化中移除 remove 中的键，并加入 add 中的键或修改其
+// 权重，返回与变化前相比移动的区间。与逐个调用 Remove 和 AddWeighted
+// 不同，返回的区间不经过中间状态的环，只包含所有者最终改变的部分。
+func (m *Map) Update(add map[string]int, remove []string) []Range {
+	before := m.snapshot()
+	for _, key := range remove {
+		m.remove(key)
 	}
-	//log.Printf("ConsistentHash: 开始添加节点: %v", keys)
-	addedHashes := 0
+	keys := make([]string, 0, len(add))
+	for key := range add {
+		keys = append(keys, key)
+	}
+	// 按固定顺序加入，使哈希冲突的结果与 map 的遍历顺序无关。
+	sort.Strings(keys)
+	var hashes []int
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
-			// 避免过多日志，可以考虑只在 DEBUG 级别记录每个哈希，或只记录总数
-			// log.Printf("ConsistentHash: 添加虚拟节点 %s (replica %d), hash %d", key, i, hash)
-			addedHashes++
+		weight := add[key]
+		if weight < 1 {
+			weight = 1
+		}
+		m.remove(key)
+		hashes = append(hashes, m.add(key, weight)...)
+	}
+	sort.Ints(hashes)
+	m.keys = mergeSorted(m.keys, hashes)
+	return m.movedSince(before)
+}
+
+// add 为键生成虚拟节点并返回它们的哈希（未排序），但不把它们加入 keys。
+func (m *Map) add(key string, weight int) []int {
+	hashes := make([]int, 0, m.replicas*weight)
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		hashes = append(hashes, hash)
+		m.hashMap[hash] = key
+	}
+	m.weights[key] = weight
+	m.totalWeight += weight
+	m.loadsMu.Lock()
+	if m.loads[key] == nil {
+		m.loads[key] = new(atomic.Int64)
+	}
+	m.loadsMu.Unlock()
+	return hashes
+}
+
+// remove 从环上移除键的虚拟节点。与其他键冲突而被覆盖的虚拟节点
+// 仍属于另一个键。
+func (m *Map) remove(key string) {
+	weight, ok := m.weights[key]
+	if !ok {
+		return
+	}
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		if m.hashMap[hash] == key {
+			delete(m.hashMap, hash)
+		}
+	}
+	keys := make([]int, 0, len(m.keys))
+	for _, hash := range m.keys {
+		if _, ok := m.hashMap[hash]; ok {
+			keys = append(keys, hash)
+		}
+	}
+	m.keys = keys
+	delete(m.weights, key)
+	m.totalWeight -= weight
+}
+
+// mergeSorted 合并两个已排序的切片，返回新的切片。
+func mergeSorted(a, b []int) []int {
+	merged := make([]int, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if a[0] <= b[0] {
+			merged = append(merged, a[0])
+			a = a[1:]
+		} else {
+			merged = append(merged, b[0])
+			b = b[1:]
 		}
 	}
-	sort.Ints(m.keys)
-	//log.Printf("ConsistentHash: 添加完成, 共生成 %d 个虚拟节点并排序", addedHashes)
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+// Weight 返回 key 的权重，key 不在哈希中时返回零。
+func (m *Map) Weight(key string) int {
+	return m.weights[key]
+}
+
+// SetLoadFactor 启用有界负载的一致性哈希：当环上键的所有者进行中的
+// 请求数超过按权重分摊的平均负载的 c 倍时，Get 沿环顺时针溢出到
+// 下一个未超载的键。负载通过 Inc 和 Done 报告。
+//
+// c 越接近 1，负载越均衡，但溢出的键也越多；小于 1 时视为 1。
+// c 为零（默认）时禁用有界负载。
+func (m *Map) SetLoadFactor(c float64) {
+	if c > 0 && c < 1 {
+		c = 1
+	}
+	m.loadFactor = c
+}
+
+// Inc 记录一个发往 key 的进行中的请求。key 从未加入哈希时什么也不做。
+func (m *Map) Inc(key string) {
+	m.loadsMu.RLock()
+	defer m.loadsMu.RUnlock()
+	if l := m.loads[key]; l != nil {
+		l.Add(1)
+		m.totalLoad.Add(1)
+	}
+}
+
+// Done 记录一个发往 key 的请求已完成，与 Inc 成对调用。
+// key 在此期间被移除也没有关系。
+func (m *Map) Done(key string) {
+	m.loadsMu.RLock()
+	defer m.loadsMu.RUnlock()
+	if l := m.loads[key]; l != nil {
+		l.Add(-1)
+		m.totalLoad.Add(-1)
+	}
 }
 
-// Get 获取哈希中与提供的键最接近的项。
+// Load 返回 key 进行中的请求数。
+func (m *Map) Load(key string) int64 {
+	m.loadsMu.RLock()
+	defer m.loadsMu.RUnlock()
+	if l := m.loads[key]; l != nil {
+		return l.Load()
+	}
+	return 0
+}
+
+// Get 获取哈希中与提供的键最接近的项。启用有界负载时，
+// 跳过已超载的项；所有项都超载时返回最接近的项。
 func (m *Map) Get(key string) string {
 	if m.IsEmpty() {
-		log.Printf("ConsistentHash: Get(\"%s\") - 哈希环为空", key)
 		return ""
 	}
 
-	hash := int(m.hash([]byte(key)))
-	log.Printf("ConsistentHash: Get(\"%s\") - 计算哈希值: %d", key, hash)
-
-	// 对适当的副本进行二分查找。
-	idx := sort.Search(len(m.keys), func(i int) bool { return m.keys[i] >= hash })
+	idx := search(m.keys, int(m.hash([]byte(key))))
+	owner := m.hashMap[m.keys[idx]]
+	if m.loadFactor == 0 {
+		return owner
+	}
+	for i := 0; i < len(m.keys); i++ {
+		if node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]; m.underLoaded(node) {
+			return node
+		}
+	}
+	return owner
+}
 
-	// 表示我们已循环回到第一个副本。
-	if idx == len(m.keys) {
-		idx = 0
+// GetN 返回哈希中与提供的键最接近的至多 n 个不同的项，按沿环
+// 顺时针的顺序排列，因此第一个与 Get 返回的相同。启用有界负载时，
+// 已超载的项排在未超载的项之后。
+func (m *Map) GetN(key string, n int) []string {
+	if m.IsEmpty() || n <= 0 {
+		return nil
+	}
+	if n > len(m.weights) {
+		n = len(m.weights)
 	}
+	idx := search(m.keys, int(m.hash([]byte(key))))
+	nodes := make([]string, 0, n)
+	var overloaded []string
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if contains(nodes, node) || contains(overloaded, node) {
+			continue
+		}
+		if m.loadFactor != 0 && !m.underLoaded(node) {
+			overloaded = append(overloaded, node)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	// 哈希冲突可能使某些节点在环上没有点，找到的节点会少于 n 个。
+	if nodes = append(nodes, overloaded...); len(nodes) > n {
+		nodes = nodes[:n]
+	}
+	return nodes
+}
 
-	node := m.hashMap[m.keys[idx]]
-	log.Printf("ConsistentHash: Get(\"%s\") - 找到节点: %s (通过虚拟节点哈希 %d)", key, node, m.keys[idx])
-	return node
+// underLoaded 报告节点再接受一个请求后是否仍不超过其容量，
+// 即 loadFactor 倍的、按权重分摊的（包括这个请求在内的）总负载。
+func (m *Map) underLoaded(key string) bool {
+	share := float64(m.weights[key]) / float64(m.totalWeight)
+	capacity := math.Ceil(m.loadFactor * float64(m.totalLoad.Load()+1) * share)
+	return float64(m.loads[key].Load()+1) <= capacity
 }
@@ -18,6 +18,7 @@ package consistenthash
 
 import (
 	"fmt"
+	"hash/fnv"
 	"strconv"
 	"testing"
 )
@@ -86,6 +87,229 @@ func TestConsistency(t *testing.T) {
 
 }
 
+func TestWeighted(t *testing.T) {
+	// crc32 spreads two nodes' replica hashes poorly; FNV shows the weights.
+	hash := New(50, func(key []byte) uint32 {
+		h := fnv.New32a()
+		h.Write(key)
+		return h.Sum32()
+	})
+	hash.AddWeighted("big", 3)
+	hash.Add("small")
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[hash.Get("key-"+strconv.Itoa(i))]++
+	}
+	// With three times the virtual nodes, "big" should own about 75% of the keys.
+	if ratio := float64(counts["big"]) / 10000; ratio < 0.65 || ratio > 0.85 {
+		t.Errorf("big owns %.2f of the keys; want about 0.75 (counts %v)", ratio, counts)
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c")
+	hash.SetLoadFactor(1.25)
+
+	owner := hash.Get("hot")
+	hash.Inc(owner)
+	// A second request to the owner would exceed ceil(1.25 * 2 / 3).
+	spill := hash.Get("hot")
+	if spill == owner {
+		t.Fatalf("Get kept returning overloaded owner %q", owner)
+	}
+	hash.Inc(spill)
+	if n := hash.Load(owner) + hash.Load(spill); n != 2 {
+		t.Errorf("total load = %d; want 2", n)
+	}
+
+	hash.Done(owner)
+	if got := hash.Get("hot"); got != owner {
+		t.Errorf("after Done, Get = %q; want owner %q", got, owner)
+	}
+
+	// Without a load factor, load is ignored.
+	plain := New(50, nil)
+	plain.Add("a", "b", "c")
+	for i := 0; i < 10; i++ {
+		plain.Inc(owner)
+	}
+	if got := plain.Get("hot"); got != owner {
+		t.Errorf("unbounded Get = %q; want owner %q", got, owner)
+	}
+}
+
+func TestGetN(t *testing.T) {
+	// Same ring as TestHashing: 2, 4, 6, 12, 14, 16, 22, 24, 26.
+	hash := New(3, func(key []byte) uint32 {
+		i, err := strconv.Atoi(string(key))
+		if err != nil {
+			panic(err)
+		}
+		return uint32(i)
+	})
+	if got := hash.GetN("1", 2); got != nil {
+		t.Errorf("GetN on an empty ring = %v; want nil", got)
+	}
+	hash.Add("6", "4", "2")
+
+	testCases := []struct {
+		key  string
+		n    int
+		want string
+	}{
+		{"11", 2, "[2 4]"},
+		{"23", 5, "[4 6 2]"},
+		{"27", 3, "[2 4 6]"},
+		{"3", 1, "[4]"},
+		{"3", 0, "[]"},
+	}
+	for _, tc := range testCases {
+		if got := fmt.Sprint(hash.GetN(tc.key, tc.n)); got != tc.want {
+			t.Errorf("GetN(%q, %d) = %s; want %s", tc.key, tc.n, got, tc.want)
+		}
+	}
+
+	// Overloaded nodes move to the back, so the first is still Get's answer.
+	hash.SetLoadFactor(1)
+	hash.Inc("2")
+	if got, want := fmt.Sprint(hash.GetN("11", 3)), "[4 6 2]"; got != want || hash.Get("11") != "4" {
+		t.Errorf("bounded GetN = %s, Get = %q; want %s, \"4\"", got, hash.Get("11"), want)
+	}
+
+	// Every point collides, so only one of the nodes is on the ring;
+	// GetN must not pad its answer with empty nodes.
+	hash = New(3, func([]byte) uint32 { return 7 })
+	hash.Add("1", "01")
+	if got := hash.GetN("5", 2); len(got) != 1 || got[0] == "" {
+		t.Errorf("GetN with colliding nodes = %q; want one node", got)
+	}
+}
+
+// checkMoved verifies that ranges cover exactly the keys whose owner
+// changed between before and m.
+func checkMoved(t *testing.T, m *Map, before map[string]string, ranges []Range) {
+	t.Helper()
+	for key, from := range before {
+		to := m.Get(key)
+		var in *Range
+		for i := range ranges {
+			if ranges[i].Contains(m.Hash(key)) {
+				in = &ranges[i]
+				break
+			}
+		}
+		switch {
+		case from == to && in != nil:
+			t.Errorf("key %q stayed on %q but is in moved range %+v", key, from, *in)
+		case from != to && in == nil:
+			t.Errorf("key %q moved from %q to %q but is in no moved range", key, from, to)
+		case from != to && (in.From != from || in.To != to):
+			t.Errorf("key %q moved from %q to %q; range says %+v", key, from, to, *in)
+		}
+	}
+}
+
+func owners(m *Map, n int) map[string]string {
+	o := make(map[string]string)
+	for i := 0; i < n; i++ {
+		key := "key-" + strconv.Itoa(i)
+		o[key] = m.Get(key)
+	}
+	return o
+}
+
+func TestAddRemoveRanges(t *testing.T) {
+	hash := New(20, nil)
+	hash.Add("a", "b", "c")
+	initial := owners(hash, 2000)
+
+	moved := hash.AddWeighted("d", 2)
+	if len(moved) == 0 {
+		t.Fatal("adding d moved no ranges")
+	}
+	for _, r := range moved {
+		if r.To != "d" {
+			t.Errorf("adding d moved range %+v to another node", r)
+		}
+	}
+	checkMoved(t, hash, initial, moved)
+
+	withD := owners(hash, 2000)
+	moved = hash.Remove("d")
+	for _, r := range moved {
+		if r.From != "d" {
+			t.Errorf("removing d moved range %+v from another node", r)
+		}
+	}
+	checkMoved(t, hash, withD, moved)
+	for key, owner := range owners(hash, 2000) {
+		if owner != initial[key] {
+			t.Errorf("after removing d, %q is on %q; want %q", key, owner, initial[key])
+		}
+	}
+	if hash.Remove("d") != nil {
+		t.Error("removing a missing node moved ranges")
+	}
+
+	// Changing a weight moves keys too.
+	before := owners(hash, 2000)
+	checkMoved(t, hash, before, hash.AddWeighted("a", 3))
+	if w := hash.Weight("a"); w != 3 {
+		t.Errorf("weight of a = %d; want 3", w)
+	}
+
+	// Removing the last node leaves an empty ring.
+	hash.Remove("a")
+	hash.Remove("b")
+	if moved := hash.Remove("c"); moved != nil || !hash.IsEmpty() {
+		t.Errorf("removing the last node: moved %+v, empty %v", moved, hash.IsEmpty())
+	}
+}
+
+// TestUpdateRanges checks that a batch update reports only the net movement
+// between the old and the new ring.
+func TestUpdateRanges(t *testing.T) {
+	hash := New(20, nil)
+	hash.Add("a", "b", "c")
+	before := owners(hash, 2000)
+
+	moved := hash.Update(map[string]int{"c": 2, "d": 1}, []string{"b"})
+	checkMoved(t, hash, before, moved)
+	for _, r := range moved {
+		if r.To == "b" || r.From == "d" {
+			t.Errorf("update moved range %+v through an intermediate ring", r)
+		}
+	}
+	if hash.Weight("b") != 0 || hash.Weight("c") != 2 || hash.Weight("d") != 1 {
+		t.Errorf("weights after update: b=%d c=%d d=%d", hash.Weight("b"), hash.Weight("c"), hash.Weight("d"))
+	}
+	if moved := hash.Update(nil, []string{"missing"}); moved != nil {
+		t.Errorf("removing a missing node moved %+v", moved)
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	tests := []struct {
+		r    Range
+		h    uint32
+		want bool
+	}{
+		{Range{Start: 10, End: 20}, 10, false},
+		{Range{Start: 10, End: 20}, 20, true},
+		{Range{Start: 4000000000, End: 5}, 0, true},
+		{Range{Start: 4000000000, End: 5}, 4000000001, true},
+		{Range{Start: 4000000000, End: 5}, 6, false},
+		{Range{Start: 7, End: 7}, 1, true},
+	}
+	for _, tt := range tests {
+		if got := tt.r.Contains(tt.h); got != tt.want {
+			t.Errorf("%+v.Contains(%d) = %v; want %v", tt.r, tt.h, got, tt.want)
+		}
+	}
+}
+
 func BenchmarkGet8(b *testing.B)   { benchmarkGet(b, 8) }
 func BenchmarkGet32(b *testing.B)  { benchmarkGet(b, 32) }
 func BenchmarkGet128(b *testing.B) { benchmarkGet(b, 128) }
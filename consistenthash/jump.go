@@ -0,0 +1,114 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import "hash/crc32"
+
+// Jump 实现 Lamping 和 Veach 的跳跃一致性哈希。它不需要虚拟节点，
+// 分布非常均匀，Get 的开销只与节点数的对数成正比。
+//
+// 跳跃哈希把键映射到编号连续的桶上，只有在末尾增删桶时移动的键
+// 才最少。Jump 按节点名称排序分配桶（权重为 w 的节点占 w 个桶），
+// 使结果与节点加入的顺序无关，因此增删排在中间的节点会使排在它之后
+// 的节点之间也有键移动。适用于成员很少变化的集群。
+type Jump struct {
+	hash    Hash
+	set     nodeSet
+	buckets []string // 每个桶的节点
+}
+
+// NewJump 返回一个使用哈希函数 fn 的 Jump。
+// 如果 fn 为空，默认为 crc32.ChecksumIEEE。
+func NewJump(fn Hash) *Jump {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Jump{hash: fn}
+}
+
+// IsEmpty 如果没有节点，则返回 true。
+func (j *Jump) IsEmpty() bool {
+	return len(j.buckets) == 0
+}
+
+// AddWeighted 加入权重为 weight 的节点，或修改已有节点的权重。
+func (j *Jump) AddWeighted(node string, weight int) []Range {
+	if j.set.add(node, weight) {
+		j.rebuild()
+	}
+	return nil
+}
+
+// Remove 移除节点。
+func (j *Jump) Remove(node string) []Range {
+	if j.set.remove(node) {
+		j.rebuild()
+	}
+	return nil
+}
+
+// Weight 返回节点的权重，节点不存在时返回零。
+func (j *Jump) Weight(node string) int {
+	return j.set.weights[node]
+}
+
+func (j *Jump) rebuild() {
+	j.buckets = j.buckets[:0]
+	for _, node := range j.set.nodes {
+		for i := 0; i < j.set.weights[node]; i++ {
+			j.buckets = append(j.buckets, node)
+		}
+	}
+}
+
+// Get 返回键的所有者。
+func (j *Jump) Get(key string) string {
+	if j.IsEmpty() {
+		return ""
+	}
+	return j.buckets[jumpHash(hash64(j.hash, key), len(j.buckets))]
+}
+
+// GetN 返回键的至多 n 个不同的节点：所有者之后依次是按名称排序的
+// 下一个节点，到末尾时回到第一个。
+func (j *Jump) GetN(key string, n int) []string {
+	if n <= 0 || j.IsEmpty() {
+		return nil
+	}
+	if n > len(j.set.nodes) {
+		n = len(j.set.nodes)
+	}
+	b := jumpHash(hash64(j.hash, key), len(j.buckets))
+	nodes := make([]string, 0, n)
+	for i := 0; len(nodes) < n; i++ {
+		if node := j.buckets[(b+i)%len(j.buckets)]; !contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// jumpHash 将 key 映射到 [0, n) 中的一个桶。
+func jumpHash(key uint64, n int) int {
+	var b, i int64 = -1, 0
+	for i < int64(n) {
+		b = i
+		key = key*2862933555777941757 + 1
+		i = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import "hash/crc32"
+
+// DefaultMaglevTableSize 是 Maglev 查找表的默认大小。
+const DefaultMaglevTableSize = 65537
+
+// Maglev 实现 Google Maglev 负载均衡器的一致性哈希：每个节点按自己的
+// 排列轮流占据查找表中的位置，Get 只需查一次表。分布几乎完全均匀，
+// 增删节点时移动的键略多于最少的数量。每次成员变化都会重建查找表，
+// 开销与表的大小成正比。
+type Maglev struct {
+	hash  Hash
+	size  int
+	set   nodeSet
+	table []string // 为空表示没有节点
+}
+
+// NewMaglev 返回一个查找表大小为 size、使用哈希函数 fn 的 Maglev。
+// size 应该是远大于节点数的质数，如果不大于零，默认为
+// DefaultMaglevTableSize；不是质数时向上取到下一个质数，否则排列
+// 无法遍历整张表。如果 fn 为空，默认为 crc32.ChecksumIEEE。
+func NewMaglev(size int, fn Hash) *Maglev {
+	if size <= 0 {
+		size = DefaultMaglevTableSize
+	}
+	size = nextPrime(size)
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Maglev{hash: fn, size: size}
+}
+
+// IsEmpty 如果没有节点，则返回 true。
+func (m *Maglev) IsEmpty() bool {
+	return len(m.table) == 0
+}
+
+// AddWeighted 加入权重为 weight 的节点，或修改已有节点的权重。
+func (m *Maglev) AddWeighted(node string, weight int) []Range {
+	if m.set.add(node, weight) {
+		m.populate()
+	}
+	return nil
+}
+
+// Remove 移除节点。
+func (m *Maglev) Remove(node string) []Range {
+	if m.set.remove(node) {
+		m.populate()
+	}
+	return nil
+}
+
+// Weight 返回节点的权重，节点不存在时返回零。
+func (m *Maglev) Weight(node string) int {
+	return m.set.weights[node]
+}
+
+// populate 按 Maglev 论文中的算法重建查找表。
+// 权重为 w 的节点在每一轮中占据 w 个位置。
+func (m *Maglev) populate() {
+	nodes := m.set.nodes
+	if len(nodes) == 0 {
+		m.table = nil
+		return
+	}
+	offsets := make([]int, len(nodes))
+	skips := make([]int, len(nodes))
+	next := make([]int, len(nodes))
+	for i, node := range nodes {
+		h := hash64(m.hash, node)
+		offsets[i] = int(h % uint64(m.size))
+		skips[i] = int(mix64(h)%uint64(m.size-1)) + 1
+	}
+
+	table := make([]string, m.size)
+	filled := make([]bool, m.size)
+	for n := 0; ; {
+		for i, node := range nodes {
+			for w := 0; w < m.set.weights[node]; w++ {
+				c := (offsets[i] + next[i]*skips[i]) % m.size
+				for filled[c] {
+					next[i]++
+					c = (offsets[i] + next[i]*skips[i]) % m.size
+				}
+				table[c] = node
+				filled[c] = true
+				next[i]++
+				if n++; n == m.size {
+					m.table = table
+					return
+				}
+			}
+		}
+	}
+}
+
+// nextPrime 返回不小于 n 的最小质数。
+func nextPrime(n int) int {
+	if n <= 2 {
+		return 2
+	}
+	for ; ; n++ {
+		prime := true
+		for d := 2; d*d <= n; d++ {
+			if n%d == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
+
+// Get 返回键的所有者。
+func (m *Maglev) Get(key string) string {
+	if m.IsEmpty() {
+		return ""
+	}
+	return m.table[reduce(hash64(m.hash, key), m.size)]
+}
+
+// GetN 返回键的至多 n 个不同的节点：从键在查找表中的位置开始，
+// 依次取之后的位置上尚未出现的节点。
+func (m *Maglev) GetN(key string, n int) []string {
+	if n <= 0 || m.IsEmpty() {
+		return nil
+	}
+	if n > len(m.set.nodes) {
+		n = len(m.set.nodes)
+	}
+	idx := reduce(hash64(m.hash, key), m.size)
+	nodes := make([]string, 0, n)
+	for i := 0; i < m.size && len(nodes) < n; i++ {
+		if node := m.table[(idx+i)%m.size]; !contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
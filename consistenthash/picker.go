@@ -0,0 +1,134 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// Picker 是把键映射到节点的算法。*Map（哈希环）、*Rendezvous、
+// *Jump 和 *Maglev 都实现了它。
+//
+// 节点集合相同时，Get 的结果与节点加入的顺序无关，因此集群中
+// 各个节点对同一个键会选出同一个所有者。Picker 不是并发安全的。
+type Picker interface {
+	// IsEmpty 如果没有节点，则返回 true。
+	IsEmpty() bool
+
+	// Get 返回键的所有者，没有节点时返回 ""。
+	Get(key string) string
+
+	// GetN 返回键的至多 n 个不同的副本节点，按优先级排列，
+	// 第一个与 Get 返回的相同。
+	GetN(key string, n int) []string
+
+	// AddWeighted 加入权重为 weight 的节点，或修改已有节点的权重。
+	// weight 小于 1 时视为 1。只有 *Map 返回移动的区间，其他算法
+	// 移动的键不构成哈希区间，总是返回 nil。
+	AddWeighted(node string, weight int) []Range
+
+	// Remove 移除节点。返回值与 AddWeighted 相同。
+	Remove(node string) []Range
+
+	// Weight 返回节点的权重，节点不存在时返回零。
+	Weight(node string) int
+}
+
+var (
+	_ Picker = (*Map)(nil)
+	_ Picker = (*Rendezvous)(nil)
+	_ Picker = (*Jump)(nil)
+	_ Picker = (*Maglev)(nil)
+)
+
+// nodeSet 是按名称排序的节点及其权重，供不基于环的算法使用。
+type nodeSet struct {
+	nodes   []string // 已排序
+	weights map[string]int
+}
+
+// add 加入节点或修改其权重，并报告集合是否改变。
+func (s *nodeSet) add(node string, weight int) bool {
+	if weight < 1 {
+		weight = 1
+	}
+	if s.weights == nil {
+		s.weights = make(map[string]int)
+	}
+	old, ok := s.weights[node]
+	s.weights[node] = weight
+	if !ok {
+		i := sort.SearchStrings(s.nodes, node)
+		s.nodes = append(s.nodes, "")
+		copy(s.nodes[i+1:], s.nodes[i:])
+		s.nodes[i] = node
+		return true
+	}
+	return old != weight
+}
+
+// remove 移除节点，并报告集合是否改变。
+func (s *nodeSet) remove(node string) bool {
+	if _, ok := s.weights[node]; !ok {
+		return false
+	}
+	delete(s.weights, node)
+	i := sort.SearchStrings(s.nodes, node)
+	s.nodes = append(s.nodes[:i], s.nodes[i+1:]...)
+	return true
+}
+
+// contains 报告 nodes 中是否有 node。副本数很小，线性查找足够快。
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// mix64 是 splitmix64 的最终混合函数，把 32 位的哈希值和节点的
+// 种子扩散到 64 位。
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// hash64 返回 data 的 64 位哈希，高 32 位与低 32 位分别来自
+// fn 对 data 和对加盐的 data 的哈希。
+func hash64(fn Hash, data string) uint64 {
+	hi := fn([]byte(data))
+	lo := fn([]byte("\x00" + data))
+	return mix64(uint64(hi)<<32 | uint64(lo))
+}
+
+// unitFloat 把 64 位的哈希值映射到 (0, 1) 上均匀分布的浮点数。
+func unitFloat(h uint64) float64 {
+	return (float64(h>>11) + 0.5) / (1 << 53)
+}
+
+// reduce 把 h 均匀地映射到 [0, n)。
+func reduce(h uint64, n int) int {
+	hi, _ := bits.Mul64(h, uint64(n))
+	return int(hi)
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+var pickers = []struct {
+	name string
+	new  func() Picker
+}{
+	{"ring", func() Picker { return New(50, nil) }},
+	{"rendezvous", func() Picker { return NewRendezvous(nil) }},
+	{"jump", func() Picker { return NewJump(nil) }},
+	{"maglev", func() Picker { return NewMaglev(0, nil) }},
+}
+
+func addNodes(p Picker, n int) {
+	for i := 0; i < n; i++ {
+		p.AddWeighted("node-"+strconv.Itoa(i), 1)
+	}
+}
+
+func pick(p Picker, keys int) map[string]string {
+	owners := make(map[string]string, keys)
+	for i := 0; i < keys; i++ {
+		k := "key-" + strconv.Itoa(i)
+		owners[k] = p.Get(k)
+	}
+	return owners
+}
+
+// TestPickerOrder checks that every algorithm picks the same owners
+// regardless of the order in which nodes were added.
+func TestPickerOrder(t *testing.T) {
+	for _, tc := range pickers {
+		a, b := tc.new(), tc.new()
+		if !a.IsEmpty() || a.Get("k") != "" {
+			t.Errorf("%s: new picker not empty", tc.name)
+		}
+		for i := 0; i < 5; i++ {
+			a.AddWeighted("node-"+strconv.Itoa(i), 1+i%2)
+			b.AddWeighted("node-"+strconv.Itoa(4-i), 1+(4-i)%2)
+		}
+		if a.IsEmpty() || b.Weight("node-1") != 2 || b.Weight("missing") != 0 {
+			t.Errorf("%s: IsEmpty = %v, Weight(node-1) = %d", tc.name, a.IsEmpty(), b.Weight("node-1"))
+		}
+		oa, ob := pick(a, 1000), pick(b, 1000)
+		for k, v := range oa {
+			if ob[k] != v {
+				t.Errorf("%s: Get(%q) = %q and %q", tc.name, k, v, ob[k])
+				break
+			}
+		}
+	}
+}
+
+func TestPickerGetN(t *testing.T) {
+	for _, tc := range pickers {
+		p := tc.new()
+		if got := p.GetN("k", 2); len(got) != 0 {
+			t.Errorf("%s: GetN on an empty picker = %v", tc.name, got)
+		}
+		addNodes(p, 5)
+		for i := 0; i < 200; i++ {
+			key := "key-" + strconv.Itoa(i)
+			nodes := p.GetN(key, 3)
+			if len(nodes) != 3 || nodes[0] != p.Get(key) {
+				t.Fatalf("%s: GetN(%q, 3) = %v; want 3 nodes starting with %q", tc.name, key, nodes, p.Get(key))
+			}
+			if nodes[0] == nodes[1] || nodes[0] == nodes[2] || nodes[1] == nodes[2] {
+				t.Fatalf("%s: GetN(%q, 3) = %v; want distinct nodes", tc.name, key, nodes)
+			}
+		}
+		if got := p.GetN("k", 10); len(got) != 5 {
+			t.Errorf("%s: GetN(k, 10) = %v; want all 5 nodes", tc.name, got)
+		}
+	}
+}
+
+// TestPickerWeighted checks that a node with twice the weight gets about
+// twice the keys.
+func TestPickerWeighted(t *testing.T) {
+	for _, tc := range pickers {
+		if tc.name == "ring" {
+			continue // covered by TestWeighted
+		}
+		p := tc.new()
+		p.AddWeighted("a", 1)
+		p.AddWeighted("b", 2)
+		p.AddWeighted("c", 1)
+		counts := make(map[string]int)
+		for _, o := range pick(p, 20000) {
+			counts[o]++
+		}
+		if got := float64(counts["b"]) / 20000; got < 0.47 || got > 0.53 {
+			t.Errorf("%s: heavy node got %.3f of keys; want about 0.5", tc.name, got)
+		}
+	}
+}
+
+// TestPickerMovement checks that adding and then removing a node moves
+// about the minimum number of keys. Only the ring and rendezvous hashing
+// move keys solely to and from the new node; maglev moves a few keys between
+// other nodes, and jump hash may move keys between nodes sorted after it.
+func TestPickerMovement(t *testing.T) {
+	for _, tc := range pickers {
+		p := tc.new()
+		addNodes(p, 10)
+		before := pick(p, 10000)
+
+		p.AddWeighted("node-new", 1)
+		moved, stray := 0, 0
+		for k, v := range pick(p, 10000) {
+			if v != before[k] {
+				moved++
+				if v != "node-new" {
+					stray++
+				}
+			}
+		}
+		if frac := float64(moved) / 10000; frac < 0.05 || frac > 0.15 {
+			t.Errorf("%s: %.3f of keys moved; want about 1/11", tc.name, frac)
+		}
+		switch tc.name {
+		case "ring", "rendezvous":
+			if stray != 0 {
+				t.Errorf("%s: %d keys moved between existing nodes", tc.name, stray)
+			}
+		case "maglev":
+			if stray > 100 {
+				t.Errorf("%s: %d keys moved between existing nodes; want at most 1%%", tc.name, stray)
+			}
+		}
+
+		p.Remove("node-new")
+		for k, v := range pick(p, 10000) {
+			if v != before[k] {
+				t.Errorf("%s: %q owned by %q after remove; want %q", tc.name, k, v, before[k])
+				break
+			}
+		}
+		p.Remove("missing")
+	}
+}
+
+// TestJumpAppend checks that jump hash moves the minimum when the new node
+// sorts last.
+func TestJumpAppend(t *testing.T) {
+	p := NewJump(nil)
+	addNodes(p, 9)
+	before := pick(p, 10000)
+	p.AddWeighted("node-9", 1)
+	for k, v := range pick(p, 10000) {
+		if v != before[k] && v != "node-9" {
+			t.Fatalf("%q moved from %q to %q", k, before[k], v)
+		}
+	}
+}
+
+// TestMaglevSize checks that table sizes which are not prime are rounded up
+// so that every node's permutation covers the whole table.
+func TestMaglevSize(t *testing.T) {
+	for _, tc := range []struct{ size, want int }{
+		{1, 2},
+		{2, 2},
+		{1000, 1009},
+		{65537, 65537},
+	} {
+		m := NewMaglev(tc.size, nil)
+		if m.size != tc.want {
+			t.Errorf("NewMaglev(%d) size = %d; want %d", tc.size, m.size, tc.want)
+		}
+		addNodes(m, 3)
+		for k, v := range pick(m, 100) {
+			if v == "" {
+				t.Fatalf("NewMaglev(%d): Get(%q) is empty", tc.size, k)
+			}
+		}
+	}
+}
+
+func BenchmarkPickerGet(b *testing.B) {
+	for _, tc := range pickers {
+		for _, n := range []int{8, 32, 128} {
+			b.Run(fmt.Sprintf("%s/%d", tc.name, n), func(b *testing.B) {
+				p := tc.new()
+				addNodes(p, n)
+				keys := make([]string, 1024)
+				for i := range keys {
+					keys[i] = "key-" + strconv.Itoa(i)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					p.Get(keys[i&1023])
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkPickerDistribution reports the load of the busiest node relative
+// to the mean; 1 is a perfectly even spread.
+func BenchmarkPickerDistribution(b *testing.B) {
+	const keys = 100000
+	for _, tc := range pickers {
+		for _, n := range []int{8, 32, 128} {
+			b.Run(fmt.Sprintf("%s/%d", tc.name, n), func(b *testing.B) {
+				var ratio float64
+				for i := 0; i < b.N; i++ {
+					p := tc.new()
+					addNodes(p, n)
+					counts := make(map[string]int)
+					for _, o := range pick(p, keys) {
+						counts[o]++
+					}
+					max := 0
+					for _, c := range counts {
+						if c > max {
+							max = c
+						}
+					}
+					ratio = float64(max) * float64(n) / keys
+				}
+				b.ReportMetric(ratio, "max/mean")
+			})
+		}
+	}
+}
+
+// BenchmarkPickerMovement reports the fraction of keys that change owner
+// when a node is added to n nodes; 1/(n+1) is the minimum.
+func BenchmarkPickerMovement(b *testing.B) {
+	const keys = 100000
+	for _, tc := range pickers {
+		for _, n := range []int{8, 32, 128} {
+			b.Run(fmt.Sprintf("%s/%d", tc.name, n), func(b *testing.B) {
+				var frac float64
+				for i := 0; i < b.N; i++ {
+					p := tc.new()
+					addNodes(p, n)
+					before := pick(p, keys)
+					p.AddWeighted("node-new", 1)
+					moved := 0
+					for k, v := range pick(p, keys) {
+						if v != before[k] {
+							moved++
+						}
+					}
+					frac = float64(moved) / keys
+				}
+				b.ReportMetric(frac, "moved")
+				b.ReportMetric(frac*float64(n+1), "moved/min")
+			})
+		}
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import "sort"
+
+// Range 是环上的一段哈希区间 (Start, End]，其中的键的所有者
+// 在一次成员变化中从 From 变成了 To。Start > End 的区间跨过了
+// 环的零点；Start == End 的区间是整个环。
+type Range struct {
+	Start, End uint32
+	From, To   string
+}
+
+// Contains 报告哈希值 h 是否落在区间内。
+func (r Range) Contains(h uint32) bool {
+	switch {
+	case r.Start == r.End:
+		return true
+	case r.Start < r.End:
+		return r.Start < h && h <= r.End
+	default:
+		return h > r.Start || h <= r.End
+	}
+}
+
+// Hash 返回键在环上的哈希值，用于与 Range 比较。
+func (m *Map) Hash(key string) uint32 {
+	return m.hash([]byte(key))
+}
+
+// search 返回 keys 中第一个不小于 hash 的位置，超过末尾时回到第一个。
+// keys 不能为空。
+func search(keys []int, hash int) int {
+	idx := sort.SearchInts(keys, hash)
+	// 表示我们已循环回到第一个副本。
+	if idx == len(keys) {
+		idx = 0
+	}
+	return idx
+}
+
+// ringSnapshot 是成员变化前的环，用于计算移动的区间。
+type ringSnapshot struct {
+	keys   []int
+	owners []string // owners[i] 是 keys[i] 的所有者
+}
+
+func (m *Map) snapshot() ringSnapshot {
+	owners := make([]string, len(m.keys))
+	for i, hash := range m.keys {
+		owners[i] = m.hashMap[hash]
+	}
+	return ringSnapshot{keys: m.keys, owners: owners}
+}
+
+// movedSince 返回所有者与 before 中不同的区间，相邻且变化相同的
+// 区间被合并。环在变化前或变化后为空时返回 nil。
+func (m *Map) movedSince(before ringSnapshot) []Range {
+	if len(before.keys) == 0 || len(m.keys) == 0 {
+		return nil
+	}
+	// 新旧环的所有虚拟节点把环切成若干段，每段内的所有者在
+	// 两个环上各自不变。
+	points := mergeSorted(before.keys, m.keys)
+	n := 0
+	for i, p := range points {
+		if i == 0 || p != points[n-1] {
+			points[n] = p
+			n++
+		}
+	}
+	points = points[:n]
+
+	var moved []Range
+	for i, cur := range points {
+		prev := points[(i+len(points)-1)%len(points)]
+		from := before.owners[search(before.keys, cur)]
+		to := m.hashMap[m.keys[search(m.keys, cur)]]
+		if from == to {
+			continue
+		}
+		if last := len(moved) - 1; last >= 0 && moved[last].End == uint32(prev) &&
+			moved[last].From == from && moved[last].To == to {
+			moved[last].End = uint32(cur)
+			continue
+		}
+		moved = append(moved, Range{Start: uint32(prev), End: uint32(cur), From: from, To: to})
+	}
+	// 合并跨过零点的首尾两段。
+	if last := len(moved) - 1; last > 0 && moved[last].End == moved[0].Start &&
+		moved[last].From == moved[0].From && moved[last].To == moved[0].To {
+		moved[0].Start = moved[last].Start
+		moved = moved[:last]
+	}
+	return moved
+}
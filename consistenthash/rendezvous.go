@@ -0,0 +1,111 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import (
+	"hash/crc32"
+	"math"
+	"sort"
+)
+
+// Rendezvous 实现最高随机权重（HRW）哈希：键的所有者是对
+// (键, 节点) 的哈希打分最高的节点。键在节点间的分布与节点的
+// 权重严格成比例，增删节点时只有该节点得到或失去的键会移动，
+// 但每次 Get 需要为所有节点打分，开销与节点数成正比。
+type Rendezvous struct {
+	hash  Hash
+	set   nodeSet
+	seeds map[string]uint64 // 每个节点的哈希种子
+}
+
+// NewRendezvous 返回一个使用哈希函数 fn 的 Rendezvous。
+// 如果 fn 为空，默认为 crc32.ChecksumIEEE。
+func NewRendezvous(fn Hash) *Rendezvous {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Rendezvous{hash: fn, seeds: make(map[string]uint64)}
+}
+
+// IsEmpty 如果没有节点，则返回 true。
+func (r *Rendezvous) IsEmpty() bool {
+	return len(r.set.nodes) == 0
+}
+
+// AddWeighted 加入权重为 weight 的节点，或修改已有节点的权重。
+func (r *Rendezvous) AddWeighted(node string, weight int) []Range {
+	r.set.add(node, weight)
+	r.seeds[node] = hash64(r.hash, node)
+	return nil
+}
+
+// Remove 移除节点。
+func (r *Rendezvous) Remove(node string) []Range {
+	r.set.remove(node)
+	delete(r.seeds, node)
+	return nil
+}
+
+// Weight 返回节点的权重，节点不存在时返回零。
+func (r *Rendezvous) Weight(node string) int {
+	return r.set.weights[node]
+}
+
+// Get 返回键的所有者。
+func (r *Rendezvous) Get(key string) string {
+	kh := hash64(r.hash, key)
+	var (
+		best      string
+		bestScore = math.Inf(-1)
+	)
+	for _, node := range r.set.nodes {
+		if s := r.score(kh, node); s > bestScore {
+			best, bestScore = node, s
+		}
+	}
+	return best
+}
+
+// GetN 返回分数最高的至多 n 个节点，按分数从高到低排列。
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if n <= 0 || r.IsEmpty() {
+		return nil
+	}
+	kh := hash64(r.hash, key)
+	scores := make([]float64, len(r.set.nodes))
+	order := make([]int, len(r.set.nodes))
+	for i, node := range r.set.nodes {
+		scores[i] = r.score(kh, node)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if n > len(order) {
+		n = len(order)
+	}
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = r.set.nodes[order[i]]
+	}
+	return nodes
+}
+
+// score 是加权的 HRW 分数 -w/ln(u)，其中 u 是 (0, 1) 上的均匀哈希值。
+// 它使每个节点胜出的概率与其权重成正比。
+func (r *Rendezvous) score(keyHash uint64, node string) float64 {
+	u := unitFloat(mix64(keyHash ^ r.seeds[node]))
+	return -float64(r.set.weights[node]) / math.Log(u)
+}
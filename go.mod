@@ -1,10 +1,17 @@
 module github.com/golang/groupcache
 
-go 1.20
+go 1.21
 
-require github.com/golang/protobuf v1.5.4
+require (
+	github.com/golang/protobuf v1.5.4
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/net v0.9.0
+	google.golang.org/grpc v1.57.1
+	google.golang.org/protobuf v1.33.0
+)
 
 require (
-	github.com/mattn/go-sqlite3 v1.14.28 // indirect
-	google.golang.org/protobuf v1.33.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230525234030-28d5490b6b19 // indirect
 )
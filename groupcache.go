@@ -25,15 +25,15 @@ package groupcache
 import (
 	"context"
 	"errors"
-	"log"
-	"math/rand"
+	"fmt"
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	pb "github.com/golang/groupcache/groupcachepb"
 	"github.com/golang/groupcache/lru"
-	"github.com/golang/groupcache/singleflight"
+	"github.com/golang/protobuf/proto"
 )
 
 // Getter 为键加载数据。
@@ -41,8 +41,9 @@ type Getter interface {
 	// Get 返回由键标识的值，并填充 dest。
 	//
 	// 返回的数据必须是无版本的。也就是说，键必须
-	// 唯一描述加载的数据，而不隐含当前时间，
-	// 也不依赖缓存过期机制。
+	// 唯一描述加载的数据，而不隐含当前时间。
+	// 会变化的数据应通过 Sink 的 *WithExpiry 方法
+	// 设置过期时间，过期后的条目被视为未命中。
 	Get(ctx context.Context, key string, dest Sink) error
 }
 
@@ -53,21 +54,55 @@ func (f GetterFunc) Get(ctx context.Context, key string, dest Sink) error {
 	return f(ctx, key, dest)
 }
 
-var (
-	mu     sync.RWMutex
-	groups = make(map[string]*Group)
+// ErrNotFound 表示键在后端数据源中不存在。
+//
+// Getter 可以返回 ErrNotFound（或用 fmt.Errorf 的 %w 包装它的错误），
+// 所有者会在 mainCache 中短暂缓存这个否定结果，在此期间对该键的
+// 请求直接返回 ErrNotFound，而不再调用 Getter。调用者应使用
+// errors.Is 判断该错误，对等体返回的也是同一个错误。
+var ErrNotFound = errors.New("groupcache: not found")
 
-	initPeerServerOnce sync.Once
-	initPeerServer     func()
-)
+// ErrGroupClosed 由已经关闭的组的加载操作返回。
+var ErrGroupClosed = errors.New("groupcache: group closed")
+
+// getterError 包装组的 Getter 或 Setter 返回的错误，使对等体的服务端
+// 能把数据源的故障与自身的错误区分开。返回给组的调用者之前，
+// 包装由 callerError 去掉。
+type getterError struct {
+	err error
+}
+
+func (e getterError) Error() string { return e.err.Error() }
+func (e getterError) Unwrap() error { return e.err }
+
+// callerError 去掉 err 的 getterError 包装，
+// 使调用者得到 Getter 或 Setter 原本返回的错误。
+func callerError(err error) error {
+	if ge, ok := err.(getterError); ok {
+		return ge.err
+	}
+	return err
+}
+
+// Setter 将值写入后端数据源。
+//
+// Getter 可以选择实现 Setter，以支持 Group.Set 的写穿透：
+// 键的所有者先调用 Set 持久化该值，再用它更新 mainCache。
+type Setter interface {
+	Set(ctx context.Context, key string, value []byte) error
+}
 
 // GetGroup 返回之前用 NewGroup 创建的命名组，
 // 如果没有这样的组，则返回 nil。
+//
+// 它在 DefaultRegistry 中查找组。
 func GetGroup(name string) *Group {
-	mu.RLock()
-	g := groups[name]
-	mu.RUnlock()
-	return g
+	return DefaultRegistry.GetGroup(name)
+}
+
+// Groups 返回 DefaultRegistry 中所有的组，按名称排序。
+func Groups() []*Group {
+	return DefaultRegistry.Groups()
 }
 
 // NewGroup 从 Getter 创建一个协调的组感知 Getter。
@@ -76,71 +111,128 @@ func GetGroup(name string) *Group {
 // 一次只运行一个 Get 调用。本地进程和其他进程中的并发调用者
 // 一旦原始 Get 完成，就会收到答案的副本。
 //
-// 组名对每个 getter 必须是唯一的。
+// 组名对每个 getter 必须是唯一的。组注册在 DefaultRegistry 中。
 func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
-	return newGroup(name, cacheBytes, getter, nil)
+	return NewGroupOpts(name, cacheBytes, getter, nil)
+}
+
+// GroupOptions 是 Group 的配置。
+type GroupOptions struct {
+	// NotFoundTTL 指定 Getter 返回 ErrNotFound 时，否定结果在
+	// mainCache 中保留的时间。如果为零，默认为 5 秒；
+	// 如果为负数，则不缓存否定结果。
+	NotFoundTTL time.Duration
+
+	// Policy 指定 mainCache 和 hotCache 的淘汰策略。
+	// 如果为空，默认为 LRUPolicy。
+	Policy PolicyFunc
+
+	// HotKeyQPS 指定值从对等体取得后被镜像到 hotCache 所需的、
+	// 由所有者报告的该键最近一分钟的每秒请求数。对等体没有报告
+	// 请求率时，改为要求本节点自身的请求率达到该值。
+	// 如果为零，默认为 1；如果为负数，则不填充 hotCache。
+	HotKeyQPS float64
+
+	// HotKeyLocalQPS 指定镜像到 hotCache 所需的、本节点自身对该键
+	// 最近一分钟的每秒请求数，使集群中很热但本节点很少访问的键
+	// 不占用本地内存。如果为零，默认为 HotKeyQPS 的十分之一。
+	HotKeyLocalQPS float64
+
+	// CacheShards 指定 mainCache 和 hotCache 各自的分片数，向上取整到
+	// 2 的幂。每个分片有自己的锁和淘汰策略，分片越多，并发 Get 的
+	// 锁竞争越少，但淘汰顺序越偏离全局的策略顺序。
+	// 如果为零，默认为 runtime.GOMAXPROCS(0)；需要严格按策略顺序
+	// 淘汰时设为 1，所有操作共用一把锁。
+	CacheShards int
+
+	// Logger 指定组记录加载、填充和清除等事件使用的 Logger。
+	// 如果为空，使用通过 SetLogger 设置的包级别 Logger。
+	Logger Logger
+
+	// Tracer 指定组创建跟踪 span 使用的 Tracer。
+	// 如果为空，使用通过 SetTracer 设置的包级别 Tracer。
+	Tracer Tracer
+
+	// ReplicationFactor 指定每个键的副本数。大于 1 且 PeerPicker
+	// 实现了 ReplicaPicker 时，所有者加载失败后依次尝试其余副本，
+	// 最后才本地加载；作为副本的节点把键保存在 mainCache 中。
+	// 如果为零或一，只从所有者加载。
+	ReplicationFactor int
+
+	// CacheCodec 如果不为空，不小于 CompressMinBytes 的值以压缩的形式
+	// 保存在 mainCache 和 hotCache 中，按压缩后的大小计入 cacheBytes，
+	// 读取时才解压。压缩没有使值变小时保存原值。
+	CacheCodec Codec
+
+	// CompressMinBytes 指定 CacheCodec 压缩的值的最小字节数。
+	// 如果为零，默认为 512。
+	CompressMinBytes int
+
+	// MaxValueBytes 如果大于零，限制 Getter 设置的值的字节数，超过时
+	// 加载失败，返回 ErrValueTooLarge。通过 SetReader 设置的值在超过
+	// 限制时立即停止读取，不会整个读入内存。
+	MaxValueBytes int64
+
+	// HandoffBytesPerSecond 如果大于零，启用键的交接：PeerPicker 的
+	// 成员变化后（参见 Registry.PeersChanged），组在后台把 mainCache 中
+	// 改由其他对等体保存的键推送给新的所有者，并从本地清除，每秒至多
+	// 推送这么多字节的值，使扩容时新节点不必从数据源重新加载这些键。
+	// 集群中的所有节点必须支持 Handoff 请求。
+	HandoffBytesPerSecond int64
+}
+
+// NewGroupOpts 与 NewGroup 相同，但使用给定的选项创建组。
+func NewGroupOpts(name string, cacheBytes int64, getter Getter, o *GroupOptions) *Group {
+	return DefaultRegistry.NewGroupOpts(name, cacheBytes, getter, o)
 }
 
 // 如果 peers 为 nil，则通过 sync.Once 调用 peerPicker 来初始化它。
 func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *Group {
-	if getter == nil {
-		panic("nil Getter")
-	}
-	mu.Lock()
-	defer mu.Unlock()
-	initPeerServerOnce.Do(callInitPeerServer)
-	if _, dup := groups[name]; dup {
-		panic("duplicate registration of group " + name)
-	}
-	g := &Group{
-		name:       name,
-		getter:     getter,
-		peers:      peers,
-		cacheBytes: cacheBytes,
-		loadGroup:  &singleflight.Group{},
-		mainCache:  cache{cacheName: "main"},
-		hotCache:   cache{cacheName: "hot"},
-	}
-	if fn := newGroupHook; fn != nil {
-		fn(g)
-	}
-	groups[name] = g
-	return g
+	return DefaultRegistry.newGroup(name, cacheBytes, getter, peers, nil)
+}
+
+func newGroupOpts(name string, cacheBytes int64, getter Getter, peers PeerPicker, o *GroupOptions) *Group {
+	return DefaultRegistry.newGroup(name, cacheBytes, getter, peers, o)
 }
 
-// newGroupHook，如果非 nil，会在创建新组后立即被调用。
-var newGroupHook func(*Group)
+const (
+	defaultNotFoundTTL = 5 * time.Second
+	defaultHotKeyQPS   = 1.0
+)
+
+// DeregisterGroup 关闭并注销 DefaultRegistry 中的命名组，
+// 参见 Group.Close。如果没有这样的组，则返回 false。
+func DeregisterGroup(name string) bool {
+	return DefaultRegistry.DeregisterGroup(name)
+}
 
 // RegisterNewGroupHook 注册一个在每次创建组时运行的钩子。
 func RegisterNewGroupHook(fn func(*Group)) {
-	if newGroupHook != nil {
-		panic("RegisterNewGroupHook called more than once")
-	}
-	newGroupHook = fn
+	DefaultRegistry.RegisterNewGroupHook(fn)
 }
 
 // RegisterServerStart 注册一个在创建第一个组时运行的钩子。
 func RegisterServerStart(fn func()) {
-	if initPeerServer != nil {
-		panic("RegisterServerStart called more than once")
-	}
-	initPeerServer = fn
-}
-
-func callInitPeerServer() {
-	if initPeerServer != nil {
-		initPeerServer()
-	}
+	DefaultRegistry.RegisterServerStart(fn)
 }
 
 // Group 是一个缓存命名空间和相关数据，加载并分布在
 // 一组 1 个或多个机器上。
 type Group struct {
 	name       string
+	registry   *Registry // 组所在的注册表
 	getter     Getter
 	peersOnce  sync.Once
 	peers      PeerPicker
-	cacheBytes int64 // mainCache 和 hotCache 大小总和的限制
+	cacheBytes atomic.Int64 // mainCache 和 hotCache 大小总和的限制
+	opts       GroupOptions
+
+	// closeMu 保护 closed 和 handoff，并保证 Close 开始等待后
+	// 不会再有新的加载加入 inflight。
+	closeMu  sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup // 进行中的加载
+	handoff  handoffState   // 后台进行中的交接
 
 	// mainCache 是那些本进程（在其对等体中）
 	// 具有权威性的键的缓存。也就是说，该缓存
@@ -161,14 +253,20 @@ type Group struct {
 	// 调用者的数量如何。
 	loadGroup flightGroup
 
+	// rates 估计每个键的请求率。作为所有者时通过 minute_qps
+	// 报告给对等体，作为调用者时用于决定是否填充 hotCache。
+	rates keyRates
+
 	_ int32 // 强制 Stats 在 32 位平台上按 8 字节对齐
 
 	// Stats 是组的统计信息。
 	Stats Stats
 
-	// rand 仅在测试时非 nil，
-	// 用于在 TestPeers 中获取可预测的结果。
-	rand *rand.Rand
+	// localLatency 是本地调用 Getter 的延迟直方图。
+	localLatency latencyHistogram
+
+	// peerStats 按对等体名称记录发出的请求，值为 *peerStats。
+	peerStats sync.Map
 }
 
 // flightGroup 被定义为一个接口，flightgroup.Group
@@ -185,11 +283,14 @@ type Stats struct {
 	CacheHits      AtomicInt `json:"cache_hits"` // 任一缓存命中
 	PeerLoads      AtomicInt `json:"peer_loads"` // 远程加载或远程缓存命中（非错误）
 	PeerErrors     AtomicInt `json:"peer_errors"`
+	FailoverLoads  AtomicInt `json:"failover_loads"`  // 所有者失败后从其他副本成功加载
+	HedgedLoads    AtomicInt `json:"hedged_loads"`    // 发出的对冲请求
 	Loads          AtomicInt `json:"loads"`           // (gets - cacheHits)
 	LoadsDeduped   AtomicInt `json:"loads_deduped"`   // 在 singleflight 后
 	LocalLoads     AtomicInt `json:"local_loads"`     // 总成功本地加载
 	LocalLoadErrs  AtomicInt `json:"local_load_errs"` // 总失败本地加载
 	ServerRequests AtomicInt `json:"server_requests"` // 通过网络从对等体来的 gets
+	HandoffKeys    AtomicInt `json:"handoff_keys"`    // 成员变化后交给新所有者的键
 }
 
 // Name 返回组的名称。
@@ -199,21 +300,34 @@ func (g *Group) Name() string {
 
 func (g *Group) initPeers() {
 	if g.peers == nil {
-		g.peers = getPeers(g.name)
+		g.peers = g.registry.getPeers(g.name)
 	}
 }
 
 func (g *Group) Get(ctx context.Context, key string, dest Sink) error {
+	return callerError(g.get(ctx, key, dest))
+}
+
+// get 与 Get 相同，但保留 Getter 错误的 getterError 包装。
+func (g *Group) get(ctx context.Context, key string, dest Sink) (err error) {
 	g.peersOnce.Do(g.initPeers)
 	g.Stats.Gets.Add(1)
-	log.Printf("[Group %s] 请求键 \"%s\"", g.name, key)
+	g.rates.record(key, time.Now())
 	if dest == nil {
 		return errors.New("groupcache: nil dest Sink")
 	}
+	ctx, span := g.startSpan(ctx, "groupcache.Get")
+	defer func() { endSpan(span, err) }()
 	value, cacheHit := g.lookupCache(key)
+	if spanRecording(span) {
+		span.SetAttributes("key", key, "cache_hit", cacheHit)
+	}
 
 	if cacheHit {
 		g.Stats.CacheHits.Add(1)
+		if value.notFound {
+			return ErrNotFound
+		}
 		return setSinkView(dest, value)
 	}
 
@@ -222,50 +336,91 @@ func (g *Group) Get(ctx context.Context, key string, dest Sink) error {
 	// （如果是本地的）将设置这个；失败者不会。
 	// 常见情况可能是一个调用者。
 	destPopulated := false
-	value, destPopulated, err := g.load(ctx, key, dest)
+	value, destPopulated, err = g.load(ctx, key, dest)
 	if err != nil {
 		return err
 	}
 	if destPopulated {
-		log.Printf("[Group %s] 请求处理完成，通过 dest 返回数据给键 \"%s\"", g.name, key)
 		return nil
 	}
-	log.Printf("[Group %s] 请求处理完成，通过 setSinkView 返回数据给键 \"%s\"", g.name, key)
 	return setSinkView(dest, value)
 }
 
 // load 通过本地调用 getter 或将其发送到另一台机器来加载键。
 func (g *Group) load(ctx context.Context, key string, dest Sink) (value ByteView, destPopulated bool, err error) {
+	return g.loadWith(ctx, key, dest, nil)
+}
+
+// loadWith 与 load 相同，但当键的所有者是 batch 的对等体时，
+// 从 batch 的批量请求中取得结果，而不是单独请求该对等体。
+func (g *Group) loadWith(ctx context.Context, key string, dest Sink, batch *getMultiBatch) (value ByteView, destPopulated bool, err error) {
+	if !g.startLoad() {
+		return ByteView{}, false, ErrGroupClosed
+	}
+	defer g.inflight.Done()
 	g.Stats.Loads.Add(1)
-	log.Printf(" 远程加载(\"%s\")-请求合并", key)
+	ctx, span := g.startSpan(ctx, "groupcache.load", "key", key)
+	leader := false
+	defer func() {
+		// 等待其他调用者的加载结果的 span 是被去重的。
+		span.SetAttributes("deduplicated", !leader)
+		endSpan(span, err)
+	}()
 	viewi, err := g.loadGroup.Do(key, func() (interface{}, error) {
+		leader = true
 		g.Stats.LoadsDeduped.Add(1)
-		var value ByteView
-		var err error
-		if peer, ok := g.peers.PickPeer(key); ok {
-			log.Printf("[Group %s] 责任节点为远程", g.name)
-			value, err = g.getFromPeer(ctx, peer, key)
-			if err == nil {
+		peers, replica := g.pickPeers(key)
+		for i := 0; i < len(peers); i++ {
+			peer := peers[i]
+			if g.debugEnabled() {
+				g.logger().Debug("从对等体加载", "group", g.name, "key", key, "peer", peerName(peer), "replica", i)
+			}
+			var alt ProtoGetter // 对冲请求的目标，为 nil 时本地加载
+			if i+1 < len(peers) {
+				alt = peers[i+1]
+			}
+			var r loadResult
+			hedged := false
+			if i == 0 && batch != nil && batch.peer == peer {
+				r.value, r.err = batch.get(ctx, g, key, replica)
+				r.peer = peer
+			} else {
+				r, hedged = g.getFromPeerHedged(ctx, peer, alt, key, replica)
+			}
+			if r.peer == nil {
+				// 作为对冲的本地加载先返回了结果。
+				if r.err != nil {
+					return nil, r.err
+				}
+				return r.value, nil
+			}
+			if r.err == nil {
 				g.Stats.PeerLoads.Add(1)
-				return value, nil
+				if r.peer != peers[0] {
+					g.Stats.FailoverLoads.Add(1)
+				}
+				return r.value, nil
+			}
+			if errors.Is(r.err, ErrNotFound) {
+				// 副本确认键不存在，不必再从其他地方加载。
+				g.Stats.PeerLoads.Add(1)
+				return nil, r.err
+			}
+			g.peerLoadFailed(key, r.peer, r.err)
+			if hedged {
+				// 对冲请求也已失败，不再重复尝试它。
+				if alt == nil {
+					return nil, r.err
+				}
+				i++
 			}
-			g.Stats.PeerErrors.Add(1)
-			log.Printf("[Group %s] 从远程节点获取失败: %v", g.name, err)
-		} else {
-			log.Printf("[Group %s] 责任节点为本地", g.name)
 		}
 
-		log.Printf("调用Getter获取源数据")
-		value, err = g.getLocally(ctx, key, dest)
+		value, err := g.loadLocally(ctx, key, dest)
 		if err != nil {
-			g.Stats.LocalLoadErrs.Add(1)
-			log.Printf("Getter获取源数据失败: %v", err)
 			return nil, err
 		}
-		g.Stats.LocalLoads.Add(1)
 		destPopulated = true // 只有一个 load 的调用者得到这个返回值
-		log.Printf("数据源返回数据，键 \"%s\", 大小: %d bytes", key, value.Len())
-		g.populateCache(key, value, &g.mainCache)
 		return value, nil
 	})
 	if err == nil {
@@ -274,70 +429,587 @@ func (g *Group) load(ctx context.Context, key string, dest Sink) (value ByteView
 	return
 }
 
+// pickPeers 返回依次尝试从中加载键的对等体，以及本节点是否是键的
+// 副本。本节点是副本时，只返回优先级在它之前的对等体，它们都失败后
+// 由本节点加载。
+func (g *Group) pickPeers(key string) (peers []ProtoGetter, replica bool) {
+	if rp, ok := g.peers.(ReplicaPicker); ok && g.opts.ReplicationFactor > 1 {
+		for _, peer := range rp.PickPeers(key, g.opts.ReplicationFactor) {
+			if peer == nil {
+				return peers, true
+			}
+			peers = append(peers, peer)
+		}
+		return peers, false
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []ProtoGetter{peer}, false
+	}
+	return nil, true
+}
+
+// loadLocally 调用 Getter 加载键，记录统计信息并把结果填充到 mainCache。
+func (g *Group) loadLocally(ctx context.Context, key string, dest Sink) (ByteView, error) {
+	start := time.Now()
+	value, err := g.getLocally(ctx, key, dest)
+	g.localLatency.observe(time.Since(start))
+	if err != nil {
+		if ctx.Err() != nil && !errors.Is(err, ErrNotFound) {
+			// 加载已被取消，例如落败的对冲请求，不算作失败。
+			return ByteView{}, err
+		}
+		g.Stats.LocalLoadErrs.Add(1)
+		if errors.Is(err, ErrNotFound) {
+			if g.debugEnabled() {
+				g.logger().Debug("键不存在", "group", g.name, "key", key)
+			}
+			if g.opts.NotFoundTTL > 0 {
+				g.populateCache(key, ByteView{e: time.Now().Add(g.opts.NotFoundTTL), notFound: true}, &g.mainCache)
+			}
+		} else {
+			g.logger().Warn("本地加载失败", "group", g.name, "key", key, "err", err)
+		}
+		return ByteView{}, err
+	}
+	g.Stats.LocalLoads.Add(1)
+	if g.debugEnabled() {
+		g.logger().Debug("本地加载完成", "group", g.name, "key", key, "bytes", value.Len())
+	}
+	g.populateCache(key, value, &g.mainCache)
+	return value, nil
+}
+
+// peerLoadFailed 记录一次失败的对等体加载。
+func (g *Group) peerLoadFailed(key string, peer ProtoGetter, err error) {
+	g.Stats.PeerErrors.Add(1)
+	g.logger().Warn("从对等体加载失败", "group", g.name, "key", key, "peer", peerName(peer), "err", err)
+}
+
 func (g *Group) getLocally(ctx context.Context, key string, dest Sink) (ByteView, error) {
+	ctx, span := g.startSpan(ctx, "groupcache.getLocally", "key", key)
+	if g.opts.MaxValueBytes > 0 {
+		dest = &limitSink{Sink: dest, max: g.opts.MaxValueBytes}
+	}
 	err := g.getter.Get(ctx, key, dest)
+	endSpan(span, err)
 	if err != nil {
-		return ByteView{}, err
+		return ByteView{}, getterError{err}
 	}
 	return dest.view()
 }
 
-func (g *Group) getFromPeer(ctx context.Context, peer ProtoGetter, key string) (ByteView, error) {
+// getFromPeer 从对等体取得键的值。replica 为 true 表示本节点也是键的
+// 副本，值保存到 mainCache，而不是按热度镜像到 hotCache。
+func (g *Group) getFromPeer(ctx context.Context, peer ProtoGetter, key string, replica bool) (ByteView, error) {
 	req := &pb.GetRequest{
 		Group: &g.name,
 		Key:   &key,
 	}
 	res := &pb.GetResponse{}
+	ctx, span := g.startSpan(ctx, "groupcache.getFromPeer", "key", key, "peer", peerName(peer))
+	start := time.Now()
 	err := peer.Get(ctx, req, res)
+	g.observePeer(peer, start, err)
+	endSpan(span, err)
 	if err != nil {
 		return ByteView{}, err
 	}
 	value := ByteView{b: res.Value}
-	// TODO(bradfitz): 使用 res.MinuteQps 或其他智能方式
-	// 有条件地填充 hotCache。现在只是在一定
-	// 百分比的情况下这样做。
-	var pop bool
-	if g.rand != nil {
-		pop = g.rand.Intn(10) == 0
-	} else {
-		pop = rand.Intn(10) == 0
+	if res.Expire != nil {
+		value.e = time.Unix(0, res.GetExpire())
+	}
+	g.keepFromPeer(key, value, res.MinuteQps, replica)
+	return value, nil
+}
+
+// keepFromPeer 缓存从对等体取得的值：本节点是副本时保存到 mainCache，
+// 否则由 maybePopulateHot 决定是否镜像到 hotCache。
+func (g *Group) keepFromPeer(key string, value ByteView, ownerQPS *float64, replica bool) {
+	if replica {
+		g.populateCache(key, value, &g.mainCache)
+		return
+	}
+	g.maybePopulateHot(key, value, ownerQPS)
+}
+
+// maybePopulateHot 决定是否将从对等体取得的值镜像到 hotCache。
+// ownerQPS 是所有者报告的请求率，对等体没有报告时为 nil。
+func (g *Group) maybePopulateHot(key string, value ByteView, ownerQPS *float64) {
+	hotQPS := g.opts.HotKeyQPS
+	if hotQPS < 0 {
+		return
+	}
+	localQPS := g.rates.rate(key, time.Now())
+	if ownerQPS == nil {
+		if localQPS < hotQPS {
+			return
+		}
+	} else if *ownerQPS < hotQPS || localQPS < g.opts.HotKeyLocalQPS {
+		return
+	}
+	g.populateCache(key, value, &g.hotCache)
+}
+
+// GetMulti 获取多个键，并将值分别填充到对应的 dests 中。
+//
+// 缓存未命中的键按 PeerPicker 选出的所有者分组，每个对等体
+// 只收到一次批量请求；每个键仍各自经过 singleflight 去重，
+// 因此与并发的 Get 调用共享同一次加载。
+//
+// 返回的错误切片与 keys 一一对应，nil 表示该键获取成功。
+func (g *Group) GetMulti(ctx context.Context, keys []string, dests []Sink) []error {
+	g.peersOnce.Do(g.initPeers)
+	errs := make([]error, len(keys))
+	if len(dests) != len(keys) {
+		for i := range errs {
+			errs[i] = errors.New("groupcache: GetMulti keys and dests length mismatch")
+		}
+		return errs
+	}
+	ctx, span := g.startSpan(ctx, "groupcache.GetMulti", "keys", len(keys))
+	defer span.End()
+
+	var (
+		wg      sync.WaitGroup
+		batches = make(map[ProtoGetter]*getMultiBatch)
+	)
+	type pending struct {
+		i     int
+		batch *getMultiBatch
+	}
+	var misses []pending
+	now := time.Now()
+	for i, key := range keys {
+		g.Stats.Gets.Add(1)
+		g.rates.record(key, now)
+		if dests[i] == nil {
+			errs[i] = errors.New("groupcache: nil dest Sink")
+			continue
+		}
+		if value, cacheHit := g.lookupCache(key); cacheHit {
+			g.Stats.CacheHits.Add(1)
+			if value.notFound {
+				errs[i] = ErrNotFound
+			} else {
+				errs[i] = setSinkView(dests[i], value)
+			}
+			continue
+		}
+		// 不支持批量请求的对等体的键由 loadWith 逐个 Get。
+		var batch *getMultiBatch
+		if peer, ok := g.peers.PickPeer(key); ok {
+			if mg, ok := peer.(MultiGetter); ok {
+				batch = batches[peer]
+				if batch == nil {
+					batch = &getMultiBatch{peer: peer, multi: mg, seen: make(map[string]bool)}
+					batches[peer] = batch
+				}
+				batch.add(key)
+			}
+		}
+		misses = append(misses, pending{i, batch})
+	}
+
+	for _, m := range misses {
+		wg.Add(1)
+		go func(i int, batch *getMultiBatch) {
+			defer wg.Done()
+			value, destPopulated, err := g.loadWith(ctx, keys[i], dests[i], batch)
+			if err == nil && !destPopulated {
+				err = setSinkView(dests[i], value)
+			}
+			errs[i] = callerError(err)
+		}(m.i, m.batch)
+	}
+	wg.Wait()
+	return errs
+}
+
+// serveGet 处理来自对等体的 Get 请求，并构造响应。
+// 响应带上值的过期时间，以便调用者在填充 hotCache 时遵守所有者的期限；
+// 键不存在时返回带 not_found 标记的响应，而不是错误。
+func (g *Group) serveGet(ctx context.Context, key string) (*pb.GetResponse, error) {
+	value, qps, _, err := g.serveGetView(ctx, key, nil)
+	if errors.Is(err, ErrNotFound) {
+		return &pb.GetResponse{NotFound: proto.Bool(true)}, nil
 	}
-	if pop {
-		g.populateCache(key, value, &g.hotCache)
+	if err != nil {
+		return nil, err
+	}
+	res := &pb.GetResponse{
+		Value:     value.ByteSlice(),
+		MinuteQps: proto.Float64(qps),
+	}
+	if e := value.Expire(); !e.IsZero() {
+		res.Expire = proto.Int64(e.UnixNano())
+	}
+	return res, nil
+}
+
+// serveGetView 处理来自对等体的 Get 请求，返回值的视图和该键最近
+// 一分钟的请求率，值可以直接从缓存写到响应中。缓存中的值已经用
+// 对等体接受的 accept 压缩时，原样返回压缩的值，并返回 accept；
+// 否则返回解压的值和 nil。
+func (g *Group) serveGetView(ctx context.Context, key string, accept Codec) (value ByteView, qps float64, codec Codec, err error) {
+	g.Stats.ServerRequests.Add(1)
+	if err = g.get(ctx, key, &encodedSink{byteViewSink{dst: &value}}); err != nil {
+		return ByteView{}, 0, nil, err
 	}
+	if value.codec != nil {
+		if accept != nil && value.codec.Name() == accept.Name() {
+			codec = accept
+		} else if value, err = value.decode(); err != nil {
+			return ByteView{}, 0, nil, err
+		}
+	}
+	return value, g.rates.rate(key, time.Now()), codec, nil
+}
+
+// encodedSink 是保留缓存中压缩的视图的 ByteViewSink。
+type encodedSink struct {
+	byteViewSink
+}
+
+func (s *encodedSink) setEncodedView(v ByteView) error {
+	*s.dst = v
+	return nil
+}
+
+// serveGetMulti 处理来自对等体的 GetMulti 请求，每个键的结果单独报告。
+func (g *Group) serveGetMulti(ctx context.Context, keys []string) *pb.GetMultiResponse {
+	g.Stats.ServerRequests.Add(int64(len(keys)))
+	values := make([]ByteView, len(keys))
+	dests := make([]Sink, len(keys))
+	for i := range keys {
+		dests[i] = ByteViewSink(&values[i])
+	}
+	errs := g.GetMulti(ctx, keys, dests)
+
+	res := &pb.GetMultiResponse{Results: make([]*pb.GetMultiResult, len(keys))}
+	now := time.Now()
+	for i, key := range keys {
+		result := &pb.GetMultiResult{Key: proto.String(key)}
+		if errors.Is(errs[i], ErrNotFound) {
+			result.NotFound = proto.Bool(true)
+		} else if errs[i] != nil {
+			result.Error = proto.String(errs[i].Error())
+		} else {
+			result.Value = values[i].ByteSlice()
+			result.MinuteQps = proto.Float64(g.rates.rate(key, now))
+			if e := values[i].Expire(); !e.IsZero() {
+				result.Expire = proto.Int64(e.UnixNano())
+			}
+		}
+		res.Results[i] = result
+	}
+	return res
+}
+
+// getMultiBatch 是 GetMulti 中发往同一个对等体的一批键。
+// 第一个需要结果的加载会发出批量请求，其余的加载等待并共享其结果。
+type getMultiBatch struct {
+	peer  ProtoGetter
+	multi MultiGetter // 与 peer 是同一个对等体
+	keys  []string
+	seen  map[string]bool
+
+	once    sync.Once
+	results map[string]*pb.GetMultiResult
+	err     error
+}
+
+func (b *getMultiBatch) add(key string) {
+	if !b.seen[key] {
+		b.seen[key] = true
+		b.keys = append(b.keys, key)
+	}
+}
+
+// get 返回键在批量响应中的值，必要时先发出批量请求。
+// replica 与 getFromPeer 的相同。
+func (b *getMultiBatch) get(ctx context.Context, g *Group, key string, replica bool) (ByteView, error) {
+	b.once.Do(func() {
+		req := &pb.GetMultiRequest{
+			Group: &g.name,
+			Keys:  b.keys,
+		}
+		res := &pb.GetMultiResponse{}
+		ctx, span := g.startSpan(ctx, "groupcache.getFromPeer", "keys", len(b.keys), "peer", peerName(b.peer))
+		start := time.Now()
+		b.err = b.multi.GetMulti(ctx, req, res)
+		g.observePeer(b.peer, start, b.err)
+		endSpan(span, b.err)
+		if b.err != nil {
+			return
+		}
+		b.results = make(map[string]*pb.GetMultiResult, len(res.Results))
+		for _, r := range res.Results {
+			b.results[r.GetKey()] = r
+		}
+	})
+	if b.err != nil {
+		return ByteView{}, b.err
+	}
+	r, ok := b.results[key]
+	if !ok {
+		return ByteView{}, errors.New("groupcache: peer returned no result for key " + key)
+	}
+	if r.GetNotFound() {
+		return ByteView{}, ErrNotFound
+	}
+	if r.Error != nil {
+		return ByteView{}, errors.New(r.GetError())
+	}
+	value := ByteView{b: r.Value}
+	if r.Expire != nil {
+		value.e = time.Unix(0, r.GetExpire())
+	}
+	g.keepFromPeer(key, value, r.MinuteQps, replica)
 	return value, nil
 }
 
+// Remove 在整个集群中清除键。它先让 PeerPicker 选出的所有者
+// 清除 mainCache 中的键，再清除本地缓存，最后广播到 PeerLister
+// 列出的其余所有对等体，使它们的 hotCache 也丢弃该键。
+//
+// 所有者清除失败时 Remove 立即返回错误；广播失败的对等体的
+// 错误会合并后返回，但不影响其他对等体。
+func (g *Group) Remove(ctx context.Context, key string) error {
+	g.peersOnce.Do(g.initPeers)
+	owner, ok := g.peers.PickPeer(key)
+	if ok {
+		if err := g.removeFromPeer(ctx, owner, key); err != nil {
+			return err
+		}
+	}
+	g.localRemove(key)
+	return g.broadcastRemove(ctx, key, owner)
+}
+
+// Set 将键的值写穿到后端数据源，并更新集群中的缓存。
+// 写入被发送到键真正的所有者（PeerPicker 实现了 OwnerPicker 时由
+// PickOwner 选出），所有者调用其 Getter 实现的 Setter 并更新
+// mainCache；随后其余对等体上的缓存副本会被清除。所有者不可用时
+// 返回错误，而不是写入其他节点。如果所有者的 Getter 没有实现
+// Setter，或者所有者没有实现 SetterPeer，也返回错误。
+func (g *Group) Set(ctx context.Context, key string, value []byte) error {
+	g.peersOnce.Do(g.initPeers)
+	owner, ok := g.pickOwner(key)
+	if ok {
+		sp, ok := owner.(SetterPeer)
+		if !ok {
+			return fmt.Errorf("groupcache: peer %s does not support Set: %w", peerName(owner), errors.ErrUnsupported)
+		}
+		req := &pb.SetRequest{
+			Group: &g.name,
+			Key:   &key,
+			Value: value,
+		}
+		if err := sp.Set(ctx, req); err != nil {
+			return err
+		}
+		// 作为副本或交接前的所有者，本节点的 mainCache 也可能持有该键。
+		g.localRemove(key)
+	} else if err := g.localSet(ctx, key, value); err != nil {
+		return callerError(err)
+	}
+	return g.broadcastRemove(ctx, key, owner)
+}
+
+// pickOwner 返回键真正的所有者；PeerPicker 没有实现 OwnerPicker 时
+// 退回到 PickPeer。
+func (g *Group) pickOwner(key string) (ProtoGetter, bool) {
+	if op, ok := g.peers.(OwnerPicker); ok {
+		return op.PickOwner(key)
+	}
+	return g.peers.PickPeer(key)
+}
+
+// localSet 作为键的所有者写穿该值并更新 mainCache。
+func (g *Group) localSet(ctx context.Context, key string, value []byte) error {
+	if !g.startLoad() {
+		return ErrGroupClosed
+	}
+	defer g.inflight.Done()
+	setter, ok := g.getter.(Setter)
+	if !ok {
+		return errors.New("groupcache: getter of group " + g.name + " does not implement Setter")
+	}
+	if err := setter.Set(ctx, key, value); err != nil {
+		return getterError{err}
+	}
+	g.hotCache.remove(key)
+	g.populateCache(key, ByteView{b: cloneBytes(value)}, &g.mainCache)
+	return nil
+}
+
+// broadcastRemove 并发地让除 skip（可以为 nil）以外的所有实现了
+// Remover 的对等体清除键，并合并返回失败对等体的错误。PeerPicker
+// 没有实现 PeerLister 时不广播。
+func (g *Group) broadcastRemove(ctx context.Context, key string, skip ProtoGetter) error {
+	pl, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, peer := range pl.GetAll() {
+		if _, ok := peer.(Remover); !ok || (skip != nil && peer == skip) {
+			continue
+		}
+		wg.Add(1)
+		go func(peer ProtoGetter) {
+			defer wg.Done()
+			if err := g.removeFromPeer(ctx, peer, key); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(peer)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// removeFromPeer 让 peer 清除键。peer 没有实现 Remover 时返回错误。
+func (g *Group) removeFromPeer(ctx context.Context, peer ProtoGetter, key string) error {
+	r, ok := peer.(Remover)
+	if !ok {
+		return fmt.Errorf("groupcache: peer %s does not support Remove: %w", peerName(peer), errors.ErrUnsupported)
+	}
+	req := &pb.RemoveRequest{
+		Group: &g.name,
+		Key:   &key,
+	}
+	return r.Remove(ctx, req)
+}
+
+// startLoad 将一次加载登记为进行中，使 Close 能够等待它完成。
+// 如果组已经关闭，则返回 false；否则调用者必须在完成后调用 g.inflight.Done。
+func (g *Group) startLoad() bool {
+	g.closeMu.Lock()
+	defer g.closeMu.Unlock()
+	if g.closed {
+		return false
+	}
+	g.inflight.Add(1)
+	return true
+}
+
+// Close 从组所在的注册表中注销组，等待进行中的加载完成，
+// 然后释放 mainCache 和 hotCache 占用的内存。
+//
+// 关闭后，组的加载返回 ErrGroupClosed，对等体对该组的请求
+// 得到 404，同名的组可以重新创建。重复调用 Close 没有效果。
+func (g *Group) Close() error {
+	g.registry.deregister(g)
+	g.closeMu.Lock()
+	if g.closed {
+		g.closeMu.Unlock()
+		return nil
+	}
+	g.closed = true
+	h := g.handoff
+	g.closeMu.Unlock()
+
+	h.stop()
+	g.inflight.Wait()
+	g.mainCache.clear()
+	g.hotCache.clear()
+	g.logger().Info("组已关闭", "group", g.name)
+	return nil
+}
+
+// CacheBytes 返回组当前的缓存大小限制。
+func (g *Group) CacheBytes() int64 {
+	return g.cacheBytes.Load()
+}
+
+// SetCacheBytes 在运行时调整 mainCache 和 hotCache 大小总和的限制。
+// 缩小限制时会立即淘汰多余的条目；限制小于等于零时禁用缓存，
+// 并清空两个缓存。
+func (g *Group) SetCacheBytes(n int64) {
+	g.cacheBytes.Store(n)
+	if n <= 0 {
+		g.mainCache.clear()
+		g.hotCache.clear()
+		return
+	}
+	g.evict()
+}
+
+// localRemove 从本进程的 mainCache 和 hotCache 中清除键。
+func (g *Group) localRemove(key string) {
+	if g.cacheBytes.Load() <= 0 {
+		return
+	}
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	if g.debugEnabled() {
+		g.logger().Debug("本地清除", "group", g.name, "key", key)
+	}
+}
+
 func (g *Group) lookupCache(key string) (value ByteView, ok bool) {
-	if g.cacheBytes <= 0 {
+	if g.cacheBytes.Load() <= 0 {
 		return
 	}
 	value, ok = g.mainCache.get(key)
 	if ok {
-		log.Printf("[Group %s] 本地缓存命中(\"%s\")", g.name, key)
 		return
 	}
 	value, ok = g.hotCache.get(key)
-	if ok {
-		log.Printf("[Group %s] 本地热点缓存命中(\"%s\")", g.name, key)
-		return
-	}
-	log.Printf("[Group %s] 本地缓存未命中(\"%s\")", g.name, key)
 	return
 }
 
 func (g *Group) populateCache(key string, value ByteView, cache *cache) {
-	if g.cacheBytes <= 0 {
+	if g.cacheBytes.Load() <= 0 || value.expired(time.Now()) {
 		return
 	}
-	cache.add(key, value)
-	log.Printf("[Group %s] populateCache(\"%s\", %d bytes) - 填充 %s 缓存", g.name, key, value.Len(), cache.name())
+	cache.add(key, g.cacheView(value))
+	if g.debugEnabled() {
+		g.logger().Debug("填充缓存", "group", g.name, "key", key, "cache", cache.name(), "bytes", value.Len())
+	}
 
 	// 如有必要，从缓存中淘汰项目。
+	g.evict()
+}
+
+// cacheView 返回保存到缓存中的视图：设置了 CacheCodec 时压缩足够大的值。
+func (g *Group) cacheView(value ByteView) ByteView {
+	if c := g.opts.CacheCodec; c != nil && value.codec == nil && !value.notFound && value.Len() >= g.opts.CompressMinBytes {
+		return value.encode(c)
+	}
+	return value
+}
+
+// addOwned 把来自其他节点或快照的条目加入 mainCache，并报告是否加入。
+// 只加入按当前的 PeerPicker 由本节点保存的、在 now 时刻未过期且不在
+// 缓存中的键，不覆盖本节点自己加载的值。held 报告本节点是否保存该键，
+// 即它被加入或者原本就在 mainCache 中。
+func (g *Group) addOwned(key string, value ByteView, now time.Time) (added, held bool) {
+	if g.cacheBytes.Load() <= 0 || value.expired(now) {
+		return false, false
+	}
+	if _, replica := g.pickPeers(key); !replica {
+		return false, false
+	}
+	if !g.mainCache.addIfAbsent(key, g.cacheView(value)) {
+		return false, true
+	}
+	g.evict()
+	return true, true
+}
+
+// evict 从缓存中淘汰项目，直到总大小不超过限制。
+func (g *Group) evict() {
 	for {
 		mainBytes := g.mainCache.bytes()
 		hotBytes := g.hotCache.bytes()
-		if mainBytes+hotBytes <= g.cacheBytes {
+		if mainBytes+hotBytes <= g.cacheBytes.Load() || mainBytes+hotBytes == 0 {
 			return
 		}
 
@@ -375,15 +1047,28 @@ func (g *Group) CacheStats(which CacheType) CacheStats {
 	}
 }
 
-// cache 是 *lru.Cache 的包装器，它增加了同步功能，
-// 使值始终为 ByteView，并计算所有键和值的大小。
+// cache 按键的哈希把条目分布到若干个独立的 cacheShard 上，
+// 使落在不同分片上的 Get 不会竞争同一把锁。各分片分别执行淘汰策略，
+// 因此分片多于一个时，淘汰顺序只是全局顺序的近似。
 type cache struct {
-	mu         sync.RWMutex
-	nbytes     int64 // 所有键和值的总大小
-	lru        *lru.Cache
-	nhit, nget int64
-	nevict     int64  // 淘汰次数
-	cacheName  string // for logging
+	cacheName string // for logging
+	shards    []cacheShard
+	nbytes    atomic.Int64  // 所有分片中键和值的总大小
+	next      atomic.Uint32 // removeOldest 下一次轮询的分片
+}
+
+// init 创建 shards 个分片，分片数向上取整到 2 的幂，至少为 1。
+func (c *cache) init(name string, shards int, newPolicy PolicyFunc) {
+	n := 1
+	for n < shards {
+		n *= 2
+	}
+	c.cacheName = name
+	c.shards = make([]cacheShard, n)
+	for i := range c.shards {
+		c.shards[i].newPolicy = newPolicy
+		c.shards[i].total = &c.nbytes
+	}
 }
 
 func (c *cache) name() string {
@@ -393,9 +1078,118 @@ func (c *cache) name() string {
 	return c.cacheName
 }
 
+// shard 返回键所在的分片，使用 FNV-1a 哈希以避免分配。
+func (c *cache) shard(key string) *cacheShard {
+	if len(c.shards) == 1 {
+		return &c.shards[0]
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &c.shards[h&uint32(len(c.shards)-1)]
+}
+
 func (c *cache) stats() CacheStats {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	var st CacheStats
+	for i := range c.shards {
+		s := c.shards[i].stats()
+		st.Bytes += s.Bytes
+		st.Items += s.Items
+		st.Gets += s.Gets
+		st.Hits += s.Hits
+		st.Evictions += s.Evictions
+	}
+	return st
+}
+
+func (c *cache) add(key string, value ByteView) {
+	c.shard(key).add(key, value)
+}
+
+func (c *cache) get(key string) (value ByteView, ok bool) {
+	return c.shard(key).get(key)
+}
+
+func (c *cache) remove(key string) {
+	c.shard(key).remove(key)
+}
+
+// clear 丢弃所有条目，释放它们占用的内存。
+func (c *cache) clear() {
+	for i := range c.shards {
+		c.shards[i].clear()
+	}
+}
+
+// entries 返回所有分片中未过期的条目，每个分片内大致按淘汰的先后
+// 顺序排列。策略没有实现 RangePolicy 时返回错误。
+func (c *cache) entries() ([]cacheEntry, error) {
+	var all []cacheEntry
+	for i := range c.shards {
+		var err error
+		if all, err = c.shards[i].appendEntries(all); err != nil {
+			return nil, err
+		}
+	}
+	return all, nil
+}
+
+// cacheEntry 是缓存中的一个键及其值。
+type cacheEntry struct {
+	key   string
+	value ByteView
+}
+
+// addIfAbsent 在键不在缓存中时加入它，并报告是否加入了。
+func (c *cache) addIfAbsent(key string, value ByteView) bool {
+	return c.shard(key).addIfAbsent(key, value)
+}
+
+// removeOldest 从下一个非空分片中按策略淘汰一个条目。
+func (c *cache) removeOldest() {
+	n := uint32(len(c.shards))
+	for i := uint32(0); i < n; i++ {
+		if c.shards[c.next.Add(1)%n].removeOldest() {
+			return
+		}
+	}
+}
+
+func (c *cache) bytes() int64 {
+	return c.nbytes.Load()
+}
+
+func (c *cache) items() int64 {
+	var n int64
+	for i := range c.shards {
+		n += c.shards[i].items()
+	}
+	return n
+}
+
+// cacheShard 是 EvictionPolicy 的包装器，它增加了同步功能，
+// 使值始终为 ByteView，并计算所有键和值的大小。
+type cacheShard struct {
+	mu         sync.Mutex
+	nbytes     int64         // 本分片所有键和值的总大小
+	total      *atomic.Int64 // 所属 cache 的总大小，与 nbytes 同步更新
+	lru        EvictionPolicy
+	newPolicy  PolicyFunc // 创建 lru；为 nil 时使用 LRUPolicy
+	nhit, nget int64
+	nevict     int64 // 淘汰次数，包括过期和显式清除
+}
+
+// addBytes 调整本分片和所属 cache 的大小。调用者必须持有 c.mu。
+func (c *cacheShard) addBytes(n int64) {
+	c.nbytes += n
+	c.total.Add(n)
+}
+
+func (c *cacheShard) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return CacheStats{
 		Bytes:     c.nbytes,
 		Items:     c.itemsLocked(),
@@ -405,23 +1199,79 @@ func (c *cache) stats() CacheStats {
 	}
 }
 
-func (c *cache) add(key string, value ByteView) {
+func (c *cacheShard) add(key string, value ByteView) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.addLocked(key, value)
+}
+
+// addLocked 加入或覆盖一个条目。调用者必须持有 c.mu。
+func (c *cacheShard) addLocked(key string, value ByteView) {
 	if c.lru == nil {
-		c.lru = &lru.Cache{
-			OnEvicted: func(key lru.Key, value interface{}) {
-				val := value.(ByteView)
-				c.nbytes -= int64(len(key.(string))) + int64(val.Len())
-				c.nevict++
-			},
+		newPolicy := c.newPolicy
+		if newPolicy == nil {
+			newPolicy = LRUPolicy
 		}
+		c.lru = newPolicy(func(key lru.Key, value interface{}) {
+			val := value.(ByteView)
+			c.addBytes(-int64(len(key.(string))) - int64(val.Len()))
+			c.nevict++
+		})
+	}
+	if old, ok := c.peekLocked(key); ok {
+		// 覆盖已有条目时，先扣除旧值的大小。
+		c.addBytes(-int64(old.(ByteView).Len()))
+	} else {
+		c.addBytes(int64(len(key)))
 	}
 	c.lru.Add(key, value)
-	c.nbytes += int64(len(key)) + int64(value.Len())
+	c.addBytes(int64(value.Len()))
 }
 
-func (c *cache) get(key string) (value ByteView, ok bool) {
+func (c *cacheShard) addIfAbsent(key string, value ByteView) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		if _, ok := c.peekLocked(key); ok {
+			return false
+		}
+	}
+	c.addLocked(key, value)
+	return true
+}
+
+// peekLocked 检查键是否在缓存中，策略实现了 PeekPolicy 时不把这次
+// 检查当作访问。调用者必须持有 c.mu，c.lru 不能为空。
+func (c *cacheShard) peekLocked(key string) (value interface{}, ok bool) {
+	if p, ok := c.lru.(PeekPolicy); ok {
+		return p.Peek(key)
+	}
+	return c.lru.Get(key)
+}
+
+// appendEntries 把本分片未过期的条目追加到 all。遍历在持有锁时只
+// 复制条目，调用者可以在不持有锁时处理它们。
+func (c *cacheShard) appendEntries(all []cacheEntry) ([]cacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return all, nil
+	}
+	rp, ok := c.lru.(RangePolicy)
+	if !ok {
+		return nil, errors.New("groupcache: eviction policy does not implement RangePolicy")
+	}
+	now := time.Now()
+	rp.Range(func(key lru.Key, value interface{}) bool {
+		if v := value.(ByteView); !v.expired(now) {
+			all = append(all, cacheEntry{key.(string), v})
+		}
+		return true
+	})
+	return all, nil
+}
+
+func (c *cacheShard) get(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.nget++
@@ -432,31 +1282,49 @@ func (c *cache) get(key string) (value ByteView, ok bool) {
 	if !ok {
 		return
 	}
+	value = vi.(ByteView)
+	if value.expired(time.Now()) {
+		// 过期条目视为未命中，并立即释放其空间。
+		c.lru.Remove(key)
+		return ByteView{}, false
+	}
 	c.nhit++
-	return vi.(ByteView), true
+	return value, true
 }
 
-func (c *cache) removeOldest() {
+func (c *cacheShard) remove(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.lru != nil {
-		c.lru.RemoveOldest()
+		c.lru.Remove(key)
 	}
 }
 
-func (c *cache) bytes() int64 {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.nbytes
+func (c *cacheShard) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru = nil
+	c.addBytes(-c.nbytes)
 }
 
-func (c *cache) items() int64 {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// removeOldest 淘汰一个条目，分片为空时返回 false。
+func (c *cacheShard) removeOldest() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil || c.lru.Len() == 0 {
+		return false
+	}
+	c.lru.RemoveOldest()
+	return true
+}
+
+func (c *cacheShard) items() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.itemsLocked()
 }
 
-func (c *cache) itemsLocked() int64 {
+func (c *cacheShard) itemsLocked() int64 {
 	if c.lru == nil {
 		return 0
 	}
@@ -23,8 +23,10 @@ import (
 	"errors"
 	"fmt"
 	"hash/crc32"
-	"math/rand"
 	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -59,13 +61,14 @@ const (
 )
 
 func testSetup() {
-	stringGroup = NewGroup(stringGroupName, cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+	// TestCacheEviction relies on a single LRU order over the whole cache.
+	stringGroup = NewGroupOpts(stringGroupName, cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
 		if key == fromChan {
 			key = <-stringc
 		}
 		cacheFills.Add(1)
 		return dest.SetString("ECHO:" + key)
-	}))
+	}), &GroupOptions{CacheShards: 1})
 
 	protoGroup = NewGroup(protoGroupName, cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
 		if key == fromChan {
@@ -203,7 +206,7 @@ func TestCacheEviction(t *testing.T) {
 	}
 
 	g := stringGroup.(*Group)
-	evict0 := g.mainCache.nevict
+	evict0 := g.mainCache.stats().Evictions
 
 	// Trash the cache with other keys.
 	var bytesFlooded int64
@@ -214,7 +217,7 @@ func TestCacheEviction(t *testing.T) {
 		stringGroup.Get(dummyCtx, key, StringSink(&res))
 		bytesFlooded += int64(len(key) + len(res))
 	}
-	evicts := g.mainCache.nevict - evict0
+	evicts := g.mainCache.stats().Evictions - evict0
 	if evicts <= 0 {
 		t.Errorf("evicts = %v; want more than 0", evicts)
 	}
@@ -227,8 +230,12 @@ func TestCacheEviction(t *testing.T) {
 }
 
 type fakePeer struct {
-	hits int
-	fail bool
+	hits    int
+	removes int
+	sets    int
+	multis  int
+	fail    bool
+	qps     *float64 // reported as minute_qps, if set
 }
 
 func (p *fakePeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
@@ -236,7 +243,55 @@ func (p *fakePeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse
 	if p.fail {
 		return errors.New("simulated error from peer")
 	}
+	if strings.HasPrefix(in.GetKey(), "missing") {
+		return ErrNotFound
+	}
 	out.Value = []byte("got:" + in.GetKey())
+	out.MinuteQps = p.qps
+	return nil
+}
+
+func (p *fakePeer) Remove(_ context.Context, in *pb.RemoveRequest) error {
+	p.removes++
+	if p.fail {
+		return errors.New("simulated error from peer")
+	}
+	return nil
+}
+
+func (p *fakePeer) Set(_ context.Context, in *pb.SetRequest) error {
+	p.sets++
+	if p.fail {
+		return errors.New("simulated error from peer")
+	}
+	return nil
+}
+
+func (p *fakePeer) GetMulti(_ context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	p.multis++
+	if p.fail {
+		return errors.New("simulated error from peer")
+	}
+	for _, key := range in.GetKeys() {
+		r := &pb.GetMultiResult{Key: proto.String(key)}
+		if strings.HasPrefix(key, "bad") {
+			r.Error = proto.String("simulated error for " + key)
+		} else {
+			r.Value = []byte("got:" + key)
+		}
+		out.Results = append(out.Results, r)
+	}
+	return nil
+}
+
+func (p *fakePeer) Handoff(_ context.Context, in *pb.HandoffRequest, out *pb.HandoffResponse) error {
+	if p.fail {
+		return errors.New("simulated error from peer")
+	}
+	out.Accepted = proto.Int64(int64(len(in.GetEntries())))
+	for _, e := range in.GetEntries() {
+		out.Keys = append(out.Keys, e.GetKey())
+	}
 	return nil
 }
 
@@ -250,6 +305,19 @@ func (p fakePeers) PickPeer(key string) (peer ProtoGetter, ok bool) {
 	return p[n], p[n] != nil
 }
 
+// listingPeers is a fakePeers that also implements PeerLister.
+type listingPeers struct{ fakePeers }
+
+func (p listingPeers) GetAll() []ProtoGetter {
+	var peers []ProtoGetter
+	for _, peer := range p.fakePeers {
+		if peer != nil {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
 // TestPeers tests that peers (virtual, in-process) are hit, and how much.
 func TestPeers(t *testing.T) {
 	once.Do(testSetup)
@@ -264,7 +332,6 @@ func TestPeers(t *testing.T) {
 		return dest.SetString("got:" + key)
 	}
 	testGroup := newGroup("TestPeers-group", cacheSize, GetterFunc(getter), peerList)
-	testGroup.rand = rand.New(rand.NewSource(123))
 	run := func(name string, n int, wantSummary string) {
 		// Reset counters
 		localHits = 0
@@ -294,18 +361,19 @@ func TestPeers(t *testing.T) {
 	}
 	resetCacheSize := func(maxBytes int64) {
 		g := testGroup
-		g.cacheBytes = maxBytes
-		g.mainCache = cache{}
-		g.hotCache = cache{}
+		g.cacheBytes.Store(maxBytes)
+		g.mainCache.clear()
+		g.hotCache.clear()
 	}
 
 	// Base case; peers all up, with no problems.
 	resetCacheSize(1 << 20)
 	run("base", 200, "localHits = 49, peers = 51 49 51")
 
-	// Verify cache was hit.  All localHits are gone, and some of
-	// the peer hits (the ones randomly selected to be maybe hot)
-	run("cached_base", 200, "localHits = 0, peers = 49 47 48")
+	// Verify cache was hit.  All localHits are gone, and the peer
+	// hits remain because no key is requested often enough to be
+	// mirrored in the hotCache.
+	run("cached_base", 200, "localHits = 0, peers = 51 49 51")
 	resetCacheSize(0)
 
 	// With one of the peers being down.
@@ -322,6 +390,77 @@ func TestPeers(t *testing.T) {
 	run("peer0_failing", 200, "localHits = 100, peers = 51 49 51")
 }
 
+func TestHotCachePromotion(t *testing.T) {
+	peer0 := &fakePeer{}
+	g := newGroup("TestHotCachePromotion-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("local getter called")
+	}), fakePeers([]ProtoGetter{peer0}))
+	get := func(key string, n int) {
+		for i := 0; i < n; i++ {
+			var s string
+			if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	hot := func(key string) bool {
+		_, ok := g.hotCache.get(key)
+		return ok
+	}
+
+	// A key the owner reports as hot is mirrored once this process has
+	// asked for it often enough itself: 6 requests a minute reach the
+	// default local threshold of 0.1 QPS.
+	qps := 5.0
+	peer0.qps = &qps
+	get("hot", 5)
+	if hot("hot") {
+		t.Fatal("hot key mirrored before reaching the local threshold")
+	}
+	get("hot", 1)
+	if !hot("hot") {
+		t.Fatal("hot key not mirrored after reaching both thresholds")
+	}
+	hits := peer0.hits
+	get("hot", 10)
+	if peer0.hits != hits {
+		t.Errorf("owner hit %d more times after the key was mirrored", peer0.hits-hits)
+	}
+
+	// A key that is cold at the owner is never mirrored.
+	qps = 0.5
+	get("cold", 20)
+	if hot("cold") {
+		t.Error("key the owner reports as cold was mirrored")
+	}
+
+	// Without a reported rate, the local rate alone must reach HotKeyQPS.
+	peer0.qps = nil
+	get("unreported", 59)
+	if hot("unreported") {
+		t.Error("unreported key mirrored below HotKeyQPS")
+	}
+	get("unreported", 1)
+	if !hot("unreported") {
+		t.Error("unreported key not mirrored at HotKeyQPS")
+	}
+
+	// The owner reports its own view of the key's rate.
+	owner := newGroup("TestHotCachePromotion-owner", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	}), NoPeers{})
+	var res *pb.GetResponse
+	for i := 0; i < 3; i++ {
+		var err error
+		if res, err = owner.serveGet(dummyCtx, "k"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := res.GetMinuteQps(), 3.0/60; got < want {
+		t.Errorf("owner reported minute_qps = %v; want at least %v", got, want)
+	}
+}
+
 func TestTruncatingByteSliceTarget(t *testing.T) {
 	var buf [100]byte
 	s := buf[:]
@@ -440,8 +579,603 @@ func TestNoDedup(t *testing.T) {
 	// upon entry, we would increment nbytes twice but the entry would
 	// only be in the cache once.
 	const wantBytes = int64(len(testkey) + len(testval))
-	if g.mainCache.nbytes != wantBytes {
-		t.Errorf("cache has %d bytes, want %d", g.mainCache.nbytes, wantBytes)
+	if b := g.mainCache.bytes(); b != wantBytes {
+		t.Errorf("cache has %d bytes, want %d", b, wantBytes)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	var fills AtomicInt
+	g := newGroup("TestExpiry-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		fills.Add(1)
+		return dest.SetStringWithExpiry("ECHO:"+key, time.Now().Add(ttl))
+	}), nil)
+
+	get := func() {
+		var s string
+		if err := g.Get(dummyCtx, "key", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if s != "ECHO:key" {
+			t.Fatalf("got %q; want %q", s, "ECHO:key")
+		}
+	}
+	get()
+	get()
+	if n := fills.Get(); n != 1 {
+		t.Fatalf("fills = %d before expiry; want 1", n)
+	}
+	time.Sleep(2 * ttl)
+	get()
+	if n := fills.Get(); n != 2 {
+		t.Fatalf("fills = %d after expiry; want 2", n)
+	}
+	if items := g.mainCache.items(); items != 1 {
+		t.Errorf("mainCache has %d items, want 1", items)
+	}
+}
+
+func TestSinkExpiry(t *testing.T) {
+	e := time.Now().Add(time.Hour)
+	var s string
+	var v ByteView
+	var b []byte
+	for _, sink := range []Sink{StringSink(&s), ByteViewSink(&v), AllocatingByteSliceSink(&b)} {
+		if err := setSinkView(sink, ByteView{s: "value", e: e}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := sink.view()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Expire().Equal(e) {
+			t.Errorf("%T: Expire = %v; want %v", sink, got.Expire(), e)
+		}
+	}
+}
+
+type expiringPeer struct {
+	expire time.Time
+}
+
+func (p *expiringPeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	out.Value = []byte("got:" + in.GetKey())
+	out.Expire = proto.Int64(p.expire.UnixNano())
+	return nil
+}
+
+func (p *expiringPeer) Remove(context.Context, *pb.RemoveRequest) error { return nil }
+func (p *expiringPeer) Set(context.Context, *pb.SetRequest) error       { return nil }
+func (p *expiringPeer) GetMulti(context.Context, *pb.GetMultiRequest, *pb.GetMultiResponse) error {
+	return errors.New("unimplemented")
+}
+func (p *expiringPeer) Handoff(context.Context, *pb.HandoffRequest, *pb.HandoffResponse) error {
+	return errors.New("unimplemented")
+}
+
+func TestPeerExpiry(t *testing.T) {
+	e := time.Now().Add(50 * time.Millisecond)
+	peer := &expiringPeer{expire: e}
+	g := newGroup("TestPeerExpiry-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("unexpected local load")
+	}), fakePeers([]ProtoGetter{peer}))
+
+	value, err := g.getFromPeer(dummyCtx, peer, "key", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !value.Expire().Equal(time.Unix(0, e.UnixNano())) {
+		t.Fatalf("Expire = %v; want %v", value.Expire(), e)
+	}
+	g.populateCache("key", value, &g.hotCache)
+	if _, ok := g.lookupCache("key"); !ok {
+		t.Fatal("hotCache miss before expiry")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := g.lookupCache("key"); ok {
+		t.Fatal("hotCache hit after the owner's expiry")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	peer0 := &fakePeer{}
+	peer1 := &fakePeer{}
+	peerList := listingPeers{fakePeers{peer0, peer1, nil}}
+	var fills AtomicInt
+	g := newGroup("TestRemove-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		fills.Add(1)
+		return dest.SetString("ECHO:" + key)
+	}), peerList)
+
+	// Find a key owned by this process so that it lands in mainCache.
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key-%d", i)
+		if _, ok := peerList.PickPeer(key); !ok {
+			break
+		}
+	}
+	var s string
+	if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	g.populateCache("hot-key", ByteView{s: "hot"}, &g.hotCache)
+
+	if err := g.Remove(dummyCtx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.lookupCache(key); ok {
+		t.Errorf("key %q still cached after Remove", key)
+	}
+	if peer0.removes != 1 || peer1.removes != 1 {
+		t.Errorf("peer removes = %d %d; want 1 1", peer0.removes, peer1.removes)
+	}
+	if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if n := fills.Get(); n != 2 {
+		t.Errorf("fills = %d; want 2 after Remove", n)
+	}
+
+	// Removing a key owned by a peer reaches the owner once, the
+	// other peer once, and drops the local hotCache copy.
+	var hotKey string
+	for i := 0; ; i++ {
+		hotKey = fmt.Sprintf("hot-key-%d", i)
+		if peer, ok := peerList.PickPeer(hotKey); ok && peer == peer0 {
+			break
+		}
+	}
+	g.populateCache(hotKey, ByteView{s: "hot"}, &g.hotCache)
+	peer0.removes, peer1.removes = 0, 0
+	if err := g.Remove(dummyCtx, hotKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.lookupCache(hotKey); ok {
+		t.Errorf("key %q still in hotCache after Remove", hotKey)
+	}
+	if peer0.removes != 1 || peer1.removes != 1 {
+		t.Errorf("peer removes = %d %d; want 1 1", peer0.removes, peer1.removes)
+	}
+
+	// A failing owner aborts the removal.
+	peer0.fail = true
+	if err := g.Remove(dummyCtx, hotKey); err == nil {
+		t.Error("Remove succeeded with a failing owner")
+	}
+
+	// A PeerPicker that cannot list its peers gets no broadcast.
+	peer0.fail = false
+	peer0.removes, peer1.removes = 0, 0
+	g.peers = peerList.fakePeers
+	if err := g.Remove(dummyCtx, key); err != nil || peer0.removes != 0 || peer1.removes != 0 {
+		t.Errorf("Remove without a PeerLister = %v with removes %d %d; want no broadcast", err, peer0.removes, peer1.removes)
+	}
+}
+
+// mapStore is a Getter and Setter backed by a map.
+type mapStore struct {
+	mu    sync.Mutex
+	m     map[string]string
+	gets  int
+	fails bool
+}
+
+func (s *mapStore) Get(_ context.Context, key string, dest Sink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gets++
+	return dest.SetString(s.m[key])
+}
+
+func (s *mapStore) Set(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails {
+		return errors.New("simulated write error")
+	}
+	s.m[key] = string(value)
+	return nil
+}
+
+func TestSet(t *testing.T) {
+	peer0 := &fakePeer{}
+	peer1 := &fakePeer{}
+	peerList := listingPeers{fakePeers{peer0, peer1, nil}}
+	store := &mapStore{m: map[string]string{}}
+	g := newGroup("TestSet-group", cacheSize, store, peerList)
+
+	keyOwnedBy := func(want ProtoGetter) string {
+		for i := 0; ; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			if peer, _ := peerList.PickPeer(key); peer == want {
+				return key
+			}
+		}
+	}
+
+	// A locally owned key is written through and cached in mainCache.
+	key := keyOwnedBy(nil)
+	if err := g.Set(dummyCtx, key, []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if store.m[key] != "v1" {
+		t.Errorf("store[%q] = %q; want %q", key, store.m[key], "v1")
+	}
+	var s string
+	if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "v1" || store.gets != 0 {
+		t.Errorf("Get = %q with %d store gets; want %q from mainCache", s, store.gets, "v1")
+	}
+	if peer0.removes != 1 || peer1.removes != 1 {
+		t.Errorf("peer removes = %d %d; want 1 1", peer0.removes, peer1.removes)
+	}
+
+	// A remotely owned key goes to its owner, the other peer's hotCache
+	// copy is invalidated, and so is a local mainCache copy left by
+	// replication or handoff.
+	key = keyOwnedBy(peer0)
+	g.populateCache(key, ByteView{s: "stale"}, &g.mainCache)
+	g.populateCache(key, ByteView{s: "stale"}, &g.hotCache)
+	peer0.removes, peer1.removes = 0, 0
+	if err := g.Set(dummyCtx, key, []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if peer0.sets != 1 || peer0.removes != 0 || peer1.removes != 1 {
+		t.Errorf("owner sets = %d, removes = %d %d; want 1, 0 1", peer0.sets, peer0.removes, peer1.removes)
+	}
+	if _, ok := g.lookupCache(key); ok {
+		t.Errorf("stale copy of %q survived Set", key)
+	}
+
+	// Write errors are reported and leave the cache untouched.
+	key = keyOwnedBy(nil)
+	store.fails = true
+	if err := g.Set(dummyCtx, key, []byte("v3")); err == nil {
+		t.Error("Set succeeded with a failing Setter")
+	}
+	if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil || s != "v1" {
+		t.Errorf("Get = %q, %v; want %q", s, err, "v1")
+	}
+
+	// Groups whose Getter is not a Setter refuse writes.
+	ro := newGroup("TestSet-readonly", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	}), nil)
+	if err := ro.Set(dummyCtx, "key", []byte("v")); err == nil {
+		t.Error("Set succeeded on a group without a Setter")
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	peer0 := &fakePeer{}
+	peer1 := &fakePeer{}
+	peerList := fakePeers([]ProtoGetter{peer0, peer1, nil})
+	store := &mapStore{m: map[string]string{}}
+	g := newGroup("TestGetMulti-group", cacheSize, store, peerList)
+
+	var keys []string
+	for i := 0; i < 30; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+	// Duplicates share a single load and a single batch slot.
+	keys = append(keys, keys[0], keys[1])
+	for _, key := range keys {
+		if _, ok := peerList.PickPeer(key); !ok {
+			store.m[key] = "local:" + key
+		}
+	}
+
+	values := make([]string, len(keys))
+	dests := make([]Sink, len(keys))
+	for i := range keys {
+		dests[i] = StringSink(&values[i])
+	}
+	for i, err := range g.GetMulti(dummyCtx, keys, dests) {
+		if err != nil {
+			t.Fatalf("GetMulti key %q: %v", keys[i], err)
+		}
+		want := "got:" + keys[i]
+		if _, ok := peerList.PickPeer(keys[i]); !ok {
+			want = "local:" + keys[i]
+		}
+		if values[i] != want {
+			t.Errorf("GetMulti key %q = %q; want %q", keys[i], values[i], want)
+		}
+	}
+	if peer0.multis != 1 || peer1.multis != 1 || peer0.hits != 0 || peer1.hits != 0 {
+		t.Errorf("peer batches = %d %d, gets = %d %d; want 1 1, 0 0",
+			peer0.multis, peer1.multis, peer0.hits, peer1.hits)
+	}
+
+	// Errors are reported per key; a key the owner fails on falls
+	// back to the local getter like Get does.
+	var bad string
+	for i := 0; ; i++ {
+		bad = fmt.Sprintf("bad-%d", i)
+		if peer, _ := peerList.PickPeer(bad); peer == peer0 {
+			break
+		}
+	}
+	var v0 string
+	errs := g.GetMulti(dummyCtx, []string{bad, keys[2]}, []Sink{StringSink(&v0), nil})
+	if errs[0] != nil || v0 != "" {
+		t.Errorf("GetMulti(%q) = %q, %v; want local fallback", bad, v0, errs[0])
+	}
+	if errs[1] == nil {
+		t.Error("GetMulti with a nil dest succeeded")
+	}
+	if store.gets == 0 {
+		t.Error("local getter was not used as a fallback")
+	}
+
+	// A failing peer sends every key it owns to the local getter.
+	peer1.fail = true
+	var keys1 []string
+	for i := 100; len(keys1) < 3; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if peer, _ := peerList.PickPeer(key); peer == peer1 {
+			keys1 = append(keys1, key)
+		}
+	}
+	values = make([]string, len(keys1))
+	dests = make([]Sink, len(keys1))
+	for i := range keys1 {
+		dests[i] = StringSink(&values[i])
+	}
+	for i, err := range g.GetMulti(dummyCtx, keys1, dests) {
+		if err != nil {
+			t.Errorf("GetMulti key %q: %v; want local fallback", keys1[i], err)
+		}
+	}
+	if peer1.multis != 2 {
+		t.Errorf("peer1 batches = %d; want 2", peer1.multis)
+	}
+	if g.Stats.PeerErrors.Get() != 4 {
+		t.Errorf("PeerErrors = %d; want 4", g.Stats.PeerErrors.Get())
+	}
+
+	if errs := g.GetMulti(dummyCtx, []string{"a"}, nil); errs[0] == nil {
+		t.Error("GetMulti with mismatched dests succeeded")
+	}
+}
+
+// getOnlyPeer implements only ProtoGetter.
+type getOnlyPeer struct {
+	hits int
+}
+
+func (p *getOnlyPeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	p.hits++
+	out.Value = []byte("got:" + in.GetKey())
+	return nil
+}
+
+// TestGetOnlyPeer checks that a peer without the optional interfaces still
+// works: GetMulti falls back to Get, broadcasts skip it, and operations the
+// owner must support fail with errors.ErrUnsupported.
+func TestGetOnlyPeer(t *testing.T) {
+	peer := &getOnlyPeer{}
+	other := &fakePeer{}
+	peerList := listingPeers{fakePeers{peer, other}}
+	g := newGroup("TestGetOnlyPeer-group", cacheSize, &mapStore{m: map[string]string{}}, peerList)
+
+	var key, otherKey string
+	for i := 0; key == "" || otherKey == ""; i++ {
+		k := fmt.Sprintf("key-%d", i)
+		if p, _ := peerList.PickPeer(k); p == peer {
+			key = k
+		} else {
+			otherKey = k
+		}
+	}
+	var v string
+	if errs := g.GetMulti(dummyCtx, []string{key}, []Sink{StringSink(&v)}); errs[0] != nil || v != "got:"+key || peer.hits != 1 {
+		t.Errorf("GetMulti = %q, %v with %d Gets; want one Get", v, errs[0], peer.hits)
+	}
+	if err := g.Set(dummyCtx, key, []byte("v")); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Set on a Get-only owner = %v; want ErrUnsupported", err)
+	}
+	if err := g.Remove(dummyCtx, key); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Remove on a Get-only owner = %v; want ErrUnsupported", err)
+	}
+	if err := g.Remove(dummyCtx, otherKey); err != nil || other.removes != 1 {
+		t.Errorf("Remove = %v with %d removes; want the Get-only peer skipped", err, other.removes)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	var calls int
+	getter := GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		calls++
+		return fmt.Errorf("no row for %q: %w", key, ErrNotFound)
+	})
+	g := newGroupOpts("TestNotFound-group", cacheSize, getter, nil, &GroupOptions{NotFoundTTL: 50 * time.Millisecond})
+
+	var s string
+	for i := 0; i < 3; i++ {
+		if err := g.Get(dummyCtx, "key", StringSink(&s)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get #%d error = %v; want ErrNotFound", i, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("getter calls = %d; want 1 while the negative entry is cached", calls)
+	}
+	errs := g.GetMulti(dummyCtx, []string{"key"}, []Sink{StringSink(&s)})
+	if !errors.Is(errs[0], ErrNotFound) || calls != 1 {
+		t.Errorf("GetMulti = %v with %d getter calls; want cached ErrNotFound", errs[0], calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := g.Get(dummyCtx, "key", StringSink(&s)); !errors.Is(err, ErrNotFound) || calls != 2 {
+		t.Errorf("Get after TTL = %v with %d getter calls; want a reload", err, calls)
+	}
+
+	// A negative TTL disables negative caching.
+	calls = 0
+	g = newGroupOpts("TestNotFound-nocache", cacheSize, getter, nil, &GroupOptions{NotFoundTTL: -1})
+	g.Get(dummyCtx, "key", StringSink(&s))
+	g.Get(dummyCtx, "key", StringSink(&s))
+	if calls != 2 {
+		t.Errorf("getter calls = %d; want 2 without negative caching", calls)
+	}
+
+	// An owner's not-found answer is final; the local getter is not tried.
+	peer := &fakePeer{}
+	calls = 0
+	g = newGroup("TestNotFound-peer", cacheSize, getter, fakePeers([]ProtoGetter{peer}))
+	if err := g.Get(dummyCtx, "missing", StringSink(&s)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get from peer error = %v; want ErrNotFound", err)
+	}
+	if calls != 0 || g.Stats.PeerErrors.Get() != 0 {
+		t.Errorf("getter calls = %d, peer errors = %d; want 0, 0", calls, g.Stats.PeerErrors.Get())
+	}
+}
+
+func TestGroupClose(t *testing.T) {
+	entered := make(chan bool)
+	release := make(chan bool)
+	g := newGroup("TestGroupClose-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "slow" {
+			entered <- true
+			<-release
+		}
+		return dest.SetString("v:" + key)
+	}), NoPeers{})
+
+	var s string
+	if err := g.Get(dummyCtx, "warm", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	getErr := make(chan error)
+	go func() {
+		var s string
+		getErr <- g.Get(dummyCtx, "slow", StringSink(&s))
+	}()
+	<-entered
+
+	closed := make(chan bool)
+	go func() {
+		g.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a load was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- true
+	if err := <-getErr; err != nil {
+		t.Errorf("in-flight Get = %v; want it to finish", err)
+	}
+	<-closed
+
+	if GetGroup("TestGroupClose-group") != nil {
+		t.Error("closed group is still registered")
+	}
+	if b := g.CacheStats(MainCache).Bytes; b != 0 {
+		t.Errorf("mainCache holds %d bytes after Close; want 0", b)
+	}
+	if err := g.Get(dummyCtx, "warm", StringSink(&s)); !errors.Is(err, ErrGroupClosed) {
+		t.Errorf("Get after Close = %v; want ErrGroupClosed", err)
+	}
+	g.Close() // A second Close is a no-op.
+
+	// The name can be reused, and DeregisterGroup closes the new group.
+	g2 := newGroup("TestGroupClose-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v2:" + key)
+	}), NoPeers{})
+	if err := g2.Get(dummyCtx, "warm", StringSink(&s)); err != nil || s != "v2:warm" {
+		t.Errorf("Get on recreated group = %q, %v; want %q", s, err, "v2:warm")
+	}
+	if !DeregisterGroup("TestGroupClose-group") || DeregisterGroup("TestGroupClose-group") {
+		t.Error("DeregisterGroup did not report the group exactly once")
+	}
+	if err := g2.Get(dummyCtx, "warm", StringSink(&s)); !errors.Is(err, ErrGroupClosed) {
+		t.Errorf("Get after DeregisterGroup = %v; want ErrGroupClosed", err)
+	}
+}
+
+func TestSetCacheBytes(t *testing.T) {
+	g := newGroup("TestSetCacheBytes-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(strings.Repeat("x", 100))
+	}), NoPeers{})
+	var s string
+	for i := 0; i < 50; i++ {
+		g.Get(dummyCtx, fmt.Sprintf("key-%d", i), StringSink(&s))
+	}
+	if b := g.CacheStats(MainCache).Bytes; b < 5000 {
+		t.Fatalf("mainCache holds %d bytes; want all 50 entries", b)
+	}
+
+	g.SetCacheBytes(1000)
+	if g.CacheBytes() != 1000 {
+		t.Errorf("CacheBytes = %d; want 1000", g.CacheBytes())
+	}
+	if b := g.CacheStats(MainCache).Bytes; b > 1000 || b == 0 {
+		t.Errorf("mainCache holds %d bytes after shrinking to 1000", b)
+	}
+
+	g.SetCacheBytes(0)
+	if st := g.CacheStats(MainCache); st.Bytes != 0 || st.Items != 0 {
+		t.Errorf("mainCache holds %d bytes in %d items with caching disabled", st.Bytes, st.Items)
+	}
+	g.SetCacheBytes(1 << 20)
+	g.Get(dummyCtx, "key-0", StringSink(&s))
+	if st := g.CacheStats(MainCache); st.Items != 1 {
+		t.Errorf("mainCache has %d items after growing again; want 1", st.Items)
+	}
+}
+
+func TestCacheShards(t *testing.T) {
+	const maxBytes = 4000
+	g := newGroupOpts("TestCacheShards-group", maxBytes, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(strings.Repeat("x", 100))
+	}), NoPeers{}, &GroupOptions{CacheShards: 6})
+	if n := len(g.mainCache.shards); n != 8 {
+		t.Fatalf("mainCache has %d shards; want 6 rounded up to 8", n)
+	}
+	def := newGroup("TestCacheShards-default", maxBytes, GetterFunc(func(context.Context, string, Sink) error { return nil }), NoPeers{})
+	if n, procs := len(def.mainCache.shards), runtime.GOMAXPROCS(0); n < procs || n >= 2*procs {
+		t.Errorf("default mainCache has %d shards; want GOMAXPROCS (%d) rounded up to a power of two", n, procs)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			var s string
+			for i := 0; i < 200; i++ {
+				g.Get(dummyCtx, fmt.Sprintf("key-%d", (i*7+w)%100), StringSink(&s))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// The byte budget covers all shards together, and the stats of the
+	// shards add up.
+	st := g.CacheStats(MainCache)
+	if st.Bytes > maxBytes || st.Bytes != g.mainCache.bytes() {
+		t.Errorf("mainCache stats report %d bytes, total %d; want equal and at most %d", st.Bytes, g.mainCache.bytes(), maxBytes)
+	}
+	var items int64
+	for i := range g.mainCache.shards {
+		items += g.mainCache.shards[i].items()
+	}
+	if st.Items != items || st.Items == 0 {
+		t.Errorf("mainCache stats report %d items; shards hold %d", st.Items, items)
+	}
+	if st.Gets < 8*200 || st.Evictions == 0 {
+		t.Errorf("mainCache stats = %+v; want every Get counted and some evictions", st)
+	}
+
+	g.SetCacheBytes(0)
+	if b := g.mainCache.bytes(); b != 0 {
+		t.Errorf("mainCache holds %d bytes after clearing every shard", b)
 	}
 }
 
@@ -455,3 +1189,22 @@ func TestGroupStatsAlignment(t *testing.T) {
 
 // TODO(bradfitz): port the Google-internal full integration test into here,
 // using HTTP requests instead of our RPC system.
+
+func BenchmarkCacheGetParallel(b *testing.B) {
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			var c cache
+			c.init("bench", shards, nil)
+			for i := 0; i < 1000; i++ {
+				c.add(strconv.Itoa(i), ByteView{s: "value"})
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.get(strconv.Itoa(i % 1000))
+					i++
+				}
+			})
+		})
+	}
+}
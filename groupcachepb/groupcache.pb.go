@@ -40,6 +40,8 @@ func (m *GetRequest) GetKey() string {
 type GetResponse struct {
 	Value            []byte   `protobuf:"bytes,1,opt,name=value" json:"value,omitempty"`
 	MinuteQps        *float64 `protobuf:"fixed64,2,opt,name=minute_qps" json:"minute_qps,omitempty"`
+	Expire           *int64   `protobuf:"varint,3,opt,name=expire" json:"expire,omitempty"`
+	NotFound         *bool    `protobuf:"varint,4,opt,name=not_found" json:"not_found,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -61,5 +63,267 @@ func (m *GetResponse) GetMinuteQps() float64 {
 	return 0
 }
 
+func (m *GetResponse) GetExpire() int64 {
+	if m != nil && m.Expire != nil {
+		return *m.Expire
+	}
+	return 0
+}
+
+func (m *GetResponse) GetNotFound() bool {
+	if m != nil && m.NotFound != nil {
+		return *m.NotFound
+	}
+	return false
+}
+
+type RemoveRequest struct {
+	Group            *string `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Key              *string `protobuf:"bytes,2,req,name=key" json:"key,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *RemoveRequest) Reset()         { *m = RemoveRequest{} }
+func (m *RemoveRequest) String() string { return proto.CompactTextString(m) }
+func (*RemoveRequest) ProtoMessage()    {}
+
+func (m *RemoveRequest) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *RemoveRequest) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+type RemoveResponse struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *RemoveResponse) Reset()         { *m = RemoveResponse{} }
+func (m *RemoveResponse) String() string { return proto.CompactTextString(m) }
+func (*RemoveResponse) ProtoMessage()    {}
+
+type SetRequest struct {
+	Group            *string `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Key              *string `protobuf:"bytes,2,req,name=key" json:"key,omitempty"`
+	Value            []byte  `protobuf:"bytes,3,opt,name=value" json:"value,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *SetRequest) Reset()         { *m = SetRequest{} }
+func (m *SetRequest) String() string { return proto.CompactTextString(m) }
+func (*SetRequest) ProtoMessage()    {}
+
+func (m *SetRequest) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *SetRequest) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+func (m *SetRequest) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+type SetResponse struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *SetResponse) Reset()         { *m = SetResponse{} }
+func (m *SetResponse) String() string { return proto.CompactTextString(m) }
+func (*SetResponse) ProtoMessage()    {}
+
+type GetMultiRequest struct {
+	Group            *string  `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Keys             []string `protobuf:"bytes,2,rep,name=keys" json:"keys,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *GetMultiRequest) Reset()         { *m = GetMultiRequest{} }
+func (m *GetMultiRequest) String() string { return proto.CompactTextString(m) }
+func (*GetMultiRequest) ProtoMessage()    {}
+
+func (m *GetMultiRequest) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *GetMultiRequest) GetKeys() []string {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+type GetMultiResult struct {
+	Key              *string  `protobuf:"bytes,1,req,name=key" json:"key,omitempty"`
+	Value            []byte   `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	Expire           *int64   `protobuf:"varint,3,opt,name=expire" json:"expire,omitempty"`
+	Error            *string  `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
+	NotFound         *bool    `protobuf:"varint,5,opt,name=not_found" json:"not_found,omitempty"`
+	MinuteQps        *float64 `protobuf:"fixed64,6,opt,name=minute_qps" json:"minute_qps,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *GetMultiResult) Reset()         { *m = GetMultiResult{} }
+func (m *GetMultiResult) String() string { return proto.CompactTextString(m) }
+func (*GetMultiResult) ProtoMessage()    {}
+
+func (m *GetMultiResult) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+func (m *GetMultiResult) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *GetMultiResult) GetExpire() int64 {
+	if m != nil && m.Expire != nil {
+		return *m.Expire
+	}
+	return 0
+}
+
+func (m *GetMultiResult) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
+func (m *GetMultiResult) GetNotFound() bool {
+	if m != nil && m.NotFound != nil {
+		return *m.NotFound
+	}
+	return false
+}
+
+func (m *GetMultiResult) GetMinuteQps() float64 {
+	if m != nil && m.MinuteQps != nil {
+		return *m.MinuteQps
+	}
+	return 0
+}
+
+type GetMultiResponse struct {
+	Results          []*GetMultiResult `protobuf:"bytes,1,rep,name=results" json:"results,omitempty"`
+	XXX_unrecognized []byte            `json:"-"`
+}
+
+func (m *GetMultiResponse) Reset()         { *m = GetMultiResponse{} }
+func (m *GetMultiResponse) String() string { return proto.CompactTextString(m) }
+func (*GetMultiResponse) ProtoMessage()    {}
+
+func (m *GetMultiResponse) GetResults() []*GetMultiResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+type HandoffEntry struct {
+	Key              *string `protobuf:"bytes,1,req,name=key" json:"key,omitempty"`
+	Value            []byte  `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	Expire           *int64  `protobuf:"varint,3,opt,name=expire" json:"expire,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *HandoffEntry) Reset()         { *m = HandoffEntry{} }
+func (m *HandoffEntry) String() string { return proto.CompactTextString(m) }
+func (*HandoffEntry) ProtoMessage()    {}
+
+func (m *HandoffEntry) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+func (m *HandoffEntry) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *HandoffEntry) GetExpire() int64 {
+	if m != nil && m.Expire != nil {
+		return *m.Expire
+	}
+	return 0
+}
+
+type HandoffRequest struct {
+	Group            *string         `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Entries          []*HandoffEntry `protobuf:"bytes,2,rep,name=entries" json:"entries,omitempty"`
+	XXX_unrecognized []byte          `json:"-"`
+}
+
+func (m *HandoffRequest) Reset()         { *m = HandoffRequest{} }
+func (m *HandoffRequest) String() string { return proto.CompactTextString(m) }
+func (*HandoffRequest) ProtoMessage()    {}
+
+func (m *HandoffRequest) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *HandoffRequest) GetEntries() []*HandoffEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+type HandoffResponse struct {
+	Accepted         *int64   `protobuf:"varint,1,opt,name=accepted" json:"accepted,omitempty"`
+	Keys             []string `protobuf:"bytes,2,rep,name=keys" json:"keys,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *HandoffResponse) Reset()         { *m = HandoffResponse{} }
+func (m *HandoffResponse) String() string { return proto.CompactTextString(m) }
+func (*HandoffResponse) ProtoMessage()    {}
+
+func (m *HandoffResponse) GetAccepted() int64 {
+	if m != nil && m.Accepted != nil {
+		return *m.Accepted
+	}
+	return 0
+}
+
+func (m *HandoffResponse) GetKeys() []string {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
 func init() {
 }
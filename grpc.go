@@ -0,0 +1,528 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/golang/groupcache/consistenthash"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCPool 为一组 gRPC 对等体实现 PeerPicker。
+//
+// 它与 HTTPPool 使用相同的一致性哈希环，但通过 groupcache.proto 中
+// 声明的 GroupCache 服务与对等体通信：每个对等体只保持一个多路复用的
+// 连接，调用者 ctx 的截止时间也会随请求传递到对等体。
+type GRPCPool struct {
+	// 这个对等体的地址，例如 "10.0.0.1:8008"
+	self string
+
+	// opts 指定选项。
+	opts GRPCPoolOptions
+
+	mu          sync.Mutex // 保护 peers 和 grpcGetters
+	peers       *consistenthash.Map
+	grpcGetters map[string]*grpcGetter // 键例如 "10.0.0.2:8008"
+}
+
+// GRPCPoolOptions 是 GRPCPool 的配置。
+//
+// 与 HTTPPoolOptions 不同，GRPCPool 没有熔断器、重试和对冲请求，
+// 也不跟踪对等体的负载：对等体不可用时加载直接失败并回退到本地加载，
+// 需要时可以通过 DialOptions 配置 gRPC 自身的重试策略。
+type GRPCPoolOptions struct {
+	// Replicas 指定一致性哈希上的键副本数量。
+	// 如果为空，默认为 50。
+	Replicas int
+
+	// HashFn 指定一致性哈希的哈希函数。
+	// 如果为空，默认为 crc32.ChecksumIEEE。
+	HashFn consistenthash.Hash
+
+	// DialOptions 指定连接对等体时使用的 gRPC 拨号选项。
+	// 如果为空，默认使用不加密的连接。值通过 GetStream 分块传输，
+	// 不受 gRPC 默认 4MB 的消息大小上限限制。
+	DialOptions []grpc.DialOption
+
+	// MaxResponseBytes 是从对等体取得的值的最大字节数。值在接收的过程中
+	// 一旦超过它，调用立即被取消并返回 ErrResponseTooLarge。
+	// 不大于零时不限制。
+	MaxResponseBytes int64
+
+	// Registry 指定池注册为 PeerPicker 并从中查找组的 Registry。
+	// 如果为空，默认为 DefaultRegistry。每个 Registry 只能有一个池。
+	Registry *Registry
+}
+
+// NewGRPCPool 初始化 gRPC 对等体池，将自己注册为 PeerPicker，
+// 并在 s 上注册 GroupCache 服务。
+// self 参数应该是当前服务器的 gRPC 地址，例如 "example.net:8000"。
+func NewGRPCPool(self string, s grpc.ServiceRegistrar) *GRPCPool {
+	p := NewGRPCPoolOpts(self, nil)
+	RegisterGRPCServer(s)
+	return p
+}
+
+// NewGRPCPoolOpts 使用给定选项初始化 gRPC 对等体池。
+// 与 NewGRPCPool 不同，此函数不注册 GroupCache 服务，调用者需要
+// 自行调用 RegisterGRPCServer 或对应 Registry 的 RegisterGRPCServer。
+func NewGRPCPoolOpts(self string, o *GRPCPoolOptions) *GRPCPool {
+	p := newGRPCPool(self, o)
+	p.opts.Registry.RegisterPeerPicker(func() PeerPicker { return p })
+	return p
+}
+
+// newGRPCPool 创建池但不将其注册为 PeerPicker，供测试使用。
+func newGRPCPool(self string, o *GRPCPoolOptions) *GRPCPool {
+	p := &GRPCPool{
+		self:        self,
+		grpcGetters: make(map[string]*grpcGetter),
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.Registry == nil {
+		p.opts.Registry = DefaultRegistry
+	}
+	if p.opts.DialOptions == nil {
+		p.opts.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	return p
+}
+
+// Set 更新池的对等体列表。每个对等体值应该是有效的 gRPC 地址。
+// 仍在列表中的对等体会复用已有连接，被移除的对等体的连接会被关闭。
+// 成员变化时调用 Registry.PeersChanged。
+func (p *GRPCPool) Set(peers ...string) error {
+	p.mu.Lock()
+	changed, err := p.set(peers)
+	p.mu.Unlock()
+	if changed {
+		p.opts.Registry.PeersChanged()
+	}
+	return err
+}
+
+func (p *GRPCPool) set(peers []string) (changed bool, err error) {
+	// grpcGetters 中没有本节点，单独计数。
+	oldMembers, newMembers := len(p.grpcGetters), 0
+	if p.peers.Weight(p.self) > 0 {
+		oldMembers++
+	}
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if g, ok := p.grpcGetters[peer]; ok {
+			getters[peer] = g
+			continue
+		}
+		if peer == p.self {
+			newMembers = 1
+			continue
+		}
+		conn, err := grpc.Dial(peer, p.opts.DialOptions...)
+		if err != nil {
+			for peer, g := range getters {
+				if p.grpcGetters[peer] != g {
+					g.conn.Close()
+				}
+			}
+			return false, err
+		}
+		getters[peer] = &grpcGetter{conn: conn, maxBytes: p.opts.MaxResponseBytes}
+	}
+	for peer, g := range p.grpcGetters {
+		if getters[peer] != g {
+			g.conn.Close()
+		}
+	}
+	// 新的对等体都已在环上且个数相同时，成员没有变化。
+	for _, peer := range peers {
+		if p.peers.Weight(peer) == 0 {
+			changed = true
+		}
+	}
+	changed = changed || len(getters)+newMembers != oldMembers
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.peers.Add(peers...)
+	p.grpcGetters = getters
+	return changed, nil
+}
+
+func (p *GRPCPool) PickPeer(key string) (ProtoGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers.IsEmpty() {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != p.self {
+		return p.grpcGetters[peer], true
+	}
+	return nil, false
+}
+
+// PickOwner 实现 OwnerPicker。GRPCPool 没有熔断器，PickPeer 返回的
+// 就是环上键真正的所有者。
+func (p *GRPCPool) PickOwner(key string) (ProtoGetter, bool) {
+	return p.PickPeer(key)
+}
+
+// PickPeers 实现 ReplicaPicker，沿一致性哈希环返回键的至多 n 个副本。
+func (p *GRPCPool) PickPeers(key string, n int) []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	nodes := p.peers.GetN(key, n)
+	peers := make([]ProtoGetter, len(nodes))
+	for i, node := range nodes {
+		if node != p.self {
+			peers[i] = p.grpcGetters[node]
+		}
+	}
+	return peers
+}
+
+// GetAll 返回除自身以外所有对等体的 ProtoGetter。
+func (p *GRPCPool) GetAll() []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]ProtoGetter, 0, len(p.grpcGetters))
+	for _, getter := range p.grpcGetters {
+		getters = append(getters, getter)
+	}
+	return getters
+}
+
+// Close 关闭到所有对等体的连接。
+func (p *GRPCPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for _, g := range p.grpcGetters {
+		if cerr := g.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	p.grpcGetters = make(map[string]*grpcGetter)
+	return err
+}
+
+// grpcServiceName 是 groupcache.proto 中 GroupCache 服务的全名。
+const grpcServiceName = "groupcachepb.GroupCache"
+
+// RegisterGRPCServer 在 s 上注册 GroupCache 服务。
+// 服务按请求中的组名通过 GetGroup 分派到本进程的组。
+func RegisterGRPCServer(s grpc.ServiceRegistrar) {
+	DefaultRegistry.RegisterGRPCServer(s)
+}
+
+// RegisterGRPCServer 在 s 上注册 GroupCache 服务，
+// 服务按请求中的组名分派到 r 中的组。
+func (r *Registry) RegisterGRPCServer(s grpc.ServiceRegistrar) {
+	s.RegisterService(&grpcServiceDesc, grpcServer{r})
+}
+
+// grpcServer 实现 GroupCache 服务的服务端。
+type grpcServer struct {
+	registry *Registry
+}
+
+func (s grpcServer) group(name string) (*Group, error) {
+	g := s.registry.GetGroup(name)
+	if g == nil {
+		return nil, status.Error(codes.NotFound, "no such group: "+name)
+	}
+	return g, nil
+}
+
+// grpcError 将组操作的错误转换为 gRPC 状态，
+// 在请求处理期间被关闭的组与不存在的组一样得到 NotFound。
+func grpcError(err error) error {
+	if errors.Is(err, ErrGroupClosed) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return err
+}
+
+func (s grpcServer) get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, error) {
+	g, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	res, err := g.serveGet(ctx, in.GetKey())
+	return res, grpcError(err)
+}
+
+// grpcChunkBytes 是 GetStream 的每一帧携带的值的最大字节数。
+const grpcChunkBytes = 1 << 20
+
+// getStream 把缓存中的值切成至多 grpcChunkBytes 字节的块，依次在
+// stream 上发送，与 writeStream 一样不先复制整个值。第一帧携带值以外
+// 的字段，空值也发送一帧。
+func (s grpcServer) getStream(ctx context.Context, in *pb.GetRequest, stream grpc.ServerStream) error {
+	g, err := s.group(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	value, qps, _, err := g.serveGetView(ctx, in.GetKey(), nil)
+	if errors.Is(err, ErrNotFound) {
+		return stream.SendMsg(&pb.GetResponse{NotFound: proto.Bool(true)})
+	}
+	if err != nil {
+		return grpcError(err)
+	}
+	res := &pb.GetResponse{MinuteQps: proto.Float64(qps)}
+	if e := value.Expire(); !e.IsZero() {
+		res.Expire = proto.Int64(e.UnixNano())
+	}
+	// SendMsg 返回前已经序列化了消息，string 的视图可以复用 buf。
+	var buf []byte
+	for off := 0; ; {
+		n := value.Len() - off
+		if n > grpcChunkBytes {
+			n = grpcChunkBytes
+		}
+		chunk := value.Slice(off, off+n)
+		if chunk.b != nil {
+			res.Value = chunk.b
+		} else {
+			buf = append(buf[:0], chunk.s...)
+			res.Value = buf
+		}
+		if err := stream.SendMsg(res); err != nil {
+			return err
+		}
+		if off += n; off == value.Len() {
+			return nil
+		}
+		res = &pb.GetResponse{}
+	}
+}
+
+func (s grpcServer) remove(ctx context.Context, in *pb.RemoveRequest) (*pb.RemoveResponse, error) {
+	g, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	// 与 HTTP 的 DELETE 相同，只清除本地缓存，不再转发。
+	g.localRemove(in.GetKey())
+	return &pb.RemoveResponse{}, nil
+}
+
+func (s grpcServer) set(ctx context.Context, in *pb.SetRequest) (*pb.SetResponse, error) {
+	g, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	if err := g.localSet(ctx, in.GetKey(), in.GetValue()); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.SetResponse{}, nil
+}
+
+func (s grpcServer) handoff(ctx context.Context, in *pb.HandoffRequest) (*pb.HandoffResponse, error) {
+	g, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	return g.serveHandoff(in), nil
+}
+
+func (s grpcServer) getMulti(ctx context.Context, in *pb.GetMultiRequest) (*pb.GetMultiResponse, error) {
+	g, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	return g.serveGetMulti(ctx, in.GetKeys()), nil
+}
+
+// grpcHandler 将 GroupCache 服务的一个方法适配为 grpc.MethodDesc 的处理程序。
+func grpcHandler[Req, Res any](name string, fn func(grpcServer, context.Context, *Req) (*Res, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(Req)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			s := srv.(grpcServer)
+			ctx = incomingTrace(ctx)
+			if interceptor == nil {
+				return fn(s, ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + grpcServiceName + "/" + name,
+			}
+			return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return fn(s, ctx, req.(*Req))
+			})
+		},
+	}
+}
+
+// incomingTrace 返回带有请求元数据中的追踪上下文的 ctx。
+func incomingTrace(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(TraceParentHeader); len(v) > 0 {
+			if sc, err := ParseTraceParent(v[0]); err == nil {
+				ctx = ContextWithSpanContext(ctx, sc)
+			}
+		}
+	}
+	return ctx
+}
+
+// grpcServiceDesc 手写了 GroupCache 服务的描述，对应 groupcache.proto。
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		grpcHandler("Get", grpcServer.get),
+		grpcHandler("Remove", grpcServer.remove),
+		grpcHandler("Set", grpcServer.set),
+		grpcHandler("GetMulti", grpcServer.getMulti),
+		grpcHandler("Handoff", grpcServer.handoff),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName: "GetStream",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			in := new(pb.GetRequest)
+			if err := stream.RecvMsg(in); err != nil {
+				return err
+			}
+			return srv.(grpcServer).getStream(incomingTrace(stream.Context()), in, stream)
+		},
+		ServerStreams: true,
+	}},
+	Metadata: "groupcache.proto",
+}
+
+// grpcGetter 实现了 ProtoGetter 的所有可选接口。
+var _ interface {
+	ProtoGetter
+	Remover
+	SetterPeer
+	MultiGetter
+	HandoffPeer
+} = (*grpcGetter)(nil)
+
+// grpcGetter 通过 gRPC 连接实现 ProtoGetter。
+type grpcGetter struct {
+	conn *grpc.ClientConn
+
+	// maxBytes 是值的最大字节数，不大于零时不限制。
+	maxBytes int64
+}
+
+// outgoing 把 ctx 中的追踪上下文放入请求元数据。
+func outgoing(ctx context.Context) context.Context {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		ctx = metadata.AppendToOutgoingContext(ctx, TraceParentHeader, sc.TraceParent())
+	}
+	return ctx
+}
+
+func (g *grpcGetter) invoke(ctx context.Context, method string, in, out interface{}) error {
+	return g.conn.Invoke(outgoing(ctx), "/"+grpcServiceName+"/"+method, in, out)
+}
+
+// Get 通过 GetStream 分块取得值。不支持 GetStream 的对等体仍使用一元的 Get。
+func (g *grpcGetter) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	err := g.getStream(ctx, in, out)
+	if status.Code(err) == codes.Unimplemented {
+		err = g.invoke(ctx, "Get", in, out)
+		if err == nil && g.maxBytes > 0 && int64(len(out.Value)) > g.maxBytes {
+			err = ErrResponseTooLarge
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if out.GetNotFound() {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// getStream 调用 GetStream，按顺序拼接各帧携带的块。值超过 maxBytes 时
+// 立即取消调用并返回 ErrResponseTooLarge。
+func (g *grpcGetter) getStream(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	ctx, cancel := context.WithCancel(outgoing(ctx))
+	defer cancel()
+	stream, err := g.conn.NewStream(ctx, &grpcServiceDesc.Streams[0], "/"+grpcServiceName+"/GetStream")
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(in); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	if err := stream.RecvMsg(out); err != nil {
+		if err == io.EOF {
+			return errors.New("groupcache: empty GetStream response")
+		}
+		return err
+	}
+	for chunk := new(pb.GetResponse); ; {
+		if g.maxBytes > 0 && int64(len(out.Value)) > g.maxBytes {
+			return ErrResponseTooLarge
+		}
+		chunk.Reset()
+		if err := stream.RecvMsg(chunk); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		out.Value = append(out.Value, chunk.Value...)
+	}
+}
+
+func (g *grpcGetter) Remove(ctx context.Context, in *pb.RemoveRequest) error {
+	return g.invoke(ctx, "Remove", in, &pb.RemoveResponse{})
+}
+
+func (g *grpcGetter) Set(ctx context.Context, in *pb.SetRequest) error {
+	return g.invoke(ctx, "Set", in, &pb.SetResponse{})
+}
+
+func (g *grpcGetter) GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	return g.invoke(ctx, "GetMulti", in, out)
+}
+
+func (g *grpcGetter) Handoff(ctx context.Context, in *pb.HandoffRequest, out *pb.HandoffResponse) error {
+	return g.invoke(ctx, "Handoff", in, out)
+}
+
+// String 返回对等体的地址，用于在统计信息中标识对等体。
+func (g *grpcGetter) String() string {
+	return g.conn.Target()
+}
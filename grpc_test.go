@@ -0,0 +1,204 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// grpcStore is a mapStore that reports missing keys as ErrNotFound and
+// blocks on the key "slow" until the request's context is done.
+type grpcStore struct {
+	*mapStore
+	blocked chan struct{}
+}
+
+func (s *grpcStore) Get(ctx context.Context, key string, dest Sink) error {
+	if key == "slow" {
+		close(s.blocked)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	s.mu.Lock()
+	_, ok := s.m[key]
+	s.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return s.mapStore.Get(ctx, key, dest)
+}
+
+func TestGRPCPool(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	RegisterGRPCServer(s)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	store := &grpcStore{mapStore: &mapStore{m: map[string]string{"a": "1", "b": "2"}}}
+	newGroup("grpcPoolTest", 1<<20, store, NoPeers{})
+
+	p := newGRPCPool("self", &GRPCPoolOptions{
+		DialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+		},
+	})
+	defer p.Close()
+	if err := p.Set("self", "bufnet"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(p.GetAll()); n != 1 {
+		t.Fatalf("GetAll returned %d peers; want 1", n)
+	}
+	var peer ProtoGetter
+	for i := 0; peer == nil; i++ {
+		peer, _ = p.PickPeer(string(rune('a' + i)))
+	}
+
+	ctx := context.Background()
+	group := proto.String("grpcPoolTest")
+
+	res := &pb.GetResponse{}
+	if err := peer.Get(ctx, &pb.GetRequest{Group: group, Key: proto.String("a")}, res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Value) != "1" {
+		t.Errorf("Get(a) = %q; want %q", res.Value, "1")
+	}
+
+	err := peer.Get(ctx, &pb.GetRequest{Group: group, Key: proto.String("nope")}, &pb.GetResponse{})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(nope) error = %v; want ErrNotFound", err)
+	}
+
+	err = peer.Get(ctx, &pb.GetRequest{Group: proto.String("no-such-group"), Key: proto.String("a")}, &pb.GetResponse{})
+	if err == nil {
+		t.Error("Get on an unknown group succeeded")
+	}
+
+	mres := &pb.GetMultiResponse{}
+	if err := peer.(*grpcGetter).GetMulti(ctx, &pb.GetMultiRequest{Group: group, Keys: []string{"a", "b", "nope"}}, mres); err != nil {
+		t.Fatal(err)
+	}
+	if r := mres.GetResults(); len(r) != 3 || string(r[0].Value) != "1" || string(r[1].Value) != "2" || !r[2].GetNotFound() {
+		t.Errorf("GetMulti results = %v", r)
+	}
+
+	if err := peer.(*grpcGetter).Set(ctx, &pb.SetRequest{Group: group, Key: proto.String("a"), Value: []byte("3")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.Get(ctx, &pb.GetRequest{Group: group, Key: proto.String("a")}, res); err != nil || string(res.Value) != "3" {
+		t.Errorf("Get(a) after Set = %q, %v; want %q", res.Value, err, "3")
+	}
+	if err := peer.(*grpcGetter).Remove(ctx, &pb.RemoveRequest{Group: group, Key: proto.String("a")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The caller's deadline propagates to the owner's getter.
+	store.blocked = make(chan struct{})
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err = peer.Get(ctx, &pb.GetRequest{Group: group, Key: proto.String("slow")}, &pb.GetResponse{})
+	<-store.blocked
+	if err == nil {
+		t.Error("Get(slow) succeeded past its deadline")
+	}
+}
+
+// TestGRPCPoolStream checks that large values are streamed in chunks, that
+// MaxResponseBytes stops the transfer, and that peers without GetStream are
+// still served by the unary Get.
+func TestGRPCPoolStream(t *testing.T) {
+	// Larger than gRPC's default 4MB message limit.
+	big := strings.Repeat("x", 5*grpcChunkBytes+5)
+	reg := NewRegistry()
+	reg.NewGroup("grpcStream", 16<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		switch key {
+		case "bytes":
+			return dest.SetBytes([]byte(big))
+		case "missing":
+			return ErrNotFound
+		}
+		return dest.SetString(big)
+	}))
+	unary := grpcServiceDesc
+	unary.Streams = nil
+
+	for _, tc := range []struct {
+		name     string
+		desc     *grpc.ServiceDesc
+		key      string
+		maxBytes int64
+		wantErr  error
+	}{
+		{"stream", &grpcServiceDesc, "string", 0, nil},
+		{"bytes", &grpcServiceDesc, "bytes", 0, nil},
+		{"missing", &grpcServiceDesc, "missing", 0, ErrNotFound},
+		{"limited", &grpcServiceDesc, "string", grpcChunkBytes + 1, ErrResponseTooLarge},
+		{"unary", &unary, "string", 0, nil},
+	} {
+		lis := bufconn.Listen(1 << 20)
+		// Only the unary fallback needs the message limits raised.
+		var sopts []grpc.ServerOption
+		dopts := []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+		}
+		if tc.desc == &unary {
+			sopts = append(sopts, grpc.MaxSendMsgSize(64<<20))
+			dopts = append(dopts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(64<<20)))
+		}
+		s := grpc.NewServer(sopts...)
+		s.RegisterService(tc.desc, grpcServer{reg})
+		go s.Serve(lis)
+		defer s.Stop()
+
+		p := newGRPCPool("self", &GRPCPoolOptions{
+			Registry:         NewRegistry(),
+			MaxResponseBytes: tc.maxBytes,
+			DialOptions:      dopts,
+		})
+		defer p.Close()
+		if err := p.Set("bufnet"); err != nil {
+			t.Fatal(err)
+		}
+		peer, _ := p.PickPeer("key")
+		res := &pb.GetResponse{}
+		err := peer.Get(context.Background(), &pb.GetRequest{Group: proto.String("grpcStream"), Key: proto.String(tc.key)}, res)
+		if err != tc.wantErr {
+			t.Errorf("%s: Get error = %v; want %v", tc.name, err, tc.wantErr)
+		} else if err == nil && string(res.Value) != big {
+			t.Errorf("%s: Get returned %d bytes; want %d", tc.name, len(res.Value), len(big))
+		}
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	// handoffBatchBytes 是一次 Handoff 请求中值的最大字节数，
+	// HandoffBytesPerSecond 更小时以它为准。
+	handoffBatchBytes = 256 << 10
+
+	// handoffTimeout 是一次 Handoff 请求的超时。
+	handoffTimeout = 10 * time.Second
+)
+
+// PeersChanged 通知 r 中的组 PeerPicker 的成员已经改变。启用了交接
+// 的组（参见 GroupOptions.HandoffBytesPerSecond）取消进行中的交接，
+// 按新的成员在后台重新开始。HTTPPool 和 GRPCPool 在成员或权重变化
+// 时自动调用它，自定义的 PeerPicker 应该在成员变化后调用它。
+func (r *Registry) PeersChanged() {
+	for _, g := range r.Groups() {
+		g.startHandoff()
+	}
+}
+
+// handoffState 是组在后台进行中的交接。
+type handoffState struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stop 取消交接并等待它结束。
+func (h handoffState) stop() {
+	if h.cancel != nil {
+		h.cancel()
+		<-h.done
+	}
+}
+
+// startHandoff 取消进行中的交接，并在它结束后按当前的成员重新开始。
+func (g *Group) startHandoff() {
+	if g.opts.HandoffBytesPerSecond <= 0 {
+		return
+	}
+	g.closeMu.Lock()
+	defer g.closeMu.Unlock()
+	if g.closed {
+		return
+	}
+	prev := g.handoff
+	ctx, cancel := context.WithCancel(context.Background())
+	g.handoff = handoffState{cancel: cancel, done: make(chan struct{})}
+	go func(done chan struct{}) {
+		defer close(done)
+		prev.stop()
+		g.handoffKeys(ctx)
+	}(g.handoff.done)
+}
+
+// handoffBatch 是发往一个对等体的尚未发送的条目。
+type handoffBatch struct {
+	entries []*pb.HandoffEntry
+	bytes   int64
+	sent    int64 // 已被对等体接收的条目数
+	err     error // 发送失败后不再向该对等体发送
+}
+
+// handoffKeys 把 mainCache 中按当前的 PeerPicker 不再由本节点保存的
+// 键推送给新的所有者，从最近使用的键开始，按对等体分批发送，每秒至多
+// 发送 HandoffBytesPerSecond 字节的值。对等体确认保存的键从 mainCache
+// 中清除；被拒绝的、发送失败的或者发往没有实现 HandoffPeer 的对等体的
+// 键留在缓存中，由淘汰策略处理。
+func (g *Group) handoffKeys(ctx context.Context) {
+	g.peersOnce.Do(g.initPeers)
+	entries, err := g.mainCache.entries()
+	if err != nil {
+		g.logger().Warn("交接失败", "group", g.name, "err", err)
+		return
+	}
+	rate := g.opts.HandoffBytesPerSecond
+	maxBytes := int64(handoffBatchBytes)
+	if rate < maxBytes {
+		maxBytes = rate
+	}
+
+	batches := make(map[HandoffPeer]*handoffBatch)
+	var order []HandoffPeer
+	for i := len(entries) - 1; i >= 0 && ctx.Err() == nil; i-- {
+		e := entries[i]
+		if e.value.notFound {
+			continue
+		}
+		peers, replica := g.pickPeers(e.key)
+		if replica || len(peers) == 0 {
+			continue
+		}
+		peer, ok := peers[0].(HandoffPeer)
+		if !ok {
+			continue
+		}
+		b := batches[peer]
+		if b == nil {
+			b = new(handoffBatch)
+			batches[peer] = b
+			order = append(order, peer)
+		}
+		if b.err != nil {
+			continue
+		}
+		value, err := e.value.decode()
+		if err != nil {
+			continue
+		}
+		he := &pb.HandoffEntry{Key: &e.key, Value: value.ByteSlice()}
+		if exp := value.Expire(); !exp.IsZero() {
+			he.Expire = proto.Int64(exp.UnixNano())
+		}
+		b.entries = append(b.entries, he)
+		b.bytes += int64(value.Len())
+		if b.bytes >= maxBytes {
+			g.sendHandoff(ctx, peer, b, rate)
+		}
+	}
+	for _, peer := range order {
+		if b := batches[peer]; len(b.entries) > 0 && b.err == nil && ctx.Err() == nil {
+			g.sendHandoff(ctx, peer, b, rate)
+		}
+	}
+	for _, peer := range order {
+		b := batches[peer]
+		if b.err != nil {
+			g.logger().Warn("交接失败", "group", g.name, "peer", peer, "handed_off", b.sent, "err", b.err)
+		} else if ctx.Err() == nil {
+			g.logger().Info("交接完成", "group", g.name, "peer", peer, "handed_off", b.sent)
+		}
+	}
+}
+
+// sendHandoff 把 b 中的条目发送给 peer，从 mainCache 中清除 peer 确认
+// 保存的键，然后按 rate 等待，使发送的字节数平均不超过每秒 rate 字节。
+func (g *Group) sendHandoff(ctx context.Context, peer HandoffPeer, b *handoffBatch, rate int64) {
+	req := &pb.HandoffRequest{Group: &g.name, Entries: b.entries}
+	var res pb.HandoffResponse
+	rctx, cancel := context.WithTimeout(ctx, handoffTimeout)
+	b.err = peer.Handoff(rctx, req, &res)
+	cancel()
+	if b.err != nil {
+		return
+	}
+	// 对等体的环可能与本节点不一致而拒绝某些键，这些键留在本节点。
+	for _, key := range res.GetKeys() {
+		g.mainCache.remove(key)
+	}
+	b.sent += res.GetAccepted()
+	g.Stats.HandoffKeys.Add(res.GetAccepted())
+
+	wait := time.Duration(float64(b.bytes) / float64(rate) * float64(time.Second))
+	b.entries, b.bytes = nil, 0
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// serveHandoff 把对等体交接来的条目加入 mainCache，返回加入的条目数
+// 和本节点保存的键，发送方只清除这些键。
+func (g *Group) serveHandoff(in *pb.HandoffRequest) *pb.HandoffResponse {
+	g.peersOnce.Do(g.initPeers)
+	now := time.Now()
+	var n int64
+	var keys []string
+	for _, e := range in.GetEntries() {
+		value := ByteView{b: e.GetValue()}
+		if e.Expire != nil {
+			value.e = time.Unix(0, e.GetExpire())
+		}
+		added, held := g.addOwned(e.GetKey(), value, now)
+		if added {
+			n++
+		}
+		if held {
+			keys = append(keys, e.GetKey())
+		}
+	}
+	if g.debugEnabled() {
+		g.logger().Debug("接收交接", "group", g.name, "entries", len(in.GetEntries()), "accepted", n)
+	}
+	return &pb.HandoffResponse{Accepted: proto.Int64(n), Keys: keys}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	var (
+		pools  [2]*HTTPPool
+		groups [2]*Group
+		loads  [2]atomic.Int64
+		urls   []string
+	)
+	for i := range pools {
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pools[i].ServeHTTP(w, r)
+		}))
+		defer ts.Close()
+		urls = append(urls, ts.URL)
+	}
+	for i := range pools {
+		i := i
+		reg := NewRegistry()
+		pools[i] = NewHTTPPoolOpts(urls[i], &HTTPPoolOptions{Registry: reg})
+		groups[i] = reg.NewGroupOpts("handoff", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			loads[i].Add(1)
+			return dest.SetString("value:" + key)
+		}), &GroupOptions{HandoffBytesPerSecond: 1 << 20, HotKeyQPS: -1})
+	}
+
+	// Node 0 starts alone and caches every key.
+	pools[0].Set(urls[0])
+	pools[1].Set(urls...)
+	var keys []string
+	for i := 0; i < 50; i++ {
+		key := "key-" + strconv.Itoa(i)
+		keys = append(keys, key)
+		var s string
+		if err := groups[0].Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Node 1 joins: node 0 pushes the keys node 1 now owns.
+	pools[0].Set(urls...)
+	var moved []string
+	for _, key := range keys {
+		if _, ok := pools[0].PickPeer(key); ok {
+			moved = append(moved, key)
+		}
+	}
+	if len(moved) == 0 || len(moved) == len(keys) {
+		t.Fatalf("%d of %d keys moved; want some", len(moved), len(keys))
+	}
+	waitFor(t, "handoff", func() bool { return groups[0].Stats.HandoffKeys.Get() == int64(len(moved)) })
+
+	for _, key := range moved {
+		if _, ok := groups[0].mainCache.get(key); ok {
+			t.Errorf("old owner still caches %q", key)
+		}
+		var s string
+		if err := groups[0].Get(dummyCtx, key, StringSink(&s)); err != nil || s != "value:"+key {
+			t.Errorf("Get(%q) = %q, %v", key, s, err)
+		}
+	}
+	if n := loads[1].Load(); n != 0 {
+		t.Errorf("new owner loaded %d keys; want them handed off", n)
+	}
+
+	// Setting the same peers again does not restart the handoff.
+	groups[0].closeMu.Lock()
+	done := groups[0].handoff.done
+	groups[0].closeMu.Unlock()
+	pools[0].Set(urls...)
+	groups[0].closeMu.Lock()
+	restarted := groups[0].handoff.done != done
+	groups[0].closeMu.Unlock()
+	if restarted {
+		t.Error("Set with unchanged peers restarted the handoff")
+	}
+}
+
+// countingPeer records the entries it is handed.
+type countingPeer struct {
+	fakePeer
+	entries atomic.Int64
+}
+
+func (p *countingPeer) Handoff(_ context.Context, in *pb.HandoffRequest, out *pb.HandoffResponse) error {
+	p.entries.Add(int64(len(in.GetEntries())))
+	return p.fakePeer.Handoff(context.Background(), in, out)
+}
+
+func TestHandoffRateLimit(t *testing.T) {
+	const valueBytes = 100
+	g := newGroupOpts("TestHandoffRateLimit-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(strings.Repeat("x", valueBytes))
+	}), fakePeers{nil}, &GroupOptions{HandoffBytesPerSecond: 2 * valueBytes})
+	const n = 20
+	for i := 0; i < n; i++ {
+		var s string
+		if err := g.Get(dummyCtx, "key-"+strconv.Itoa(i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	peer := new(countingPeer)
+	g.peers = fakePeers{nil, peer}
+	g.registry.PeersChanged()
+
+	// The first batch holds two values, a second's worth; the next one waits.
+	waitFor(t, "first batch", func() bool { return g.mainCache.stats().Items == n-2 })
+	time.Sleep(50 * time.Millisecond)
+	if got := peer.entries.Load(); got != 2 {
+		t.Errorf("handed off %d entries before the rate limit; want 2", got)
+	}
+
+	// Close cancels the handoff without waiting for the rate limit.
+	start := time.Now()
+	g.Close()
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Close took %v", d)
+	}
+}
+
+// rejectingPeer confirms only the keys accepted by keep.
+type rejectingPeer struct {
+	fakePeer
+	keep func(key string) bool
+}
+
+func (p *rejectingPeer) Handoff(_ context.Context, in *pb.HandoffRequest, out *pb.HandoffResponse) error {
+	for _, e := range in.GetEntries() {
+		if p.keep(e.GetKey()) {
+			out.Keys = append(out.Keys, e.GetKey())
+		}
+	}
+	return nil
+}
+
+// TestHandoffRejected checks that keys the new owner does not confirm stay in
+// the old owner's mainCache.
+func TestHandoffRejected(t *testing.T) {
+	g := newGroupOpts("TestHandoffRejected-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value:" + key)
+	}), fakePeers{nil}, &GroupOptions{HandoffBytesPerSecond: 1 << 20})
+	defer g.Close()
+	const n = 20
+	for i := 0; i < n; i++ {
+		var s string
+		if err := g.Get(dummyCtx, "key-"+strconv.Itoa(i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keep := func(key string) bool { return strings.HasSuffix(key, "0") }
+	g.peers = fakePeers{&rejectingPeer{keep: keep}}
+	g.registry.PeersChanged()
+	g.closeMu.Lock()
+	done := g.handoff.done
+	g.closeMu.Unlock()
+	<-done
+
+	for i := 0; i < n; i++ {
+		key := "key-" + strconv.Itoa(i)
+		if _, ok := g.mainCache.get(key); ok == keep(key) {
+			t.Errorf("after handoff mainCache has %q = %v; want %v", key, ok, !keep(key))
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// loadResult 是一次加载尝试的结果。
+type loadResult struct {
+	value ByteView
+	err   error
+	peer  ProtoGetter // 本地加载时为 nil
+}
+
+// getFromPeerHedged 从 peer 取得键。PeerPicker 实现了 HedgingPicker 时，
+// 请求在对冲延迟之后仍未返回，就发出一个对冲请求：alt 不为 nil 时向 alt
+// 请求，否则本地加载。返回先成功的结果，并通过 ctx 取消另一个请求。
+// 两个请求都失败时返回后失败的那个，先失败的对等体请求已被记录。
+// 本地对冲加载登记在 g.inflight 中，组关闭后不再本地对冲。
+// hedged 报告是否发出了对冲请求。
+func (g *Group) getFromPeerHedged(ctx context.Context, peer, alt ProtoGetter, key string, replica bool) (r loadResult, hedged bool) {
+	hp, ok := g.peers.(HedgingPicker)
+	var delay time.Duration
+	if ok {
+		delay, ok = hp.HedgeDelay(peer, g.peerLatency(peer))
+	}
+	if !ok {
+		r.value, r.err = g.getFromPeer(ctx, peer, key, replica)
+		r.peer = peer
+		return r, false
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan loadResult, 2)
+	go func() {
+		value, err := g.getFromPeer(ctx, peer, key, replica)
+		results <- loadResult{value, err, peer}
+	}()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			if !hp.AllowHedge() {
+				continue
+			}
+			// 本地对冲加载可能在本函数返回后才结束，需要登记为进行中，
+			// Close 才会等待它；组已关闭时不再本地对冲。
+			if alt == nil && !g.startLoad() {
+				continue
+			}
+			hedged = true
+			pending++
+			g.Stats.HedgedLoads.Add(1)
+			if g.debugEnabled() {
+				g.logger().Debug("发出对冲请求", "group", g.name, "key", key, "peer", peerName(peer), "delay", delay)
+			}
+			go func() {
+				if alt != nil {
+					value, err := g.getFromPeer(ctx, alt, key, replica)
+					results <- loadResult{value, err, alt}
+					return
+				}
+				defer g.inflight.Done()
+				// 另一个请求可能先返回，不能写入调用者的 Sink。
+				var value ByteView
+				_, err := g.loadLocally(ctx, key, ByteViewSink(&value))
+				results <- loadResult{value, err, nil}
+			}()
+		case r = <-results:
+			pending--
+			if r.err == nil || errors.Is(r.err, ErrNotFound) || pending == 0 {
+				return r, hedged
+			}
+			if r.peer != nil {
+				g.peerLoadFailed(key, r.peer, r.err)
+			}
+		}
+	}
+}
+
+// peerLatency 返回组观测到的向 peer 发出的请求的延迟。
+func (g *Group) peerLatency(peer ProtoGetter) LatencyStats {
+	if v, ok := g.peerStats.Load(peerName(peer)); ok {
+		return v.(*peerStats).latency.snapshot()
+	}
+	return LatencyStats{}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	rateDepth  = 4       // count-min sketch 的行数
+	rateWidth  = 1 << 12 // 每行的计数器数量
+	ratePeriod = time.Minute
+)
+
+// keyRates 估计每个键最近一分钟的请求率。
+//
+// 它在每个一分钟的窗口内用 count-min sketch 计数，并按滑动窗口的方式
+// 把上一个窗口的计数按剩余比例计入，因此内存占用与键的数量无关，
+// 冷门键的估计值最多因哈希冲突而略微偏高。计数是无锁的，
+// 只有窗口轮换时才需要加锁。零值可以直接使用。
+type keyRates struct {
+	mu  sync.Mutex // 保护窗口轮换
+	cur atomic.Pointer[rateWindow]
+}
+
+// rateWindow 是一个窗口期内的 count-min sketch。
+type rateWindow struct {
+	start  time.Time
+	seed   maphash.Seed
+	prev   atomic.Pointer[rateWindow] // 上一个窗口；轮换两次后被清除
+	counts [rateDepth][rateWidth]atomic.Uint32
+}
+
+// window 返回 now 所在的窗口，必要时开始一个新窗口。
+func (r *keyRates) window(now time.Time) *rateWindow {
+	if w := r.cur.Load(); w != nil && now.Sub(w.start) < ratePeriod {
+		return w
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := r.cur.Load()
+	if w != nil && now.Sub(w.start) < ratePeriod {
+		return w
+	}
+	next := &rateWindow{start: now, seed: maphash.MakeSeed()}
+	if w != nil && now.Sub(w.start) < 2*ratePeriod {
+		// 紧接着的窗口保留上一个窗口，用于平滑估计。
+		next.start = w.start.Add(ratePeriod)
+		next.prev.Store(w)
+		w.prev.Store(nil)
+	}
+	r.cur.Store(next)
+	return next
+}
+
+// record 记录一次对键的请求。
+func (r *keyRates) record(key string, now time.Time) {
+	w := r.window(now)
+	h := maphash.String(w.seed, key)
+	h1, h2 := h, h>>32|1
+	for i := range w.counts {
+		w.counts[i][(h1+uint64(i)*h2)%rateWidth].Add(1)
+	}
+}
+
+// rate 返回键在 now 之前一分钟内的平均每秒请求数。
+func (r *keyRates) rate(key string, now time.Time) float64 {
+	w := r.window(now)
+	n := float64(w.estimate(key))
+	if prev := w.prev.Load(); prev != nil {
+		// 上一个窗口中仍落在最近一分钟内的部分。
+		frac := 1 - float64(now.Sub(w.start))/float64(ratePeriod)
+		n += frac * float64(prev.estimate(key))
+	}
+	return n / ratePeriod.Seconds()
+}
+
+func (w *rateWindow) estimate(key string) uint32 {
+	h := maphash.String(w.seed, key)
+	h1, h2 := h, h>>32|1
+	min := ^uint32(0)
+	for i := range w.counts {
+		if v := w.counts[i][(h1+uint64(i)*h2)%rateWidth].Load(); v < min {
+			min = v
+		}
+	}
+	return min
+}
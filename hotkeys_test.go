@@ -0,0 +1,65 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestKeyRates(t *testing.T) {
+	var r keyRates
+	t0 := time.Unix(1000, 0)
+	for i := 0; i < 120; i++ {
+		r.record("hot", t0)
+	}
+	for i := 0; i < 1000; i++ {
+		r.record(fmt.Sprintf("cold-%d", i), t0)
+	}
+
+	near := func(got, want float64) bool { return math.Abs(got-want) < 0.05 }
+	if got := r.rate("hot", t0); !near(got, 2) {
+		t.Errorf("rate = %v; want 2 QPS for 120 requests in a minute", got)
+	}
+	if got := r.rate("cold-1", t0); got > 0.1 {
+		t.Errorf("rate of a key requested once = %v; want about 1/60", got)
+	}
+	if got := r.rate("never", t0); got > 0.1 {
+		t.Errorf("rate of an unseen key = %v", got)
+	}
+
+	// Halfway through the next window, half of the previous window
+	// still counts.
+	if got := r.rate("hot", t0.Add(90*time.Second)); !near(got, 1) {
+		t.Errorf("rate 90s later = %v; want 1 QPS", got)
+	}
+	if got := r.rate("hot", t0.Add(3*time.Minute)); got != 0 {
+		t.Errorf("rate 3m later = %v; want 0", got)
+	}
+}
+
+func BenchmarkKeyRatesRecord(b *testing.B) {
+	var r keyRates
+	now := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.record("key", now)
+		}
+	})
+}
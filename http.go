@@ -19,13 +19,16 @@ package groupcache
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/groupcache/consistenthash"
 	pb "github.com/golang/groupcache/groupcachepb"
@@ -36,6 +39,14 @@ const defaultBasePath = "/_groupcache/"
 
 const defaultReplicas = 50
 
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 5 * time.Second
+	defaultRetryBackoff     = 10 * time.Millisecond
+	defaultRetryBudget      = 0.1
+	defaultHedgeMinDelay    = 5 * time.Millisecond
+)
+
 // HTTPPool 为一组 HTTP 对等体实现 PeerPicker。
 type HTTPPool struct {
 	// Context 可选地指定服务器在收到请求时使用的上下文。
@@ -44,7 +55,8 @@ type HTTPPool struct {
 
 	// Transport 可选地指定客户端在发出请求时
 	// 使用的 http.RoundTripper。
-	// 如果为 nil，客户端使用 http.DefaultTransport。
+	// 如果为 nil，客户端使用池为每个对等体创建的 Transport，
+	// 参见 HTTPPoolOptions.MaxIdleConnsPerPeer 和 H2C。
 	Transport func(context.Context) http.RoundTripper
 
 	// 这个对等体的基本 URL，例如 "https://example.net:8000"
@@ -53,9 +65,14 @@ type HTTPPool struct {
 	// opts 指定选项。
 	opts HTTPPoolOptions
 
-	mu          sync.Mutex // 保护 peers 和 httpGetters
-	peers       *consistenthash.Map
-	httpGetters map[string]*httpGetter // 键例如 "http://10.0.0.2:8008"
+	mu          sync.Mutex // 保护 peers、httpGetters、breakers 和 transports
+	peers       consistenthash.Picker
+	httpGetters map[string]*httpGetter       // 键例如 "http://10.0.0.2:8008"
+	breakers    map[string]*breaker          // 每个对等体的熔断器，Set 时保留
+	transports  map[string]http.RoundTripper // 每个对等体的连接池，Set 时保留
+
+	// budget 是所有对等体共享的重试预算，不限制时为空。
+	budget *retryBudget
 }
 
 // HTTPPoolOptions 是 HTTPPool 的配置。
@@ -71,6 +88,99 @@ type HTTPPoolOptions struct {
 	// HashFn 指定一致性哈希的哈希函数。
 	// 如果为空，默认为 crc32.ChecksumIEEE。
 	HashFn consistenthash.Hash
+
+	// Registry 指定池注册为 PeerPicker 并从中查找组的 Registry。
+	// 如果为空，默认为 DefaultRegistry。每个 Registry 只能有一个池。
+	Registry *Registry
+
+	// Weights 可选地指定 Set 使用的对等体权重，键为对等体的基本 URL。
+	// 权重为 n 的对等体在一致性哈希上有 n 倍的副本，分到大约 n 倍的键。
+	// 未列出的对等体权重为 1。
+	Weights map[string]int
+
+	// LoadFactor 如果不为零，启用有界负载的一致性哈希：本节点发往
+	// 某个对等体的进行中的请求超过按权重分摊的平均值的 LoadFactor 倍时，
+	// 键溢出到环上的下一个对等体。参见 consistenthash.Map.SetLoadFactor。
+	LoadFactor float64
+
+	// Picker 可选地指定把键映射到对等体的算法，每次 Set 时调用以创建
+	// 新的 Picker，例如 consistenthash.NewRendezvous 或 consistenthash.NewMaglev。
+	// 集群中的所有节点必须使用相同的算法。如果为空，默认为使用 Replicas
+	// 和 HashFn 的一致性哈希环。只有 *consistenthash.Map 支持 LoadFactor，
+	// 也只有它的 AddPeer 和 RemovePeer 返回移动的区间。
+	Picker func() consistenthash.Picker
+
+	// BreakerThreshold 指定对等体的熔断器打开所需的连续失败次数。
+	// 熔断器打开期间，PickPeer 把该对等体的键交给环上下一个可用的
+	// 对等体，轮到本节点时由本节点加载。
+	// 如果为零，默认为 5；如果为负数，不启用熔断。
+	BreakerThreshold int
+
+	// BreakerCooldown 指定熔断器打开后、放行探测请求之前等待的时间。
+	// 如果为零，默认为 5 秒。
+	BreakerCooldown time.Duration
+
+	// Retries 指定向对等体的加载请求因网络错误、超时或 5xx 响应失败时
+	// 的最大重试次数。如果为零，不重试。
+	Retries int
+
+	// RetryBackoff 指定第一次重试前等待的时间，之后每次加倍，并加上
+	// 至多一半的随机抖动。如果为零，默认为 10 毫秒。
+	RetryBackoff time.Duration
+
+	// RetryBudget 指定重试和对冲请求最多占原始加载请求的比例，由池中
+	// 所有对等体共享，使它们不会在故障时成倍放大负载。
+	// 如果为零，默认为 0.1；如果为负数，不限制。
+	RetryBudget float64
+
+	// HedgePercentile 如果不为零，启用对冲请求：向对等体的加载请求在
+	// 该对等体延迟的这个分位数（例如 0.95）之后仍未返回时，组向下一个
+	// 副本发出第二个请求，或者改为本地加载，采用先返回的结果。
+	HedgePercentile float64
+
+	// HedgeMinDelay 指定对冲前等待的最短时间，延迟的样本不足时也使用它。
+	// 如果为零，默认为 5 毫秒。
+	HedgeMinDelay time.Duration
+
+	// MaxIdleConnsPerPeer 指定与每个对等体保持的最大空闲连接数。
+	// 如果为零，默认为 64。
+	MaxIdleConnsPerPeer int
+
+	// MaxConnsPerPeer 可选地限制与每个对等体的连接总数，达到上限后
+	// 新请求等待空闲连接。如果为零，不限制。
+	MaxConnsPerPeer int
+
+	// IdleConnTimeout 指定空闲连接关闭前保持的时间。
+	// 如果为零，默认为 90 秒。
+	IdleConnTimeout time.Duration
+
+	// H2C 如果为 true，对等体之间使用不加密的 HTTP/2，发往同一个对等体
+	// 的请求复用一个连接。所有对等体的服务器必须用 H2CHandler 包装。
+	H2C bool
+
+	// PingInterval 指定 HTTP/2 连接没有收到数据多久之后发送 PING
+	// 检查连接，PING 超时的连接被关闭。
+	// 如果为零，默认为 30 秒；如果为负数，不检查。
+	PingInterval time.Duration
+
+	// MaxResponseBytes 指定对等体响应体的最大字节数，超过时加载失败，
+	// 返回 ErrResponseTooLarge。如果为零，默认为 64 MiB；如果为负数，不限制。
+	MaxResponseBytes int64
+
+	// MaxRequestBytes 指定池接受的对等体请求体（Set、GetMulti 和交接
+	// 请求）的最大字节数，超过时返回 413。
+	// 如果为零，默认为 64 MiB；如果为负数，不限制。
+	MaxRequestBytes int64
+
+	// Codecs 可选地指定对等体之间压缩 Get 响应中的值使用的编码，按
+	// 优先级排列。池向对等体请求时列出这些编码，响应对等体的请求时
+	// 使用第一个对方也接受的编码。组的 CacheCodec 与协商出的编码相同时，
+	// 缓存中压缩的值被原样发送。GetMulti 的响应不压缩。
+	Codecs []Codec
+
+	// CompressMinBytes 指定发送前压缩的值的最小字节数。
+	// 如果为零，默认为 512。
+	CompressMinBytes int
 }
 
 // NewHTTPPool 初始化对等体的 HTTP 池，并将自己注册为 PeerPicker。
@@ -83,20 +193,15 @@ func NewHTTPPool(self string) *HTTPPool {
 	return p
 }
 
-var httpPoolMade bool
-
 // NewHTTPPoolOpts 使用给定选项初始化对等体的 HTTP 池。
 // 与 NewHTTPPool 不同，此函数不将创建的池注册为 HTTP 处理程序。
 // 返回的 *HTTPPool 实现 http.Handler，必须使用 http.Handle 注册。
 func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
-	if httpPoolMade {
-		panic("groupcache: NewHTTPPool must be called only once")
-	}
-	httpPoolMade = true
-
 	p := &HTTPPool{
 		self:        self,
 		httpGetters: make(map[string]*httpGetter),
+		breakers:    make(map[string]*breaker),
+		transports:  make(map[string]http.RoundTripper),
 	}
 	if o != nil {
 		p.opts = *o
@@ -107,27 +212,261 @@ func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
 	if p.opts.Replicas == 0 {
 		p.opts.Replicas = defaultReplicas
 	}
-	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	if p.opts.Registry == nil {
+		p.opts.Registry = DefaultRegistry
+	}
+	if p.opts.BreakerThreshold == 0 {
+		p.opts.BreakerThreshold = defaultBreakerThreshold
+	}
+	if p.opts.BreakerCooldown == 0 {
+		p.opts.BreakerCooldown = defaultBreakerCooldown
+	}
+	if p.opts.RetryBackoff == 0 {
+		p.opts.RetryBackoff = defaultRetryBackoff
+	}
+	if p.opts.RetryBudget == 0 {
+		p.opts.RetryBudget = defaultRetryBudget
+	}
+	if p.opts.RetryBudget > 0 {
+		p.budget = newRetryBudget(p.opts.RetryBudget)
+	}
+	if p.opts.HedgeMinDelay == 0 {
+		p.opts.HedgeMinDelay = defaultHedgeMinDelay
+	}
+	if p.opts.MaxIdleConnsPerPeer == 0 {
+		p.opts.MaxIdleConnsPerPeer = defaultMaxIdleConnsPerPeer
+	}
+	if p.opts.IdleConnTimeout == 0 {
+		p.opts.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	switch {
+	case p.opts.PingInterval == 0:
+		p.opts.PingInterval = defaultPingInterval
+	case p.opts.PingInterval < 0:
+		p.opts.PingInterval = 0
+	}
+	if p.opts.MaxResponseBytes == 0 {
+		p.opts.MaxResponseBytes = defaultMaxResponseBytes
+	}
+	if p.opts.MaxRequestBytes == 0 {
+		p.opts.MaxRequestBytes = defaultMaxRequestBytes
+	}
+	if p.opts.CompressMinBytes == 0 {
+		p.opts.CompressMinBytes = defaultCompressMinBytes
+	}
+	p.peers = p.newPicker()
 
-	RegisterPeerPicker(func() PeerPicker { return p })
+	p.opts.Registry.RegisterPeerPicker(func() PeerPicker { return p })
 	return p
 }
 
-// Set 更新池的对等体列表。
+// Set 更新池的对等体列表，权重取自 HTTPPoolOptions.Weights。
 // 每个对等体值应该是有效的基本 URL，
-// 例如 "http://example.net:8000"。
+// 例如 "http://example.net:8000"。成员或权重变化时调用
+// Registry.PeersChanged。
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
-	p.peers.Add(peers...)
+	changed := p.set(peers, p.opts.Weights)
+	p.mu.Unlock()
+	if changed {
+		p.opts.Registry.PeersChanged()
+	}
+}
+
+// SetWeighted 与 Set 相同，但使用 weights 中的对等体及其权重，
+// 权重小于 1 的视为 1。
+func (p *HTTPPool) SetWeighted(weights map[string]int) {
+	peers := make([]string, 0, len(weights))
+	for peer := range weights {
+		peers = append(peers, peer)
+	}
+	// 按固定顺序加入环，使所有节点上哈希冲突的结果相同。
+	sort.Strings(peers)
+	p.mu.Lock()
+	changed := p.set(peers, weights)
+	p.mu.Unlock()
+	if changed {
+		p.opts.Registry.PeersChanged()
+	}
+}
+
+// AddPeer 将一个权重为 weight 的对等体加入池中，或修改已有对等体的
+// 权重，并返回因此改变所有者的哈希区间。与 Set 不同，它不重建
+// 一致性哈希环，其他对等体的 httpGetter 及其连接保持不变。
+func (p *HTTPPool) AddPeer(peer string, weight int) []consistenthash.Range {
+	p.mu.Lock()
+	changed := p.peers.Weight(peer) != max(weight, 1)
+	moved := p.peers.AddWeighted(peer, weight)
+	if p.httpGetters[peer] == nil {
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+	p.mu.Unlock()
+	if changed {
+		p.opts.Registry.PeersChanged()
+	}
+	return moved
+}
+
+// RemovePeer 从池中移除一个对等体，并返回因此改变所有者的哈希区间。
+// 对等体不在池中时返回 nil。
+func (p *HTTPPool) RemovePeer(peer string) []consistenthash.Range {
+	p.mu.Lock()
+	changed := p.peers.Weight(peer) > 0
+	delete(p.httpGetters, peer)
+	delete(p.breakers, peer)
+	p.dropTransport(peer)
+	moved := p.peers.Remove(peer)
+	p.mu.Unlock()
+	if changed {
+		p.opts.Registry.PeersChanged()
+	}
+	return moved
+}
+
+// UpdatePeers 在一次变化中从池中移除 remove 中的对等体，并加入 add 中的
+// 对等体或修改其权重，返回与变化前相比改变所有者的哈希区间。与逐个调用
+// RemovePeer 和 AddPeer 不同，它只调用一次 Registry.PeersChanged，交接
+// 按最终的成员进行，而不是按中间状态的环。
+func (p *HTTPPool) UpdatePeers(add map[string]int, remove []string) []consistenthash.Range {
+	p.mu.Lock()
+	changed := false
+	for _, peer := range remove {
+		if _, ok := add[peer]; !ok && p.peers.Weight(peer) > 0 {
+			changed = true
+		}
+	}
+	for peer, weight := range add {
+		if p.peers.Weight(peer) != max(weight, 1) {
+			changed = true
+		}
+	}
+	for _, peer := range remove {
+		delete(p.httpGetters, peer)
+		delete(p.breakers, peer)
+		p.dropTransport(peer)
+	}
+	var moved []consistenthash.Range
+	if u, ok := p.peers.(ringUpdater); ok {
+		moved = u.Update(add, remove)
+	} else {
+		for _, peer := range remove {
+			p.peers.Remove(peer)
+		}
+		for peer, weight := range add {
+			p.peers.AddWeighted(peer, weight)
+		}
+	}
+	for peer := range add {
+		if p.httpGetters[peer] == nil {
+			p.httpGetters[peer] = p.newGetter(peer)
+		}
+	}
+	p.mu.Unlock()
+	if changed {
+		p.opts.Registry.PeersChanged()
+	}
+	return moved
+}
+
+// ringUpdater 由可以在一次变化中增删多个节点的 consistenthash.Picker 实现。
+type ringUpdater interface {
+	Update(add map[string]int, remove []string) []consistenthash.Range
+}
+
+// set 用 peers 重建环，并报告成员或权重是否改变。
+func (p *HTTPPool) set(peers []string, weights map[string]int) (changed bool) {
+	// 新的对等体都已在环上、权重不变且个数相同时，成员没有变化。
+	for _, peer := range peers {
+		if p.peers.Weight(peer) != max(weights[peer], 1) {
+			changed = true
+		}
+	}
+	old := len(p.httpGetters)
+	p.peers = p.newPicker()
+	for _, peer := range peers {
+		p.peers.AddWeighted(peer, weights[peer])
+	}
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{transport: p.Transport, baseURL: peer + p.opts.BasePath}
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+	for peer := range p.breakers {
+		if p.httpGetters[peer] == nil {
+			delete(p.breakers, peer)
+		}
 	}
+	for peer := range p.transports {
+		if p.httpGetters[peer] == nil {
+			p.dropTransport(peer)
+		}
+	}
+	return changed || len(p.httpGetters) != old
+}
+
+func (p *HTTPPool) newPicker() consistenthash.Picker {
+	if p.opts.Picker != nil {
+		return p.opts.Picker()
+	}
+	m := consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	m.SetLoadFactor(p.opts.LoadFactor)
+	return m
+}
+
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	h := &httpGetter{
+		transport: p.Transport,
+		rt:        p.transportFor(peer),
+		baseURL:   peer + p.opts.BasePath,
+		peer:      peer,
+		retries:   p.opts.Retries,
+		backoff:   p.opts.RetryBackoff,
+		budget:    p.budget,
+		maxBytes:  p.opts.MaxResponseBytes,
+		codecs:    p.opts.Codecs,
+	}
+	if len(h.codecs) > 0 {
+		h.accept = codecNames(h.codecs)
+	}
+	if p.opts.BreakerThreshold > 0 && peer != p.self {
+		if p.breakers[peer] == nil {
+			p.breakers[peer] = newBreaker(peer, p.opts.BreakerThreshold, p.opts.BreakerCooldown)
+		}
+		h.breaker = p.breakers[peer]
+	}
+	if lt, ok := p.peers.(loadTracker); ok {
+		h.ring = lt
+	}
+	return h
 }
 
 func (p *HTTPPool) PickPeer(key string) (ProtoGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers.IsEmpty() {
+		return nil, false
+	}
+	peer := p.peers.Get(key)
+	if peer == p.self {
+		return nil, false
+	}
+	if h := p.httpGetters[peer]; h.breaker.ready() {
+		return h, true
+	}
+	// 所有者的熔断器打开，依次尝试它之后的副本。
+	for _, node := range p.peers.GetN(key, len(p.httpGetters))[1:] {
+		if node == p.self {
+			break
+		}
+		if h := p.httpGetters[node]; h.breaker.ready() {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// PickOwner 实现 OwnerPicker，与 PickPeer 选出同一个所有者，但
+// 不因熔断器打开而回退到其他副本。
+func (p *HTTPPool) PickOwner(key string) (ProtoGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if p.peers.IsEmpty() {
@@ -139,6 +478,68 @@ func (p *HTTPPool) PickPeer(key string) (ProtoGetter, bool) {
 	return nil, false
 }
 
+// PickPeers 实现 ReplicaPicker，按 consistenthash.Picker.GetN 的顺序
+// 返回键的至多 n 个副本，跳过熔断器打开的对等体。
+func (p *HTTPPool) PickPeers(key string, n int) []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	nodes := p.peers.GetN(key, n)
+	peers := make([]ProtoGetter, 0, len(nodes))
+	for _, node := range nodes {
+		if node == p.self {
+			peers = append(peers, nil)
+		} else if h := p.httpGetters[node]; h.breaker.ready() {
+			peers = append(peers, h)
+		}
+	}
+	return peers
+}
+
+// HedgeDelay 实现 HedgingPicker：对冲延迟是 peer 的延迟的
+// HedgePercentile 分位数，但不短于 HedgeMinDelay。
+func (p *HTTPPool) HedgeDelay(peer ProtoGetter, latency LatencyStats) (time.Duration, bool) {
+	if p.opts.HedgePercentile <= 0 {
+		return 0, false
+	}
+	delay := latency.Quantile(p.opts.HedgePercentile)
+	if delay < p.opts.HedgeMinDelay {
+		delay = p.opts.HedgeMinDelay
+	}
+	return delay, true
+}
+
+// AllowHedge 实现 HedgingPicker，从池的重试预算中扣除一次。
+func (p *HTTPPool) AllowHedge() bool {
+	return p.budget.withdraw()
+}
+
+// CircuitStats 返回当前每个对等体的熔断器的状态，键与 Group.PeerStats
+// 的相同。没有启用熔断时返回空映射。
+func (p *HTTPPool) CircuitStats() map[string]CircuitStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m := make(map[string]CircuitStats, len(p.breakers))
+	for peer, b := range p.breakers {
+		if h := p.httpGetters[peer]; h != nil {
+			m[h.String()] = b.stats()
+		}
+	}
+	return m
+}
+
+// GetAll 返回除自身以外所有对等体的 ProtoGetter。
+func (p *HTTPPool) GetAll() []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]ProtoGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			getters = append(getters, getter)
+		}
+	}
+	return getters
+}
+
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// 解析请求。
 	if !strings.HasPrefix(r.URL.Path, p.opts.BasePath) {
@@ -155,7 +556,7 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	//log.Printf("[节点 %s] ServeHTTP 接收到请求 %s", p.self, r.URL.Path)
 
 	// 获取此组/键的值。
-	group := GetGroup(groupName)
+	group := p.opts.Registry.GetGroup(groupName)
 	if group == nil {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
@@ -166,76 +567,448 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	} else {
 		ctx = r.Context()
 	}
+	ctx = ExtractTraceContext(ctx, r.Header)
+
+	// DELETE 请求只清除本地缓存，不再转发，
+	// 由发起 Remove 的对等体负责通知其他对等体。
+	if r.Method == http.MethodDelete {
+		group.localRemove(key)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// PUT 请求携带 SetRequest，本对等体作为所有者写穿该值。
+	if r.Method == http.MethodPut {
+		body, ok := p.readBody(w, r)
+		if !ok {
+			return
+		}
+		var in pb.SetRequest
+		if err := proto.Unmarshal(body, &in); err != nil {
+			http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := group.localSet(ctx, key, in.GetValue()); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// PATCH 请求携带 HandoffRequest，是其他对等体在成员变化后交来的键。
+	if r.Method == http.MethodPatch {
+		p.serveHandoff(w, r, group)
+		return
+	}
+
+	// POST 请求携带 GetMultiRequest，一次获取多个键。
+	if r.Method == http.MethodPost {
+		p.serveGetMulti(ctx, w, r, group)
+		return
+	}
 
-	group.Stats.ServerRequests.Add(1)
-	var value []byte
 	//log.Printf("[节点 %s] ServeHTTP 调用 Group %s 的 Get 方法，键: %s", p.self, groupName, key)
-	err := group.Get(ctx, key, AllocatingByteSliceSink(&value))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	enc := findCodec(p.opts.Codecs, r.Header.Get(acceptEncodingHeader))
+	value, qps, codec, err := group.serveGetView(ctx, key, enc)
+	var res *pb.GetResponse
+	switch {
+	case errors.Is(err, ErrNotFound):
+		res = &pb.GetResponse{NotFound: proto.Bool(true)}
+	case err != nil:
+		writeError(w, err)
 		return
+	default:
+		if codec == nil && enc != nil && value.Len() >= p.opts.CompressMinBytes {
+			if v := value.encode(enc); v.codec != nil {
+				value, codec = v, enc
+			}
+		}
+		if acceptsStream(r) {
+			// 值直接从缓存写到响应中，不再编码成 GetResponse。
+			writeStream(w, value, qps, codec)
+			return
+		}
+		res = &pb.GetResponse{
+			Value:     value.ByteSlice(),
+			MinuteQps: proto.Float64(qps),
+		}
+		if e := value.Expire(); !e.IsZero() {
+			res.Expire = proto.Int64(e.UnixNano())
+		}
 	}
 
 	// 将值作为 proto 消息写入响应体。
-	body, err := proto.Marshal(&pb.GetResponse{Value: value})
+	body, err := proto.Marshal(res)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Type", protoContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if codec != nil {
+		w.Header().Set(valueEncodingHeader, codec.Name())
+	}
+	if res.GetNotFound() {
+		// 用带 not_found 标记的响应体区分“键不存在”和“组不存在”。
+		w.WriteHeader(http.StatusNotFound)
+	}
 	w.Write(body)
 	//log.Printf("[节点 %s] ServeHTTP 序列化并发送响应 (protobuf) 给 %s", p.self, r.RemoteAddr)
 }
 
+// readBody 读取请求体，最多读取 MaxRequestBytes 个字节。读取失败时
+// 写入错误响应并返回 false，请求体过大时状态码为 413。
+func (p *HTTPPool) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if p.opts.MaxRequestBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, p.opts.MaxRequestBytes)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		code := http.StatusBadRequest
+		var me *http.MaxBytesError
+		if errors.As(err, &me) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, "reading request body: "+err.Error(), code)
+		return nil, false
+	}
+	return body, true
+}
+
+func (p *HTTPPool) serveGetMulti(ctx context.Context, w http.ResponseWriter, r *http.Request, group *Group) {
+	body, ok := p.readBody(w, r)
+	if !ok {
+		return
+	}
+	var in pb.GetMultiRequest
+	if err := proto.Unmarshal(body, &in); err != nil {
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := proto.Marshal(group.serveGetMulti(ctx, in.GetKeys()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", protoContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.Write(out)
+}
+
+func (p *HTTPPool) serveHandoff(w http.ResponseWriter, r *http.Request, group *Group) {
+	body, ok := p.readBody(w, r)
+	if !ok {
+		return
+	}
+	var in pb.HandoffRequest
+	if err := proto.Unmarshal(body, &in); err != nil {
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := proto.Marshal(group.serveHandoff(&in))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", protoContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.Write(out)
+}
+
+// errorHeader 标出错误响应的来源。值为 errorGetter 表示错误来自所有者的
+// Getter 或后端数据源，对等体本身是健康的。
+const (
+	errorHeader = "Groupcache-Error"
+	errorGetter = "getter"
+)
+
+// errorStatus 返回组操作错误对应的 HTTP 状态码。
+// 在请求处理期间被关闭的组与不存在的组一样得到 404；超时得到 504，
+// 被取消得到 503；Getter 或 Setter 的其他错误得到 502，
+// 本节点自身的错误（例如转发给其他对等体失败）得到 500。
+func errorStatus(err error) int {
+	var ge getterError
+	switch {
+	case errors.Is(err, ErrGroupClosed):
+		return http.StatusNotFound
+	case errors.Is(err, ErrValueTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &ge):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError 把组操作的错误写入响应，Getter 或 Setter 的错误带上
+// errorHeader，使调用者不把它计为对等体的失败。
+func writeError(w http.ResponseWriter, err error) {
+	code := errorStatus(err)
+	if code == http.StatusBadGateway {
+		w.Header().Set(errorHeader, errorGetter)
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// statusError 是对等体返回的非预期 HTTP 状态。
+type statusError struct {
+	code   int
+	status string
+	getter bool // 错误来自对等体的 Getter 或后端数据源
+}
+
+func newStatusError(res *http.Response) *statusError {
+	return &statusError{
+		code:   res.StatusCode,
+		status: res.Status,
+		getter: res.Header.Get(errorHeader) == errorGetter,
+	}
+}
+
+func (e *statusError) Error() string {
+	return "server returned: " + e.status
+}
+
+// httpGetter 实现了 ProtoGetter 的所有可选接口。
+var _ interface {
+	ProtoGetter
+	Remover
+	SetterPeer
+	MultiGetter
+	HandoffPeer
+} = (*httpGetter)(nil)
+
 type httpGetter struct {
 	transport func(context.Context) http.RoundTripper
+	rt        http.RoundTripper // 池为对等体创建的 Transport，可能为空
 	baseURL   string
+
+	// ring 是对等体所在的一致性哈希环，用于报告进行中的请求数。
+	// 其他算法不跟踪负载，ring 为空。
+	ring loadTracker
+	peer string
+
+	// breaker 是对等体的熔断器，没有启用熔断时为空。
+	breaker *breaker
+
+	// retries、backoff 和 budget 控制加载请求的重试，参见 HTTPPoolOptions。
+	retries int
+	backoff time.Duration
+	budget  *retryBudget
+
+	// maxBytes 是响应体的最大字节数，不大于零时不限制。
+	maxBytes int64
+
+	// codecs 是接受的值的编码，accept 是它们的名称。
+	codecs []Codec
+	accept string
 }
 
-var bufferPool = sync.Pool{
-	New: func() interface{} { return new(bytes.Buffer) },
+// loadTracker 由跟踪每个对等体进行中的请求数的 consistenthash.Picker 实现。
+type loadTracker interface {
+	Inc(node string)
+	Done(node string)
 }
 
-func (h *httpGetter) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
-	u := fmt.Sprintf(
-		"%v%v/%v",
-		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
-	)
-	log.Printf("httpGetter 发送 GET 请求到 %s", u)
-	req, err := http.NewRequest("GET", u, nil)
+// begin 和 end 在一致性哈希环上记录一个发往对等体的加载请求，
+// 供有界负载使用。
+func (h *httpGetter) begin() {
+	if h.ring != nil {
+		h.ring.Inc(h.peer)
+	}
+}
+
+func (h *httpGetter) end() {
+	if h.ring != nil {
+		h.ring.Done(h.peer)
+	}
+}
+
+// request 是带有组名和键的对等体请求。
+type request interface {
+	GetGroup() string
+	GetKey() string
+}
+
+// makeRequest 向对等体上 in 对应的组/键 URL 发送请求。
+func (h *httpGetter) makeRequest(ctx context.Context, method string, in request, body io.Reader) (*http.Response, error) {
+	u := h.baseURL + url.QueryEscape(in.GetGroup()) + "/" + url.QueryEscape(in.GetKey())
+	return h.do(ctx, method, u, body)
+}
+
+func (h *httpGetter) do(ctx context.Context, method, u string, body io.Reader) (*http.Response, error) {
+	if l := logger(); debugEnabled(l) {
+		l.Debug("向对等体发送请求", "peer", h.baseURL, "method", method, "url", u)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	InjectTraceContext(ctx, req.Header)
+	if method == http.MethodGet {
+		req.Header.Set("Accept", streamContentType+", "+protoContentType)
+		if h.accept != "" {
+			req.Header.Set(acceptEncodingHeader, h.accept)
+		}
 	}
-	req = req.WithContext(ctx)
 	tr := http.DefaultTransport
-	if h.transport != nil {
+	switch {
+	case h.transport != nil:
 		tr = h.transport(ctx)
+	case h.rt != nil:
+		tr = h.rt
+	}
+	return tr.RoundTrip(req)
+}
+
+func (h *httpGetter) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	return retry(ctx, h.retries, h.backoff, h.budget, func() error {
+		return h.get(ctx, in, out)
+	})
+}
+
+func (h *httpGetter) get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) (err error) {
+	if !h.breaker.acquire() {
+		return ErrCircuitOpen
+	}
+	defer func() { h.breaker.done(err) }()
+	h.begin()
+	defer h.end()
+	res, err := h.makeRequest(ctx, http.MethodGet, in, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return newStatusError(res)
+	}
+	if res.StatusCode == http.StatusOK && isStream(res) {
+		return readStream(res, h.codecs, h.maxBytes, out)
+	}
+	b, err := readBody(res, h.maxBytes)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		// 只有带 not_found 标记的 404 才表示键不存在，
+		// 其他 404（例如组不存在）仍是普通错误。
+		if unmarshalGetResponse(b, out) == nil && out.GetNotFound() {
+			return ErrNotFound
+		}
+		return newStatusError(res)
+	}
+	// 值直接引用新分配的响应体，不再复制。
+	if err := unmarshalGetResponse(b, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	if name := res.Header.Get(valueEncodingHeader); name != "" {
+		c := findCodec(h.codecs, name)
+		if c == nil {
+			return fmt.Errorf("peer used unknown value encoding %q", name)
+		}
+		// 解压到 maxBytes 为止，压缩炸弹不会被整个解压到内存中。
+		out.Value, err = decodeValue(c, out.Value, h.maxBytes)
+		return err
+	}
+	return nil
+}
+
+func (h *httpGetter) Set(ctx context.Context, in *pb.SetRequest) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	res, err := h.makeRequest(ctx, http.MethodPut, in, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return newStatusError(res)
+	}
+	return nil
+}
+
+func (h *httpGetter) Remove(ctx context.Context, in *pb.RemoveRequest) error {
+	res, err := h.makeRequest(ctx, http.MethodDelete, in, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return newStatusError(res)
 	}
-	res, err := tr.RoundTrip(req)
+	return nil
+}
+
+// GetMulti 将所有键放在一个 POST 请求中发送到对等体的组 URL。
+func (h *httpGetter) GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return retry(ctx, h.retries, h.backoff, h.budget, func() error {
+		return h.getMulti(ctx, in.GetGroup(), body, out)
+	})
+}
+
+func (h *httpGetter) getMulti(ctx context.Context, group string, body []byte, out *pb.GetMultiResponse) (err error) {
+	if !h.breaker.acquire() {
+		return ErrCircuitOpen
+	}
+	defer func() { h.breaker.done(err) }()
+	h.begin()
+	defer h.end()
+	u := h.baseURL + url.QueryEscape(group) + "/"
+	res, err := h.do(ctx, http.MethodPost, u, bytes.NewReader(body))
 	if err != nil {
-		log.Printf("httpGetter 请求 %s 失败: %v", u, err)
 		return err
 	}
 	defer res.Body.Close()
-	log.Printf("httpGetter 接收到来自 %s 的响应状态: %s", u, res.Status)
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+		return newStatusError(res)
 	}
-	b := bufferPool.Get().(*bytes.Buffer)
-	b.Reset()
-	defer bufferPool.Put(b)
-	_, err = io.Copy(b, res.Body)
+	b, err := readBody(res, h.maxBytes)
 	if err != nil {
-		log.Printf("httpGetter 读取 %s 的响应体失败: %v", u, err)
-		return fmt.Errorf("reading response body: %v", err)
+		return err
+	}
+	if err := proto.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
 	}
-	err = proto.Unmarshal(b.Bytes(), out)
+	return nil
+}
+
+// Handoff 将条目放在一个 PATCH 请求中发送到对等体的组 URL。
+// 交接不是加载请求，不重试，也不计入熔断器。
+func (h *httpGetter) Handoff(ctx context.Context, in *pb.HandoffRequest, out *pb.HandoffResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	u := h.baseURL + url.QueryEscape(in.GetGroup()) + "/"
+	res, err := h.do(ctx, http.MethodPatch, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return newStatusError(res)
+	}
+	b, err := readBody(res, h.maxBytes)
 	if err != nil {
-		log.Printf("httpGetter 解析来自 %s 的 protobuf 响应失败: %v", u, err)
+		return err
+	}
+	if err := proto.Unmarshal(b, out); err != nil {
 		return fmt.Errorf("decoding response body: %v", err)
 	}
-	log.Printf("httpGetter 解析来自 %s 的 protobuf 响应成功", u)
 	return nil
 }
+
+// String 返回对等体的基础 URL，用于在统计信息中标识对等体。
+func (h *httpGetter) String() string {
+	return h.baseURL
+}
@@ -17,19 +17,29 @@ limitations under the License.
 package groupcache
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/golang/groupcache/consistenthash"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
 )
 
 var (
@@ -101,6 +111,239 @@ func TestHTTPPool(t *testing.T) {
 		}
 		t.Logf("Get key=%q, value=%q (peer:key)", key, value)
 	}
+
+	// Remove reaches the owner and every other child.
+	for _, key := range testKeys(10) {
+		if err := g.Remove(context.TODO(), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Set is written through by the owner and visible to later Gets.
+	for _, key := range testKeys(10) {
+		if err := g.Set(context.TODO(), key, []byte("set:"+key)); err != nil {
+			t.Fatal(err)
+		}
+		var value string
+		if err := g.Get(context.TODO(), key, StringSink(&value)); err != nil {
+			t.Fatal(err)
+		}
+		if want := "set:" + key; value != want {
+			t.Errorf("Get(%q) after Set = %q, want %q", key, value, want)
+		}
+	}
+
+	// Not-found answers come back as ErrNotFound rather than a
+	// generic server error.
+	var missing string
+	if err := g.Get(context.TODO(), "missing", StringSink(&missing)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+
+	// GetMulti batches keys per child and sees the same values as Get.
+	keys := testKeys(nGets)
+	values := make([]string, len(keys))
+	dests := make([]Sink, len(keys))
+	for i := range keys {
+		dests[i] = StringSink(&values[i])
+	}
+	for i, err := range g.GetMulti(context.TODO(), keys, dests) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if suffix := ":" + keys[i]; !strings.HasSuffix(values[i], suffix) {
+			t.Errorf("GetMulti(%q) = %q, want value ending in %q", keys[i], values[i], suffix)
+		}
+	}
+}
+
+// TestHTTPPoolRegistries runs a cluster of HTTPPools in one process, each
+// node with its own Registry.
+func TestHTTPPoolRegistries(t *testing.T) {
+	const nNodes = 3
+	var (
+		pools   [nNodes]*HTTPPool
+		groups  [nNodes]*Group
+		loads   [nNodes]AtomicInt
+		servers [nNodes]*httptest.Server
+		urls    []string
+	)
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pools[i].ServeHTTP(w, r)
+		}))
+		defer servers[i].Close()
+		urls = append(urls, servers[i].URL)
+	}
+	for i := range pools {
+		i := i
+		reg := NewRegistry()
+		pools[i] = NewHTTPPoolOpts(urls[i], &HTTPPoolOptions{Registry: reg})
+		pools[i].Set(urls...)
+		groups[i] = reg.NewGroup("registryTest", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			loads[i].Add(1)
+			return dest.SetString(strconv.Itoa(i) + ":" + key)
+		}))
+	}
+	if GetGroup("registryTest") != nil {
+		t.Error("group of a private Registry is visible in DefaultRegistry")
+	}
+
+	// Every node sees the value loaded by the key's single owner.
+	for _, key := range testKeys(50) {
+		var first string
+		for i, g := range groups {
+			var value string
+			if err := g.Get(context.TODO(), key, StringSink(&value)); err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				first = value
+			} else if value != first {
+				t.Errorf("node %d: Get(%q) = %q; node 0 got %q", i, key, value, first)
+			}
+		}
+	}
+	var total int64
+	for i := range loads {
+		total += loads[i].Get()
+	}
+	if total != 50 {
+		t.Errorf("getters ran %d times; want each of the 50 keys loaded once", total)
+	}
+}
+
+func TestHTTPPoolDeregisteredGroup(t *testing.T) {
+	reg := NewRegistry()
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: reg})
+	reg.NewGroup("deregisterTest", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	}))
+
+	get := func() int {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "/_groupcache/deregisterTest/key", nil))
+		return w.Code
+	}
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("status = %d before DeregisterGroup; want 200", code)
+	}
+	reg.DeregisterGroup("deregisterTest")
+	if code := get(); code != http.StatusNotFound {
+		t.Errorf("status = %d after DeregisterGroup; want 404", code)
+	}
+}
+
+func TestHTTPPoolMaxRequestBytes(t *testing.T) {
+	reg := NewRegistry()
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: reg, MaxRequestBytes: 64})
+	reg.NewGroup("maxRequestBytes", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	}))
+
+	small, _ := proto.Marshal(&pb.GetMultiRequest{Keys: []string{"a", "b"}})
+	large, _ := proto.Marshal(&pb.SetRequest{Value: make([]byte, 100)})
+	for _, tc := range []struct {
+		method string
+		body   []byte
+		code   int
+	}{
+		{"POST", small, http.StatusOK},
+		{"POST", large, http.StatusRequestEntityTooLarge},
+		{"PUT", large, http.StatusRequestEntityTooLarge},
+		{"PATCH", large, http.StatusRequestEntityTooLarge},
+	} {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(tc.method, "/_groupcache/maxRequestBytes/key", bytes.NewReader(tc.body)))
+		if w.Code != tc.code {
+			t.Errorf("%s with %d bytes: status = %d; want %d", tc.method, len(tc.body), w.Code, tc.code)
+		}
+	}
+}
+
+func TestHTTPPoolBoundedLoad(t *testing.T) {
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry(), LoadFactor: 1.25})
+	p.SetWeighted(map[string]int{"http://self": 1, "http://a": 2, "http://b": 0})
+	if w := p.peers.Weight("http://a"); w != 2 {
+		t.Errorf("weight of a = %d; want 2", w)
+	}
+
+	// Find a key owned by a peer, and keep two requests to it in flight.
+	var (
+		key   string
+		owner ProtoGetter
+	)
+	for _, k := range testKeys(100) {
+		if peer, ok := p.PickPeer(k); ok {
+			key, owner = k, peer
+			break
+		}
+	}
+	if owner == nil {
+		t.Fatal("no key is owned by a peer")
+	}
+	h := owner.(*httpGetter)
+	h.begin()
+	h.begin()
+	if peer, ok := p.PickPeer(key); ok && peer == owner {
+		t.Errorf("PickPeer(%q) returned owner %v with requests in flight; want a spill", key, owner)
+	}
+	h.end()
+	h.end()
+	if peer, _ := p.PickPeer(key); peer != owner {
+		t.Errorf("PickPeer(%q) = %v after the requests finished; want %v", key, peer, owner)
+	}
+}
+
+func TestHTTPPoolAddRemovePeer(t *testing.T) {
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry()})
+	p.AddPeer("http://self", 1)
+	if moved := p.AddPeer("http://a", 1); len(moved) == 0 {
+		t.Error("adding a second peer moved no ranges")
+	}
+	a := p.httpGetters["http://a"]
+
+	moved := p.AddPeer("http://b", 2)
+	ring := p.peers.(*consistenthash.Map)
+	if p.httpGetters["http://a"] != a {
+		t.Error("AddPeer replaced the getter of an existing peer")
+	}
+	for _, key := range testKeys(200) {
+		peer, _ := p.PickPeer(key)
+		moving := false
+		for _, r := range moved {
+			moving = moving || r.Contains(ring.Hash(key))
+		}
+		if onB := peer == ProtoGetter(p.httpGetters["http://b"]); onB != moving {
+			t.Errorf("key %q: on b = %v, in moved ranges = %v", key, onB, moving)
+		}
+	}
+
+	for _, r := range p.RemovePeer("http://b") {
+		if r.From != "http://b" {
+			t.Errorf("removing b moved range %+v", r)
+		}
+	}
+	for _, key := range testKeys(200) {
+		if peer, ok := p.PickPeer(key); ok && peer != ProtoGetter(a) {
+			t.Errorf("PickPeer(%q) = %v after removing b; want a or self", key, peer)
+		}
+	}
+	if p.RemovePeer("http://b") != nil {
+		t.Error("removing a missing peer moved ranges")
+	}
+
+	// UpdatePeers replaces a with c in one step.
+	moved = p.UpdatePeers(map[string]int{"http://c": 1}, []string{"http://a"})
+	if len(moved) == 0 || p.httpGetters["http://a"] != nil || p.httpGetters["http://c"] == nil {
+		t.Fatalf("UpdatePeers moved %d ranges, getters %v", len(moved), p.httpGetters)
+	}
+	for _, r := range moved {
+		if r.To == "http://a" || r.From == "http://c" {
+			t.Errorf("replacing a with c moved range %+v", r)
+		}
+	}
 }
 
 func testKeys(n int) (keys []string) {
@@ -117,15 +360,36 @@ func beChildForTestHTTPPool() {
 	p := NewHTTPPool("http://" + addrs[*peerIndex])
 	p.Set(addrToURL(addrs)...)
 
-	getter := GetterFunc(func(ctx context.Context, key string, dest Sink) error {
-		dest.SetString(strconv.Itoa(*peerIndex) + ":" + key)
-		return nil
-	})
-	NewGroup("httpPoolTest", 1<<20, getter)
+	NewGroup("httpPoolTest", 1<<20, &childStore{m: make(map[string]string)})
 
 	log.Fatal(http.ListenAndServe(addrs[*peerIndex], p))
 }
 
+// childStore is the Getter and Setter of a TestHTTPPool child.
+type childStore struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func (s *childStore) Get(ctx context.Context, key string, dest Sink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.m[key]; ok {
+		return dest.SetString(v)
+	}
+	if key == "missing" {
+		return ErrNotFound
+	}
+	return dest.SetString(strconv.Itoa(*peerIndex) + ":" + key)
+}
+
+func (s *childStore) Set(ctx context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = string(value)
+	return nil
+}
+
 // This is racy. Another process could swoop in and steal the port between the
 // call to this function and the next listen call. Should be okay though.
 // The proper way would be to pass the l.File() as ExtraFiles to the child
@@ -165,3 +429,634 @@ func awaitAddrReady(t *testing.T, addr string, wg *sync.WaitGroup) {
 		time.Sleep(delay)
 	}
 }
+
+// TestHTTPPoolPicker checks that pools using another algorithm agree on the
+// owners regardless of the order of their peer lists.
+func TestHTTPPoolPicker(t *testing.T) {
+	peers := []string{"http://a", "http://b", "http://c"}
+	newPool := func(self string) *HTTPPool {
+		return NewHTTPPoolOpts(self, &HTTPPoolOptions{
+			Registry:   NewRegistry(),
+			LoadFactor: 1.25, // ignored by rendezvous hashing
+			Picker:     func() consistenthash.Picker { return consistenthash.NewRendezvous(nil) },
+		})
+	}
+	a, b := newPool("http://a"), newPool("http://b")
+	a.Set(peers...)
+	b.Set(peers[2], peers[1], peers[0])
+	if _, ok := a.peers.(*consistenthash.Rendezvous); !ok {
+		t.Fatalf("peers = %T; want *consistenthash.Rendezvous", a.peers)
+	}
+	for _, key := range testKeys(100) {
+		pa, okA := a.PickPeer(key)
+		pb, okB := b.PickPeer(key)
+		owner := func(g ProtoGetter, ok bool, self string) string {
+			if !ok {
+				return self
+			}
+			return g.(*httpGetter).peer
+		}
+		if oa, ob := owner(pa, okA, "http://a"), owner(pb, okB, "http://b"); oa != ob {
+			t.Errorf("key %q: owner is %q on a and %q on b", key, oa, ob)
+		}
+		if okA && pa.(*httpGetter).ring != nil {
+			t.Errorf("key %q: getter tracks load without a ring", key)
+		}
+	}
+	if moved := a.AddPeer("http://d", 1); moved != nil {
+		t.Errorf("AddPeer moved ranges %v; want nil", moved)
+	}
+}
+
+// TestHTTPPoolReplicas runs three nodes with a replication factor of two and
+// checks that when the owner fails, the caller fails over to the secondary
+// replica, which loads the key and keeps it, instead of loading it itself.
+func TestHTTPPoolReplicas(t *testing.T) {
+	const n = 3
+	var (
+		pools  [n]*HTTPPool
+		groups [n]*Group
+		down   [n]atomic.Bool
+		loads  [n]atomic.Int64
+		urls   []string
+	)
+	for i := 0; i < n; i++ {
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if down[i].Load() {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+				return
+			}
+			pools[i].ServeHTTP(w, r)
+		}))
+		defer ts.Close()
+		urls = append(urls, ts.URL)
+	}
+	for i := range pools {
+		i := i
+		reg := NewRegistry()
+		pools[i] = NewHTTPPoolOpts(urls[i], &HTTPPoolOptions{Registry: reg})
+		pools[i].Set(urls...)
+		groups[i] = reg.NewGroupOpts("replicas", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			loads[i].Add(1)
+			return dest.SetString("value:" + key)
+		}), &GroupOptions{ReplicationFactor: 2, HotKeyQPS: -1})
+	}
+	index := func(url string) int {
+		for i, u := range urls {
+			if u == url {
+				return i
+			}
+		}
+		t.Fatalf("unknown peer %q", url)
+		return -1
+	}
+	replicas := func(key string) (primary, secondary, caller int) {
+		nodes := pools[0].peers.GetN(key, 2)
+		primary, secondary = index(nodes[0]), index(nodes[1])
+		return primary, secondary, 3 - primary - secondary
+	}
+	get := func(i int, key string) {
+		t.Helper()
+		var s string
+		if err := groups[i].Get(dummyCtx, key, StringSink(&s)); err != nil || s != "value:"+key {
+			t.Fatalf("node %d: Get(%q) = %q, %v", i, key, s, err)
+		}
+	}
+	wantLoads := func(want [n]int64) {
+		t.Helper()
+		for i := range loads {
+			if got := loads[i].Load(); got != want[i] {
+				t.Fatalf("node %d loaded %d times; want %d (all %v)", i, got, want[i], want)
+			}
+		}
+	}
+
+	const key = "replicated"
+	primary, secondary, caller := replicas(key)
+	var want [n]int64
+	get(caller, key)
+	want[primary]++
+	wantLoads(want)
+
+	// With the owner down, the secondary loads the key once and then serves it
+	// from its mainCache.
+	down[primary].Store(true)
+	get(caller, key)
+	get(caller, key)
+	want[secondary]++
+	wantLoads(want)
+	if _, ok := groups[secondary].mainCache.get(key); !ok {
+		t.Error("secondary replica did not keep the key in mainCache")
+	}
+	if got := groups[caller].Stats.FailoverLoads.Get(); got != 2 {
+		t.Errorf("caller FailoverLoads = %d; want 2", got)
+	}
+
+	// Only when every replica is down does the caller load the key.
+	down[secondary].Store(true)
+	get(caller, key)
+	want[caller]++
+	wantLoads(want)
+	down[primary].Store(false)
+	down[secondary].Store(false)
+
+	// A secondary keeps a value fetched from the owner in mainCache rather
+	// than hotCache.
+	var key2 string
+	for i := 0; ; i++ {
+		key2 = "key2-" + strconv.Itoa(i)
+		if p, s, _ := replicas(key2); p == primary && s == secondary {
+			break
+		}
+	}
+	get(secondary, key2)
+	if _, ok := groups[secondary].mainCache.get(key2); !ok {
+		t.Error("secondary did not keep a value fetched from the owner in mainCache")
+	}
+	if loads[secondary].Load() != want[secondary] {
+		t.Error("secondary loaded a key the owner could serve")
+	}
+}
+
+// TestHTTPPoolCircuitBreaker checks that a failing peer stops receiving
+// requests once its circuit opens, that its keys are loaded locally in the
+// meantime, and that a successful probe closes the circuit again.
+func TestHTTPPoolCircuitBreaker(t *testing.T) {
+	var (
+		healthy  atomic.Bool
+		requests atomic.Int64
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		body, _ := proto.Marshal(&pb.GetResponse{Value: []byte("remote")})
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	reg := NewRegistry()
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+		Registry:         reg,
+		BreakerThreshold: 2,
+		BreakerCooldown:  50 * time.Millisecond,
+	})
+	p.Set("http://self", ts.URL)
+	g := reg.NewGroupOpts("circuit", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), &GroupOptions{HotKeyQPS: -1, NotFoundTTL: -1})
+
+	var remoteKeys []string
+	for _, key := range testKeys(100) {
+		if _, ok := p.PickPeer(key); ok {
+			remoteKeys = append(remoteKeys, key)
+		}
+	}
+	if len(remoteKeys) < 6 {
+		t.Fatalf("only %d of 100 keys are owned by the peer", len(remoteKeys))
+	}
+	for _, key := range remoteKeys[:5] {
+		var s string
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil || s != "local" {
+			t.Fatalf("Get(%q) = %q, %v; want local fallback", key, s, err)
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("failing peer got %d requests; want 2 before the circuit opened", n)
+	}
+	if _, ok := p.PickPeer(remoteKeys[0]); ok {
+		t.Error("PickPeer chose a peer with an open circuit")
+	}
+	// Set still goes to the owner rather than being written locally.
+	if err := g.Set(dummyCtx, remoteKeys[0], []byte("v")); err == nil {
+		t.Error("Set to a failing owner succeeded")
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("failing peer got %d requests; want the Set to reach it", n)
+	}
+	name := p.httpGetters[ts.URL].String()
+	if st := p.CircuitStats()[name]; st.State != CircuitOpen || st.Opens != 1 {
+		t.Errorf("CircuitStats()[%q] = %+v; want open", name, st)
+	}
+
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	var s string
+	if err := g.Get(dummyCtx, remoteKeys[5], StringSink(&s)); err != nil || s != "remote" {
+		t.Fatalf("probe Get = %q, %v; want remote", s, err)
+	}
+	if st := p.CircuitStats()[name]; st.State != CircuitClosed {
+		t.Errorf("after a successful probe state = %v; want closed", st.State)
+	}
+
+	// Set keeps the circuit state of peers that stay.
+	p.Set("http://self", ts.URL)
+	if st := p.CircuitStats()[name]; st.Opens != 1 {
+		t.Errorf("after Set opens = %d; want 1", st.Opens)
+	}
+}
+
+// TestHTTPPoolGetterErrors checks that an owner whose Getter fails is not
+// treated as an unhealthy peer.
+func TestHTTPPoolGetterErrors(t *testing.T) {
+	var (
+		server   *HTTPPool
+		requests atomic.Int64
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		server.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	reg := NewRegistry()
+	server = NewHTTPPoolOpts(ts.URL, &HTTPPoolOptions{Registry: reg})
+	reg.NewGroup("getterErrors", 1<<20, GetterFunc(func(context.Context, string, Sink) error {
+		return errors.New("backend down")
+	}))
+
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry(), BreakerThreshold: 2, Retries: 3})
+	p.Set(ts.URL)
+	peer, _ := p.PickPeer("key")
+	for i := 0; i < 5; i++ {
+		err := peer.Get(dummyCtx, &pb.GetRequest{Group: proto.String("getterErrors"), Key: proto.String("key")}, &pb.GetResponse{})
+		var se *statusError
+		if !errors.As(err, &se) || se.code != http.StatusBadGateway || !se.getter {
+			t.Fatalf("Get = %v; want a 502 getter error", err)
+		}
+	}
+	if st := p.CircuitStats()[peer.(*httpGetter).String()]; st.State != CircuitClosed || st.ConsecutiveFailures != 0 {
+		t.Errorf("CircuitStats = %+v; want closed without failures", st)
+	}
+	if n := requests.Load(); n != 5 {
+		t.Errorf("owner got %d requests for 5 Gets; want Getter errors not retried", n)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	backend := errors.New("backend down")
+	for _, tc := range []struct {
+		err    error
+		code   int
+		getter bool
+	}{
+		{getterError{backend}, http.StatusBadGateway, true},
+		{getterError{context.DeadlineExceeded}, http.StatusGatewayTimeout, false},
+		{fmt.Errorf("forward: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, false},
+		{context.Canceled, http.StatusServiceUnavailable, false},
+		{getterError{ErrValueTooLarge}, http.StatusRequestEntityTooLarge, false},
+		{ErrGroupClosed, http.StatusNotFound, false},
+		{&statusError{code: 503, status: "503 Service Unavailable"}, http.StatusInternalServerError, false},
+		{backend, http.StatusInternalServerError, false},
+	} {
+		w := httptest.NewRecorder()
+		writeError(w, tc.err)
+		if w.Code != tc.code || (w.Header().Get(errorHeader) == errorGetter) != tc.getter {
+			t.Errorf("writeError(%v) = %d, %s %q; want %d, getter %v", tc.err, w.Code, errorHeader, w.Header().Get(errorHeader), tc.code, tc.getter)
+		}
+	}
+
+	// Callers of the group get the Getter's own error back.
+	g := NewRegistry().NewGroup("errorStatus", 1<<20, GetterFunc(func(context.Context, string, Sink) error {
+		return backend
+	}))
+	var s string
+	if err := g.Get(dummyCtx, "key", StringSink(&s)); err != backend {
+		t.Errorf("Get = %#v; want the Getter's error", err)
+	}
+	if errs := g.GetMulti(dummyCtx, []string{"key"}, []Sink{StringSink(&s)}); errs[0] != backend {
+		t.Errorf("GetMulti = %#v; want the Getter's error", errs[0])
+	}
+}
+
+func TestHTTPPoolRetries(t *testing.T) {
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := proto.Marshal(&pb.GetResponse{Value: []byte("remote")})
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+		Registry:     NewRegistry(),
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+	})
+	p.Set(ts.URL)
+	peer, _ := p.PickPeer("key")
+	res := &pb.GetResponse{}
+	if err := peer.Get(dummyCtx, &pb.GetRequest{Group: proto.String("g"), Key: proto.String("key")}, res); err != nil || string(res.Value) != "remote" {
+		t.Fatalf("Get = %q, %v; want success after retries", res.Value, err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("peer got %d requests; want 3", n)
+	}
+}
+
+// TestHTTPPoolHedging checks that a slow owner is hedged, first with the next
+// replica and otherwise with a local load, and that the slow request is
+// cancelled once the hedge wins.
+func TestHTTPPoolHedging(t *testing.T) {
+	var cancelled atomic.Int64
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			cancelled.Add(1)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := proto.Marshal(&pb.GetResponse{Value: []byte("replica")})
+		w.Write(body)
+	}))
+	defer fast.Close()
+
+	for _, tc := range []struct {
+		name              string
+		peers             []string
+		replicationFactor int
+		want              string
+	}{
+		{"local", []string{"http://self", slow.URL}, 1, "local"},
+		{"replica", []string{"http://self", slow.URL, fast.URL}, 2, "replica"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := NewRegistry()
+			p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+				Registry:        reg,
+				HedgePercentile: 0.95,
+				HedgeMinDelay:   20 * time.Millisecond,
+			})
+			p.Set(tc.peers...)
+			g := reg.NewGroupOpts("hedge-"+tc.name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+				return dest.SetString("local")
+			}), &GroupOptions{ReplicationFactor: tc.replicationFactor, HotKeyQPS: -1})
+
+			// Find a key the slow peer owns; with replication, one whose
+			// secondary is the fast peer.
+			var key string
+			for _, k := range testKeys(200) {
+				if nodes := p.peers.GetN(k, 2); nodes[0] == slow.URL && (tc.replicationFactor == 1 || nodes[1] == fast.URL) {
+					key = k
+					break
+				}
+			}
+			if key == "" {
+				t.Fatal("no key with the wanted owners")
+			}
+			before := cancelled.Load()
+			start := time.Now()
+			var s string
+			if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil || s != tc.want {
+				t.Fatalf("Get = %q, %v; want %q", s, err, tc.want)
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("hedged Get took %v", d)
+			}
+			if n := g.Stats.HedgedLoads.Get(); n != 1 {
+				t.Errorf("HedgedLoads = %d; want 1", n)
+			}
+			deadline := time.Now().Add(time.Second)
+			for cancelled.Load() == before && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			if cancelled.Load() == before {
+				t.Error("the slow request was not cancelled")
+			}
+		})
+	}
+}
+
+// TestHTTPPoolHedgeLocalLoser checks that a local hedge that loses to the
+// owner is cancelled without being counted as a failed load, and that Close
+// waits for it to finish.
+func TestHTTPPoolHedgeLocalLoser(t *testing.T) {
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		body, _ := proto.Marshal(&pb.GetResponse{Value: []byte("remote")})
+		w.Write(body)
+	}))
+	defer owner.Close()
+
+	reg := NewRegistry()
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+		Registry:        reg,
+		HedgePercentile: 0.95,
+		HedgeMinDelay:   20 * time.Millisecond,
+	})
+	p.Set("http://self", owner.URL)
+	started := make(chan bool)
+	var finished atomic.Bool
+	g := reg.NewGroupOpts("hedge-loser", 1<<20, GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		started <- true
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+		return ctx.Err()
+	}), &GroupOptions{HotKeyQPS: -1})
+
+	var key string
+	for _, k := range testKeys(200) {
+		if peer, ok := p.PickPeer(k); ok && peerName(peer) == owner.URL+defaultBasePath {
+			key = k
+			break
+		}
+	}
+	if key == "" {
+		t.Fatal("no key owned by the peer")
+	}
+	var s string
+	if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil || s != "remote" {
+		t.Fatalf("Get = %q, %v; want remote", s, err)
+	}
+	<-started
+	g.Close()
+	if !finished.Load() {
+		t.Error("Close returned before the hedged local load finished")
+	}
+	if n := g.Stats.LocalLoadErrs.Get(); n != 0 {
+		t.Errorf("LocalLoadErrs = %d; want 0 for a cancelled hedge", n)
+	}
+}
+
+// TestHTTPPoolH2C checks that an H2C pool talks HTTP/2 to a peer wrapped in
+// H2CHandler and keeps the peer's transport across Set.
+func TestHTTPPoolH2C(t *testing.T) {
+	var proto2 atomic.Int64
+	ts := httptest.NewServer(H2CHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			proto2.Add(1)
+		}
+		body, _ := proto.Marshal(&pb.GetResponse{Value: []byte("remote")})
+		w.Write(body)
+	})))
+	defer ts.Close()
+
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry(), H2C: true})
+	p.Set(ts.URL)
+	tr := p.transports[ts.URL]
+	peer, _ := p.PickPeer("key")
+	res := &pb.GetResponse{}
+	if err := peer.Get(dummyCtx, &pb.GetRequest{Group: proto.String("g"), Key: proto.String("key")}, res); err != nil || string(res.Value) != "remote" {
+		t.Fatalf("Get = %q, %v; want remote", res.Value, err)
+	}
+	if proto2.Load() != 1 {
+		t.Error("request was not sent over HTTP/2")
+	}
+	p.Set(ts.URL, "http://other")
+	if p.transports[ts.URL] != tr {
+		t.Error("Set replaced the transport of a peer that stayed")
+	}
+	p.RemovePeer(ts.URL)
+	if _, ok := p.transports[ts.URL]; ok {
+		t.Error("RemovePeer kept the transport")
+	}
+}
+
+func TestHTTPPoolMaxResponseBytes(t *testing.T) {
+	value := []byte(strings.Repeat("x", 2048))
+	for _, chunked := range []bool{false, true} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := proto.Marshal(&pb.GetResponse{Value: value})
+			if chunked {
+				// Flushing before the body forces chunked encoding.
+				w.(http.Flusher).Flush()
+			} else {
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			}
+			w.Write(body)
+		}))
+		for _, max := range []int64{1024, -1} {
+			p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry(), MaxResponseBytes: max})
+			p.Set(ts.URL)
+			peer, _ := p.PickPeer("key")
+			res := &pb.GetResponse{}
+			err := peer.Get(dummyCtx, &pb.GetRequest{Group: proto.String("g"), Key: proto.String("key")}, res)
+			switch {
+			case max > 0 && err != ErrResponseTooLarge:
+				t.Errorf("chunked=%v: Get = %v; want ErrResponseTooLarge", chunked, err)
+			case max < 0 && (err != nil || len(res.Value) != len(value)):
+				t.Errorf("chunked=%v unlimited: Get = %d bytes, %v", chunked, len(res.Value), err)
+			}
+			if st := p.CircuitStats()[peer.(*httpGetter).String()]; st.ConsecutiveFailures != 0 {
+				t.Errorf("chunked=%v: a large response counted as a peer failure", chunked)
+			}
+		}
+		ts.Close()
+	}
+}
+
+func TestUnmarshalGetResponse(t *testing.T) {
+	for _, want := range []*pb.GetResponse{
+		{},
+		{Value: []byte("value"), MinuteQps: proto.Float64(1.5), Expire: proto.Int64(-7)},
+		{NotFound: proto.Bool(true)},
+	} {
+		b, err := proto.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// An unknown field must be skipped.
+		b = append(b, 0x2a, 1, 'u')
+		got := &pb.GetResponse{Value: []byte("stale")}
+		if err := unmarshalGetResponse(b, got); err != nil {
+			t.Fatalf("unmarshalGetResponse(%v) = %v", want, err)
+		}
+		if !proto.Equal(got, want) {
+			t.Errorf("unmarshalGetResponse = %v; want %v", got, want)
+		}
+		if len(got.Value) > 0 && &got.Value[0] != &b[2] {
+			t.Error("Value was copied out of the response body")
+		}
+	}
+	if err := unmarshalGetResponse([]byte{0x0a, 5, 'v'}, &pb.GetResponse{}); err == nil {
+		t.Error("truncated message decoded without error")
+	}
+}
+
+// legacyGet is httpGetter.Get as it was before per-peer transports, kept to
+// compare against in BenchmarkHTTPGetterGet.
+func legacyGet(ctx context.Context, baseURL string, in *pb.GetRequest, out *pb.GetResponse) error {
+	u := fmt.Sprintf("%v%v/%v", baseURL, url.QueryEscape(in.GetGroup()), url.QueryEscape(in.GetKey()))
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultTransport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.New("server returned: " + res.Status)
+	}
+	b := legacyBufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	defer legacyBufferPool.Put(b)
+	if _, err := io.Copy(b, res.Body); err != nil {
+		return err
+	}
+	return proto.Unmarshal(b.Bytes(), out)
+}
+
+var legacyBufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func BenchmarkHTTPGetterGet(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10} {
+		value := make([]byte, size)
+		reg := NewRegistry()
+		reg.NewGroup("bench", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			return dest.SetBytes(value)
+		}))
+		var server *HTTPPool
+		ts := httptest.NewServer(H2CHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			server.ServeHTTP(w, r)
+		})))
+		server = NewHTTPPoolOpts(ts.URL, &HTTPPoolOptions{Registry: reg})
+		server.Set(ts.URL)
+
+		get := func(b *testing.B, fn func(in *pb.GetRequest, out *pb.GetResponse) error) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.RunParallel(func(tpb *testing.PB) {
+				in := &pb.GetRequest{Group: proto.String("bench"), Key: proto.String("key")}
+				for tpb.Next() {
+					out := &pb.GetResponse{}
+					if err := fn(in, out); err != nil || len(out.Value) != size {
+						b.Errorf("Get = %d bytes, %v", len(out.Value), err)
+						return
+					}
+				}
+			})
+		}
+		b.Run(fmt.Sprintf("legacy/%dKB", size>>10), func(b *testing.B) {
+			get(b, func(in *pb.GetRequest, out *pb.GetResponse) error {
+				return legacyGet(dummyCtx, ts.URL+defaultBasePath, in, out)
+			})
+		})
+		for _, h2c := range []bool{false, true} {
+			name := "pooled"
+			if h2c {
+				name = "h2c"
+			}
+			p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry(), H2C: h2c})
+			p.Set(ts.URL)
+			h, _ := p.PickPeer("key")
+			b.Run(fmt.Sprintf("%s/%dKB", name, size>>10), func(b *testing.B) {
+				get(b, func(in *pb.GetRequest, out *pb.GetResponse) error {
+					return h.Get(dummyCtx, in, out)
+				})
+			})
+		}
+		ts.Close()
+	}
+}
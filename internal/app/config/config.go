@@ -2,9 +2,12 @@ package config
 
 import (
 	"log"
+	"log/slog"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // AppConfig 保存应用程序的配置
@@ -21,6 +24,24 @@ type AppConfig struct {
 	InitialPeerApiAddrs []string
 	// SourceappServiceURL 是 sourceapp 服务的URL，例如 http://localhost:8086
 	SourceappServiceURL string
+	// CacheTTL 是缓存条目的过期时间，零表示永不过期
+	CacheTTL time.Duration
+	// LogLevel 是 groupcache 日志的最低级别，可以是 debug、info、warn 或 error
+	LogLevel slog.Level
+	// NodeWeight 是此节点在一致性哈希上的权重，较大的节点可以分到更多的键
+	NodeWeight int
+	// LoadFactor 启用有界负载的一致性哈希时的负载系数，零表示不启用
+	LoadFactor float64
+	// ReplicationFactor 是每个键的副本数，所有者失败时依次从其余副本加载
+	ReplicationFactor int
+	// CompressValues 为 true 时，值在缓存中和对等体之间以 gzip 压缩
+	CompressValues bool
+	// HandoffBytesPerSecond 是成员变化后每秒交给新所有者的缓存字节数，零表示不交接
+	HandoffBytesPerSecond int64
+	// SnapshotPath 是缓存快照文件的路径，优雅关闭时写入、启动时恢复，空表示不启用
+	SnapshotPath string
+	// SnapshotRestoreDelay 是启动后等待对等节点发现完成、再恢复快照的时间
+	SnapshotRestoreDelay time.Duration
 }
 
 // 获取默认内网IP
@@ -119,13 +140,77 @@ func LoadConfig() *AppConfig {
 
 	sourceappURL := getEnvOrDefault("SOURCEAPP_SERVICE_URL", "http://192.168.0.21:8086")
 
+	cacheTTL, err := time.ParseDuration(getEnvOrDefault("CACHE_TTL", "0s"))
+	if err != nil {
+		log.Printf("CACHE_TTL 格式无效: %v, 使用默认值: 永不过期", err)
+		cacheTTL = 0
+	}
+
+	weightStr := getEnvOrDefault("NODE_WEIGHT", "1")
+	nodeWeight, err := strconv.Atoi(weightStr)
+	if err != nil || nodeWeight < 1 {
+		log.Printf("NODE_WEIGHT 格式无效: %q, 使用默认值: 1", weightStr)
+		nodeWeight = 1
+	}
+
+	loadFactorStr := getEnvOrDefault("LOAD_FACTOR", "0")
+	loadFactor, err := strconv.ParseFloat(loadFactorStr, 64)
+	if err != nil || loadFactor < 0 {
+		log.Printf("LOAD_FACTOR 格式无效: %q, 使用默认值: 不启用有界负载", loadFactorStr)
+		loadFactor = 0
+	}
+
+	replicationStr := getEnvOrDefault("REPLICATION_FACTOR", "1")
+	replicationFactor, err := strconv.Atoi(replicationStr)
+	if err != nil || replicationFactor < 1 {
+		log.Printf("REPLICATION_FACTOR 格式无效: %q, 使用默认值: 1", replicationStr)
+		replicationFactor = 1
+	}
+
+	compressStr := getEnvOrDefault("COMPRESS_VALUES", "false")
+	compressValues, err := strconv.ParseBool(compressStr)
+	if err != nil {
+		log.Printf("COMPRESS_VALUES 格式无效: %q, 使用默认值: false", compressStr)
+		compressValues = false
+	}
+
+	handoffStr := getEnvOrDefault("HANDOFF_BYTES_PER_SECOND", "1048576")
+	handoffRate, err := strconv.ParseInt(handoffStr, 10, 64)
+	if err != nil || handoffRate < 0 {
+		log.Printf("HANDOFF_BYTES_PER_SECOND 格式无效: %q, 使用默认值: 1048576", handoffStr)
+		handoffRate = 1 << 20
+	}
+
+	snapshotPath := getEnvOrDefault("SNAPSHOT_PATH", "")
+
+	restoreDelay, err := time.ParseDuration(getEnvOrDefault("SNAPSHOT_RESTORE_DELAY", "10s"))
+	if err != nil || restoreDelay < 0 {
+		log.Printf("SNAPSHOT_RESTORE_DELAY 格式无效: %v, 使用默认值: 10s", err)
+		restoreDelay = 10 * time.Second
+	}
+
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(getEnvOrDefault("LOG_LEVEL", "info"))); err != nil {
+		log.Printf("LOG_LEVEL 格式无效: %v, 使用默认值: info", err)
+		logLevel = slog.LevelInfo
+	}
+
 	return &AppConfig{
-		ApiPort:             apiPort,
-		GroupcachePort:      gcPort,
-		SelfApiAddr:         selfApiAddr,
-		SelfGroupcacheAddr:  selfGCAddr,
-		InitialPeerApiAddrs: peers,
-		SourceappServiceURL: sourceappURL,
+		ApiPort:               apiPort,
+		GroupcachePort:        gcPort,
+		SelfApiAddr:           selfApiAddr,
+		SelfGroupcacheAddr:    selfGCAddr,
+		InitialPeerApiAddrs:   peers,
+		SourceappServiceURL:   sourceappURL,
+		CacheTTL:              cacheTTL,
+		LogLevel:              logLevel,
+		NodeWeight:            nodeWeight,
+		LoadFactor:            loadFactor,
+		ReplicationFactor:     replicationFactor,
+		CompressValues:        compressValues,
+		HandoffBytesPerSecond: handoffRate,
+		SnapshotPath:          snapshotPath,
+		SnapshotRestoreDelay:  restoreDelay,
 	}
 }
 
@@ -1,8 +1,17 @@
 package datastore
 
+import "errors"
+
+// ErrNotFound 表示数据存储中不存在请求的键。
+// 实现应返回它（或用 %w 包装它的错误），以便调用者用 errors.Is 判断。
+var ErrNotFound = errors.New("数据存储中未找到键")
+
 // DataStore 定义了数据存储的接口
-// 所有实现此接口的存储都应该能够按键检索数据
+// 所有实现此接口的存储都应该能够按键检索和写入数据
 type DataStore interface {
 	// Get 通过键从数据存储中检索值
 	Get(key string) ([]byte, error)
+
+	// Set 将键值对写入数据存储
+	Set(key string, value []byte) error
 }
@@ -48,7 +48,7 @@ func (s *InMemoryStore) Get(key string) ([]byte, error) {
 
 	if !ok {
 		log.Printf("[数据存储获取器] 节点 %s: 数据库中未找到键 %q", s.nodeAddress, key)
-		return nil, fmt.Errorf("数据存储中未找到键: %s", key)
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
 	}
 
 	// 返回副本以防止调用者修改原始映射值。
@@ -56,3 +56,16 @@ func (s *InMemoryStore) Get(key string) ([]byte, error) {
 	copy(dataCopy, val)
 	return dataCopy, nil
 }
+
+// Set 将键值对写入内存存储。
+func (s *InMemoryStore) Set(key string, value []byte) error {
+	dataCopy := make([]byte, len(value))
+	copy(dataCopy, value)
+
+	dbMu.Lock()
+	db[key] = dataCopy
+	dbMu.Unlock()
+
+	log.Printf("[数据存储写入器] 节点 %s: 写入键: %q, 大小: %d bytes", s.nodeAddress, key, len(value))
+	return nil
+}
@@ -1,6 +1,7 @@
 package datastore
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
@@ -69,7 +70,7 @@ func (p *HTTPClientProvider) Get(key string) ([]byte, error) {
 	// 检查状态码
 	if resp.StatusCode == http.StatusNotFound {
 		log.Printf("[HTTP客户端] 节点 %s: 服务器未找到键 %q", p.nodeName, key)
-		return nil, fmt.Errorf("键不存在: %s", key)
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -84,3 +85,26 @@ func (p *HTTPClientProvider) Get(key string) ([]byte, error) {
 
 	return data, nil
 }
+
+// Set 通过HTTP API (PUT /api/data/{key}) 写入数据
+func (p *HTTPClientProvider) Set(key string, value []byte) error {
+	log.Printf("[HTTP客户端] 节点 %s: 通过API写入键: %q", p.nodeName, key)
+
+	url := fmt.Sprintf("%s/api/data/%s", p.baseURL, key)
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(value))
+	if err != nil {
+		return fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("服务器返回状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
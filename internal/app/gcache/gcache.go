@@ -2,7 +2,13 @@ package gcache
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
 
 	"github.com/golang/groupcache"
 	"github.com/golang/groupcache/internal/app/datastore"
@@ -11,6 +17,8 @@ import (
 const (
 	DefaultGroupName      = "my-default-data-group"
 	DefaultCacheSizeBytes = 1 << 20 // 1MB
+
+	basePath = "/_groupcache/" // groupcache 对等体请求的路径
 )
 
 // CachingService 封装了 groupcache 的设置和获取函数。
@@ -22,6 +30,7 @@ type CachingService struct {
 	nodeAddress    string              // 用于日志记录，通常是配置中的 SelfGroupcacheAddr
 	groupName      string
 	cacheSizeBytes int64
+	ttl            time.Duration // 条目的过期时间，零表示永不过期
 }
 
 // NewCachingService 创建并初始化 groupcache Group 和 HTTPPool。
@@ -30,6 +39,11 @@ func NewCachingService(
 	selfGroupcacheAddr string, // 例如，http://localhost:8081，用于 nodeAddress 日志记录和 HTTPPool 自身 ID
 	groupName string,
 	cacheSizeBytes int64,
+	ttl time.Duration,
+	loadFactor float64, // 有界负载的一致性哈希的负载系数，零表示不启用
+	replicationFactor int, // 每个键的副本数，所有者失败时依次从其余副本加载
+	compressValues bool, // 值在缓存中和对等体之间以 gzip 压缩，适合 JSON 等容易压缩的值
+	handoffBytesPerSecond int64, // 成员变化后每秒交给新所有者的字节数，零表示不交接
 ) *CachingService {
 	if groupName == "" {
 		groupName = DefaultGroupName
@@ -43,14 +57,32 @@ func NewCachingService(
 		nodeAddress:    selfGroupcacheAddr,
 		groupName:      groupName,
 		cacheSizeBytes: cacheSizeBytes,
+		ttl:            ttl,
 	}
 
 	//log.Printf("[%s CachingService] 正在初始化 groupcache 组 '%s'，缓存大小 %d 字节", cs.nodeAddress, cs.groupName, cs.cacheSizeBytes)
 	// getterFunc 现在是 CachingService 的一个方法，因此它可以访问 cs.dataStore 和 cs.nodeAddress。
-	cs.Group = groupcache.NewGroup(cs.groupName, cs.cacheSizeBytes, groupcache.GetterFunc(cs.getterFunc))
+	// 按 CPU 数分片，读多写少的负载下并发 Get 不必争用同一把缓存锁。
+	groupOpts := &groupcache.GroupOptions{
+		CacheShards:           runtime.GOMAXPROCS(0),
+		ReplicationFactor:     replicationFactor,
+		HandoffBytesPerSecond: handoffBytesPerSecond,
+	}
+	poolOpts := &groupcache.HTTPPoolOptions{
+		BasePath:   basePath,
+		LoadFactor: loadFactor,
+	}
+	if compressValues {
+		// 缓存和对等体使用同一个 Codec，缓存中压缩的值可以原样发送。
+		codec := groupcache.GzipCodec(0)
+		groupOpts.CacheCodec = codec
+		poolOpts.Codecs = []groupcache.Codec{codec}
+	}
+	cs.Group = groupcache.NewGroupOpts(cs.groupName, cs.cacheSizeBytes, storeGetter{cs}, groupOpts)
 
 	//log.Printf("[%s CachingService] 正在初始化 HTTPPool，自身地址: %s", cs.nodeAddress, cs.nodeAddress)
-	cs.HttpPool = groupcache.NewHTTPPool(cs.nodeAddress) // NewHTTPPool 在 http.DefaultServeMux 的 /_groupcache/ 路径注册了一个 HTTP 处理程序
+	cs.HttpPool = groupcache.NewHTTPPoolOpts(cs.nodeAddress, poolOpts)
+	http.Handle(basePath, cs.HttpPool) // 在 http.DefaultServeMux 的 /_groupcache/ 路径注册 HTTP 处理程序
 
 	return cs
 }
@@ -63,17 +95,84 @@ func (cs *CachingService) getterFunc(ctx context.Context, key string, dest group
 	val, err := cs.dataStore.Get(key) // 使用注入的数据存储
 	if err != nil {
 		//log.Printf("[获取器] 节点 %s，组 %s：数据存储中未找到键 %q: %v", cs.nodeAddress, cs.groupName, key, err)
-		// 这里返回的错误必须是 groupcache 能够理解的错误，
-		// 或者至少是一个表示未找到键的错误，这样它就不会被缓存为该键的永久错误。
-		// groupcache 本身没有针对此的特定错误类型，fmt.Errorf 已足够。
-		return fmt.Errorf("通过缓存服务在数据存储中未找到键: %s: %w", key, err)
+		// 键不存在时返回 groupcache.ErrNotFound，使所有者短暂缓存这个否定结果，
+		// 避免对不存在的键的重复请求都落到数据源上。
+		if errors.Is(err, datastore.ErrNotFound) {
+			return fmt.Errorf("通过缓存服务在数据存储中未找到键: %s: %w", key, groupcache.ErrNotFound)
+		}
+		return fmt.Errorf("通过缓存服务从数据存储获取键失败: %s: %w", key, err)
 	}
 
 	// datastore.Get 方法已经返回了一个副本，所以这里不需要再复制一次。
-	if err := dest.SetBytes(val); err != nil {
+	var expire time.Time
+	if cs.ttl > 0 {
+		expire = time.Now().Add(cs.ttl)
+	}
+	if err := dest.SetBytesWithExpiry(val, expire); err != nil {
 		//log.Printf("[获取器] 节点 %s，组 %s：为键 %q 设置字节时出错: %v", cs.nodeAddress, cs.groupName, key, err)
 		return err
 	}
 	//log.Printf("[获取器] 节点 %s，组 %s：成功为键 %q 在缓存接收器中设置字节", cs.nodeAddress, cs.groupName, key)
 	return nil
 }
+
+// setterFunc 定义了 Group.Set 写穿时如何将数据写入数据存储。
+func (cs *CachingService) setterFunc(ctx context.Context, key string, value []byte) error {
+	if err := cs.dataStore.Set(key, value); err != nil {
+		return fmt.Errorf("通过缓存服务写入数据存储失败: %s: %w", key, err)
+	}
+	return nil
+}
+
+// storeGetter 将 CachingService 适配为 groupcache.Getter 和 groupcache.Setter，
+// 使 Group.Set 能够写穿到数据存储。
+type storeGetter struct {
+	cs *CachingService
+}
+
+func (g storeGetter) Get(ctx context.Context, key string, dest groupcache.Sink) error {
+	return g.cs.getterFunc(ctx, key, dest)
+}
+
+func (g storeGetter) Set(ctx context.Context, key string, value []byte) error {
+	return g.cs.setterFunc(ctx, key, value)
+}
+
+// SaveSnapshot 把缓存组的快照写到 path。先写入同目录下的临时文件再重命名，
+// 中途失败不会破坏已有的快照。
+func SaveSnapshot(g *groupcache.Group, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("创建快照文件失败: %w", err)
+	}
+	defer os.Remove(f.Name()) // 重命名成功后无效
+	if err := g.Snapshot(f); err != nil {
+		f.Close()
+		return fmt.Errorf("写入快照失败: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("写入快照失败: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("写入快照失败: %w", err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// RestoreSnapshot 从 path 恢复缓存组的快照，只加载本节点按当前的对等节点
+// 仍然拥有的键。快照文件不存在时什么也不做。
+func RestoreSnapshot(g *groupcache.Group, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("打开快照文件失败: %w", err)
+	}
+	defer f.Close()
+	if err := g.Restore(f); err != nil {
+		return fmt.Errorf("恢复快照失败: %w", err)
+	}
+	return nil
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"log"
+	"log/slog"
+	"os"
 	"time"
 
+	"github.com/golang/groupcache"
 	"github.com/golang/groupcache/internal/app/config"
 	"github.com/golang/groupcache/internal/app/datastore"
 	"github.com/golang/groupcache/internal/app/gcache"
@@ -58,6 +61,9 @@ func NewApplication() (*Application, error) {
 	log.Printf("配置已加载: API端口 %s, Groupcache端口 %s, 自身API地址: %s, 自身GC地址: %s",
 		appConfig.ApiPort, appConfig.GroupcachePort, appConfig.SelfApiAddr, appConfig.SelfGroupcacheAddr)
 
+	// groupcache 默认不输出日志，这里按配置的级别输出到标准错误。
+	groupcache.SetLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: appConfig.LogLevel})))
+
 	// 2. 初始化数据存储 (DataStore)
 	var ds datastore.DataStore
 	var cleanupFuncs []func() error
@@ -90,8 +96,10 @@ func NewApplication() (*Application, error) {
 	// 缓存组名和大小可以考虑也放入配置中，此处暂时硬编码。
 	cachingGroupName := "distributed-cache-group" // 可以考虑从配置中读取
 	cacheSizeBytes := int64(1 << 20)              // 1MB, 可以考虑从配置中读取
-	cachingSvc := gcache.NewCachingService(ds, appConfig.SelfGroupcacheAddr, cachingGroupName, cacheSizeBytes)
+	cachingSvc := gcache.NewCachingService(ds, appConfig.SelfGroupcacheAddr, cachingGroupName, cacheSizeBytes, appConfig.CacheTTL, appConfig.LoadFactor, appConfig.ReplicationFactor, appConfig.CompressValues, appConfig.HandoffBytesPerSecond)
 	//log.Printf("缓存服务 (CachingService) 已初始化。组: %s, HTTPPool监听地址: %s", cachingSvc.Group.Name(), appConfig.SelfGroupcacheAddr)
+	// 退出时关闭缓存组，等待进行中的加载完成并释放缓存内存。
+	cleanupFuncs = append(cleanupFuncs, cachingSvc.Group.Close)
 
 	// 4. 初始化对等节点存储 (PeerStore)
 	// PeerStore 需要 CachingService 中的 HTTPPool 来更新 groupcache 的对等节点列表。
@@ -102,6 +110,7 @@ func NewApplication() (*Application, error) {
 		appConfig.InitialPeerApiAddrs,
 		cachingSvc.HttpPool, // 将 CachingService 的 HTTPPool 注入 PeerStore
 		peerTimeout,
+		appConfig.NodeWeight,
 	)
 	ps.UpdateGroupcachePoolIfNeeded() // 首次更新 groupcache 池 (此时只有自身或无对等节点)
 	//log.Println("对等节点存储 (PeerStore) 已初始化.")
@@ -149,6 +158,16 @@ func (a *Application) Start() error {
 	a.PeerService.Start()
 	//log.Printf("[%s] PeerService 已启动.", a.Config.SelfGroupcacheAddr)
 
+	// 等待对等节点发现完成后再恢复快照，只加载本节点仍然拥有的键。
+	if path := a.Config.SnapshotPath; path != "" {
+		go func() {
+			time.Sleep(a.Config.SnapshotRestoreDelay)
+			if err := gcache.RestoreSnapshot(a.CachingService.Group, path); err != nil {
+				log.Printf("[%s] %v", a.Config.SelfGroupcacheAddr, err)
+			}
+		}()
+	}
+
 	// 2. 启动 HTTP 服务器 (这将阻塞主goroutine，直到接收到关闭信号)
 	// StartHttpServers 内部处理了优雅关闭的信号监听
 	//log.Printf("[%s] HTTP 服务器准备启动 (API在:%s, Groupcache在:%s)...",
@@ -43,6 +43,7 @@ func NewPeerService(ps *PeerStore, heartBeat time.Duration, announce time.Durati
 		nodeSelfAnnouncePayload: AnnouncePayload{
 			GroupcacheAddress: ps.GetSelfGroupcacheAddr(),
 			ApiAddress:        ps.GetSelfApiAddr(),
+			Weight:            ps.GetSelfWeight(),
 		},
 	}
 }
@@ -121,7 +122,7 @@ func (s *PeerService) announcer() {
 					var changedByAnnounce bool
 					for _, discoveredPeer := range resp.KnownPeers {
 						if discoveredPeer.GroupcacheAddress != s.peerStore.GetSelfGroupcacheAddr() { // 不从广播响应中添加自身
-							if s.peerStore.AddOrUpdatePeer(discoveredPeer.GroupcacheAddress, discoveredPeer.ApiAddress, time.Now()) {
+							if s.peerStore.AddOrUpdatePeer(discoveredPeer.GroupcacheAddress, discoveredPeer.ApiAddress, discoveredPeer.Weight, time.Now()) {
 								changedByAnnounce = true
 							}
 						}
@@ -168,7 +169,8 @@ func (s *PeerService) heartbeater() {
 				targetURL := targetPeer.ApiAddress + "/admin/heartbeat"
 				err := sendPostRequest(targetURL, s.nodeSelfAnnouncePayload, nil, 0) // 使用 client.go 的 sendPostRequest
 				if err != nil {
-					// 错误由 sendPostRequest 记录，PeerStore 的剪枝将处理无响应的节点。
+					// PeerStore 的剪枝将处理无响应的节点，这里只计数供监控使用。
+					s.peerStore.recordHeartbeatFailure()
 					// log.Printf("[%s PeerService Heartbeater] 向 %s (API: %s) 发送心跳时出错: %v", s.peerStore.GetSelfGroupcacheAddr(), targetPeer.GroupcacheAddress, targetPeer.ApiAddress, err)
 				}
 			}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/groupcache"
@@ -19,10 +20,12 @@ const (
 // GroupcacheAddress 例如：http://localhost:8081
 // ApiAddress 例如：http://localhost:9081（用于管理/API 通信）
 // LastSeen 记录最后一次看到该节点的时间
+// Weight 是节点在一致性哈希上的权重，至少为 1
 type PeerEntry struct {
 	GroupcacheAddress string // e.g., http://localhost:8081
 	ApiAddress        string // e.g., http://localhost:9081 (for admin/API communication)
 	LastSeen          time.Time
+	Weight            int
 }
 
 // PeerStore 管理已知节点列表并更新 groupcache 的 HTTPPool。
@@ -35,20 +38,27 @@ type PeerStore struct {
 	initialPeerApiAddrs    []string             // API addresses of initial contact points from config
 	groupcachePool         *groupcache.HTTPPool // The groupcache pool to update
 	lastSetGroupcachePeers []string             // To avoid unnecessary Set() calls to groupcachePool
+	lastSetWeights         map[string]int       // 最近一次设置到 groupcachePool 的权重
 	peerTimeoutDuration    time.Duration        // How long before a peer is considered dead
+	heartbeatFailures      atomic.Int64         // 发送失败的心跳次数
 }
 
 // NewPeerStore 创建并初始化一个 PeerStore。
+// selfWeight 是自身在一致性哈希上的权重，小于 1 时视为 1。
 func NewPeerStore(
 	selfApiAddr string,
 	selfGroupcacheAddr string,
 	initialPeerApiAddrs []string,
 	pool *groupcache.HTTPPool,
 	peerTimeout time.Duration,
+	selfWeight int,
 ) *PeerStore {
 	if peerTimeout == 0 {
 		peerTimeout = DefaultPeerTimeoutDuration
 	}
+	if selfWeight < 1 {
+		selfWeight = 1
+	}
 	ps := &PeerStore{
 		peers:                  make(map[string]PeerEntry),
 		selfApiAddr:            selfApiAddr,
@@ -64,22 +74,27 @@ func NewPeerStore(
 		GroupcacheAddress: selfGroupcacheAddr,
 		ApiAddress:        selfApiAddr,
 		LastSeen:          time.Now(), // 标记自身为最近可见
+		Weight:            selfWeight,
 	}
 	//log.Printf("[%s PeerStore] 初始化完成。自身: %s (API: %s)。超时时间: %v", selfGroupcacheAddr, selfGroupcacheAddr, selfApiAddr, peerTimeout)
 	return ps
 }
 
-// AddOrUpdatePeer 添加新节点或更新已存在节点的 LastSeen 时间。
-// 如果是新节点或 API 地址发生变化则返回 true。
-func (ps *PeerStore) AddOrUpdatePeer(groupcacheAddr, apiAddr string, lastSeenTime time.Time) bool {
+// AddOrUpdatePeer 添加新节点或更新已存在节点的 LastSeen 时间和权重。
+// weight 小于 1 时视为 1。如果是新节点、API 地址或权重发生变化则返回 true。
+func (ps *PeerStore) AddOrUpdatePeer(groupcacheAddr, apiAddr string, weight int, lastSeenTime time.Time) bool {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
+	if weight < 1 {
+		weight = 1
+	}
 	existingEntry, exists := ps.peers[groupcacheAddr]
 	ps.peers[groupcacheAddr] = PeerEntry{
 		GroupcacheAddress: groupcacheAddr,
 		ApiAddress:        apiAddr,
 		LastSeen:          lastSeenTime,
+		Weight:            weight,
 	}
 
 	if !exists {
@@ -90,6 +105,10 @@ func (ps *PeerStore) AddOrUpdatePeer(groupcacheAddr, apiAddr string, lastSeenTim
 		log.Printf("PeerStore] 节点 %s 的 API 地址发生变化: 旧 %s, 新 %s", groupcacheAddr, existingEntry.ApiAddress, apiAddr)
 		return true // Consider API address change as a notable update
 	}
+	if existingEntry.Weight != weight {
+		log.Printf("PeerStore] 节点 %s 的权重发生变化: 旧 %d, 新 %d", groupcacheAddr, existingEntry.Weight, weight)
+		return true
+	}
 	// log.Printf("[%s PeerStore] Updated lastSeen for peer: %s", ps.selfGroupcacheAddr, groupcacheAddr) // Too verbose for heartbeats
 	return false
 }
@@ -127,21 +146,26 @@ func (ps *PeerStore) GetLivePeerGroupcacheAddrsAndPrune() []string {
 	return livePeers
 }
 
-// UpdateGroupcachePoolIfNeeded 如果 groupcache 节点列表（不含自身）发生变化，则更新 groupcache HTTPPool。
+// UpdateGroupcachePoolIfNeeded 如果 groupcache 节点列表或节点的权重发生变化，则更新 groupcache HTTPPool。
 func (ps *PeerStore) UpdateGroupcachePoolIfNeeded() (changed bool) {
 	liveGroupcacheAddrs := ps.GetLivePeerGroupcacheAddrsAndPrune()
 
 	ps.mu.RLock()
-	isDifferent := !equalSorted(liveGroupcacheAddrs, ps.lastSetGroupcachePeers)
+	weights := make(map[string]int, len(liveGroupcacheAddrs))
+	for _, addr := range liveGroupcacheAddrs {
+		weights[addr] = ps.peers[addr].Weight
+	}
+	isDifferent := !equalSorted(liveGroupcacheAddrs, ps.lastSetGroupcachePeers) || !equalWeights(weights, ps.lastSetWeights)
 	ps.mu.RUnlock()
 
 	if isDifferent {
 		//log.Printf("[PeerStore] groupcache 活跃节点列表发生变化，正在更新 groupcache pool。旧: %v, 新: %v", ps.lastSetGroupcachePeers, liveGroupcacheAddrs)
-		ps.groupcachePool.Set(liveGroupcacheAddrs...) // This is the crucial call to update groupcache
+		ps.applyPoolDelta(weights) // This is the crucial call to update groupcache
 
 		ps.mu.Lock()
 		ps.lastSetGroupcachePeers = make([]string, len(liveGroupcacheAddrs))
 		copy(ps.lastSetGroupcachePeers, liveGroupcacheAddrs)
+		ps.lastSetWeights = weights
 		ps.mu.Unlock()
 		return true
 	}
@@ -149,6 +173,63 @@ func (ps *PeerStore) UpdateGroupcachePoolIfNeeded() (changed bool) {
 	return false
 }
 
+// applyPoolDelta 只把与上次设置相比新增、移除或权重变化的节点应用到
+// groupcache pool，不重建一致性哈希环，未变化节点的连接得以保留。
+// 整个变化一次应用，交接只按最终的成员进行一次。
+func (ps *PeerStore) applyPoolDelta(weights map[string]int) {
+	ps.mu.RLock()
+	last := ps.lastSetWeights
+	ps.mu.RUnlock()
+
+	var remove []string
+	for addr := range last {
+		if _, ok := weights[addr]; !ok {
+			remove = append(remove, addr)
+		}
+	}
+	add := make(map[string]int)
+	for addr, w := range weights {
+		if old, ok := last[addr]; !ok || old != w {
+			add[addr] = w
+		}
+	}
+	if moved := ps.groupcachePool.UpdatePeers(add, remove); len(moved) > 0 {
+		log.Printf("[PeerStore] 一致性哈希环已更新，%d 个哈希区间更换了所有者", len(moved))
+	}
+}
+
+// LivePeerCount 返回最近一次设置到 groupcache pool 的存活节点数（不含自身）。
+func (ps *PeerStore) LivePeerCount() int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	n := 0
+	for _, addr := range ps.lastSetGroupcachePeers {
+		if addr != ps.selfGroupcacheAddr {
+			n++
+		}
+	}
+	return n
+}
+
+// HeartbeatFailures 返回自启动以来发送失败的心跳次数。
+func (ps *PeerStore) HeartbeatFailures() int64 {
+	return ps.heartbeatFailures.Load()
+}
+
+// CircuitStats 返回 groupcache pool 中每个对等体的熔断器状态，
+// 没有 pool 时返回 nil。
+func (ps *PeerStore) CircuitStats() map[string]groupcache.CircuitStats {
+	if ps.groupcachePool == nil {
+		return nil
+	}
+	return ps.groupcachePool.CircuitStats()
+}
+
+// recordHeartbeatFailure 记录一次发送失败的心跳，由 PeerService 调用。
+func (ps *PeerStore) recordHeartbeatFailure() {
+	ps.heartbeatFailures.Add(1)
+}
+
 // GetPeerApiAddress 根据 groupcache 地址获取对应的 API 地址。
 func (ps *PeerStore) GetPeerApiAddress(groupcacheAddr string) (string, bool) {
 	ps.mu.RLock()
@@ -185,6 +266,13 @@ func (ps *PeerStore) GetSelfApiAddr() string {
 	return ps.selfApiAddr
 }
 
+// GetSelfWeight 返回当前节点在一致性哈希上的权重。
+func (ps *PeerStore) GetSelfWeight() int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.peers[ps.selfGroupcacheAddr].Weight
+}
+
 // GetSelfGroupcacheAddr 返回当前节点的 groupcache 地址。
 func (ps *PeerStore) GetSelfGroupcacheAddr() string {
 	return ps.selfGroupcacheAddr
@@ -203,3 +291,16 @@ func equalSorted(a, b []string) bool {
 	}
 	return true
 }
+
+// equalWeights 判断两组节点权重是否相等。
+func equalWeights(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for addr, w := range a {
+		if bw, ok := b[addr]; !ok || bw != w {
+			return false
+		}
+	}
+	return true
+}
@@ -41,7 +41,7 @@ func (h *AdminHandlers) AnnounceSelfHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// 添加或更新对等节点，并检查这是否导致了可能影响 groupcache 池的更改
-	h.PeerStore.AddOrUpdatePeer(payload.GroupcacheAddress, payload.ApiAddress, time.Now())
+	h.PeerStore.AddOrUpdatePeer(payload.GroupcacheAddress, payload.ApiAddress, payload.Weight, time.Now())
 	h.PeerStore.UpdateGroupcachePoolIfNeeded() // 更新 groupcache 对等节点至关重要
 
 	// 返回当前已知的对等节点。这有助于新节点发现网络。
@@ -61,6 +61,7 @@ func (h *AdminHandlers) AnnounceSelfHandler(w http.ResponseWriter, r *http.Reque
 		currentKnownPeers = append(currentKnownPeers, peermanager.AnnouncePayload{
 			GroupcacheAddress: entry.GroupcacheAddress,
 			ApiAddress:        entry.ApiAddress,
+			Weight:            entry.Weight,
 		})
 	}
 
@@ -98,7 +99,7 @@ func (h *AdminHandlers) HeartbeatHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if h.PeerStore.AddOrUpdatePeer(payload.GroupcacheAddress, payload.ApiAddress, time.Now()) {
+	if h.PeerStore.AddOrUpdatePeer(payload.GroupcacheAddress, payload.ApiAddress, payload.Weight, time.Now()) {
 		// UpdateGroupcachePoolIfNeeded 由 AddOrUpdatePeer 或定期修剪器调用，
 		// 但在此处调用可确保在对等节点恢复在线时立即反映。
 		h.PeerStore.UpdateGroupcachePoolIfNeeded()
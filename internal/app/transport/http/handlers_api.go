@@ -3,9 +3,12 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/golang/groupcache"
@@ -62,6 +65,10 @@ func (h *ApiHandlers) GetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err := h.Group.Get(ctx, key, groupcache.AllocatingByteSliceSink(&data))
+	if errors.Is(err, groupcache.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("键 %s 不存在", key), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Printf("[%s API /get] 从 groupcache 获取键 %q 时出错: %v", nodeAddr, key, err)
 		http.Error(w, fmt.Sprintf("获取键 %s 时出错: %v", key, err), http.StatusInternalServerError)
@@ -73,6 +80,143 @@ func (h *ApiHandlers) GetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// mgetResult 是 /mget 响应中单个键的结果。
+type mgetResult struct {
+	Value    string `json:"value,omitempty"`
+	NotFound bool   `json:"not_found,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// MGetHandler 处理一次检索多个键的请求，例如 /mget?key=a&key=b。
+// 键按所有者节点分批获取，响应是键到结果的 JSON 对象，
+// 单个键的失败只体现在该键的 error 字段中。
+func (h *ApiHandlers) MGetHandler(w http.ResponseWriter, r *http.Request) {
+	keys := r.URL.Query()["key"]
+	if len(keys) == 0 {
+		http.Error(w, "缺少 \"key\" 查询参数", http.StatusBadRequest)
+		return
+	}
+	if h.Group == nil {
+		http.Error(w, "内部服务器错误: groupcache 不可用", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	values := make([][]byte, len(keys))
+	dests := make([]groupcache.Sink, len(keys))
+	for i := range keys {
+		dests[i] = groupcache.AllocatingByteSliceSink(&values[i])
+	}
+	errs := h.Group.GetMulti(ctx, keys, dests)
+
+	results := make(map[string]mgetResult, len(keys))
+	for i, key := range keys {
+		if errors.Is(errs[i], groupcache.ErrNotFound) {
+			results[key] = mgetResult{NotFound: true}
+			continue
+		}
+		if errs[i] != nil {
+			log.Printf("[API /mget] 从 groupcache 获取键 %q 时出错: %v", key, errs[i])
+			results[key] = mgetResult{Error: errs[i].Error()}
+			continue
+		}
+		results[key] = mgetResult{Value: string(values[i])}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("[API /mget] 编码响应时出错: %v", err)
+	}
+}
+
+// SetHandler 处理写入键的请求。
+// 请求体即为新值，它经由键的所有者写穿到数据源，并更新集群中的缓存。
+func (h *ApiHandlers) SetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		http.Error(w, "/set 只允许 PUT 或 POST 请求", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "缺少 \"key\" 查询参数", http.StatusBadRequest)
+		return
+	}
+	if h.Group == nil {
+		http.Error(w, "内部服务器错误: groupcache 不可用", http.StatusInternalServerError)
+		return
+	}
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "读取请求体失败", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.Group.Set(ctx, key, value); err != nil {
+		log.Printf("[API /set] 写入键 %q 时出错: %v", key, err)
+		http.Error(w, fmt.Sprintf("写入键 %s 时出错: %v", key, err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// RemoveHandler 处理从整个集群中清除键的请求。
+// 当 sourceapp 中的数据被更新后调用它，使所有节点丢弃旧值。
+func (h *ApiHandlers) RemoveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "/remove 只允许 POST 或 DELETE 请求", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "缺少 \"key\" 查询参数", http.StatusBadRequest)
+		return
+	}
+	if h.Group == nil {
+		http.Error(w, "内部服务器错误: groupcache 不可用", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.Group.Remove(ctx, key); err != nil {
+		log.Printf("[API /remove] 清除键 %q 时出错: %v", key, err)
+		http.Error(w, fmt.Sprintf("清除键 %s 时出错: %v", key, err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// CacheBytesHandler 查看或在运行时调整本节点缓存组的大小限制。
+// GET 返回当前限制；POST /admin/cache_bytes?bytes=N 将限制设置为 N 字节，
+// 缩小限制时多余的条目会立即被淘汰。
+func (h *ApiHandlers) CacheBytesHandler(w http.ResponseWriter, r *http.Request) {
+	if h.Group == nil {
+		http.Error(w, "内部服务器错误: groupcache 不可用", http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		n, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+		if err != nil {
+			http.Error(w, "\"bytes\" 查询参数无效", http.StatusBadRequest)
+			return
+		}
+		h.Group.SetCacheBytes(n)
+		log.Printf("[API /admin/cache_bytes] 组 %s 的缓存大小限制已调整为 %d 字节", h.Group.Name(), n)
+	default:
+		http.Error(w, "/admin/cache_bytes 只允许 GET 或 POST 请求", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"cache_bytes": h.Group.CacheBytes()})
+}
+
 // PingApiHandler 是 API 服务的简单 ping 端点。
 // 它还显示节点的地址和已知的活动 groupcache 对等节点。
 func (h *ApiHandlers) PingApiHandler(w http.ResponseWriter, r *http.Request) {
@@ -82,6 +226,24 @@ func (h *ApiHandlers) PingApiHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// CircuitsHandler 返回本节点到每个 groupcache 对等节点的熔断器状态。
+func (h *ApiHandlers) CircuitsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "/admin/circuits 只允许 GET 请求", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.PeerStore == nil {
+		http.Error(w, "内部服务器错误: PeerStore 不可用", http.StatusInternalServerError)
+		return
+	}
+	circuits := h.PeerStore.CircuitStats()
+	if circuits == nil {
+		circuits = map[string]groupcache.CircuitStats{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(circuits)
+}
+
 // KnownPeersHandler 提供一个端点来查看 PeerStore 已知的所有对等节点 (用于调试/信息)。
 // 这包括自身和可能已失效的对等节点及其最后可见时间。
 func (h *ApiHandlers) KnownPeersHandler(w http.ResponseWriter, r *http.Request) {
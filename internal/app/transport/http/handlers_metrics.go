@@ -0,0 +1,178 @@
+package http
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/groupcache"
+	pm "github.com/golang/groupcache/internal/app/peermanager"
+)
+
+// MetricsHandler 以 Prometheus 文本格式（0.0.4）导出本进程中所有已注册组的
+// Stats、mainCache 和 hotCache 的 CacheStats、本地加载和对等体请求的延迟
+// 直方图，以及对等节点管理的指标。
+func (h *ApiHandlers) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "/metrics 只允许 GET 请求", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, groupcache.Groups(), h.PeerStore)
+}
+
+// groupCounters 是从 groupcache.Stats 导出的计数器。
+var groupCounters = []struct {
+	name, help string
+	value      func(*groupcache.Stats) int64
+}{
+	{"groupcache_group_gets_total", "任何 Get 请求，包括来自对等体的。", func(s *groupcache.Stats) int64 { return s.Gets.Get() }},
+	{"groupcache_group_cache_hits_total", "任一缓存命中的 Get 请求。", func(s *groupcache.Stats) int64 { return s.CacheHits.Get() }},
+	{"groupcache_group_peer_loads_total", "远程加载或远程缓存命中（非错误）。", func(s *groupcache.Stats) int64 { return s.PeerLoads.Get() }},
+	{"groupcache_group_peer_errors_total", "从对等体加载失败的次数。", func(s *groupcache.Stats) int64 { return s.PeerErrors.Get() }},
+	{"groupcache_group_failover_loads_total", "所有者失败后从其他副本成功加载的次数。", func(s *groupcache.Stats) int64 { return s.FailoverLoads.Get() }},
+	{"groupcache_group_hedged_loads_total", "发出的对冲请求。", func(s *groupcache.Stats) int64 { return s.HedgedLoads.Get() }},
+	{"groupcache_group_loads_total", "缓存未命中的 Get 请求。", func(s *groupcache.Stats) int64 { return s.Loads.Get() }},
+	{"groupcache_group_loads_deduped_total", "经 singleflight 去重后的加载。", func(s *groupcache.Stats) int64 { return s.LoadsDeduped.Get() }},
+	{"groupcache_group_local_loads_total", "成功的本地加载。", func(s *groupcache.Stats) int64 { return s.LocalLoads.Get() }},
+	{"groupcache_group_local_load_errors_total", "失败的本地加载。", func(s *groupcache.Stats) int64 { return s.LocalLoadErrs.Get() }},
+	{"groupcache_group_server_requests_total", "通过网络从对等体来的 Get 请求。", func(s *groupcache.Stats) int64 { return s.ServerRequests.Get() }},
+	{"groupcache_group_handoff_keys_total", "成员变化后交给新所有者的键。", func(s *groupcache.Stats) int64 { return s.HandoffKeys.Get() }},
+}
+
+// cacheMetrics 是从 groupcache.CacheStats 导出的指标。
+var cacheMetrics = []struct {
+	name, typ, help string
+	value           func(groupcache.CacheStats) int64
+}{
+	{"groupcache_cache_bytes", "gauge", "缓存中键和值的总大小。", func(s groupcache.CacheStats) int64 { return s.Bytes }},
+	{"groupcache_cache_items", "gauge", "缓存中的条目数。", func(s groupcache.CacheStats) int64 { return s.Items }},
+	{"groupcache_cache_gets_total", "counter", "缓存查找次数。", func(s groupcache.CacheStats) int64 { return s.Gets }},
+	{"groupcache_cache_hits_total", "counter", "缓存命中次数。", func(s groupcache.CacheStats) int64 { return s.Hits }},
+	{"groupcache_cache_evictions_total", "counter", "缓存淘汰次数。", func(s groupcache.CacheStats) int64 { return s.Evictions }},
+}
+
+// writeMetrics 将 groups 和 ps 的指标写入 w。ps 可以为 nil。
+func writeMetrics(w io.Writer, groups []*groupcache.Group, ps *pm.PeerStore) error {
+	mw := &metricsWriter{w: bufio.NewWriter(w)}
+
+	for _, c := range groupCounters {
+		mw.family(c.name, "counter", c.help)
+		for _, g := range groups {
+			mw.sample(c.name, []string{"group", g.Name()}, float64(c.value(&g.Stats)))
+		}
+	}
+
+	mw.family("groupcache_group_cache_limit_bytes", "gauge", "mainCache 和 hotCache 大小总和的限制。")
+	for _, g := range groups {
+		mw.sample("groupcache_group_cache_limit_bytes", []string{"group", g.Name()}, float64(g.CacheBytes()))
+	}
+	for _, m := range cacheMetrics {
+		mw.family(m.name, m.typ, m.help)
+		for _, g := range groups {
+			mw.sample(m.name, []string{"group", g.Name(), "cache", "main"}, float64(m.value(g.CacheStats(groupcache.MainCache))))
+			mw.sample(m.name, []string{"group", g.Name(), "cache", "hot"}, float64(m.value(g.CacheStats(groupcache.HotCache))))
+		}
+	}
+
+	mw.family("groupcache_local_load_duration_seconds", "histogram", "本地调用 Getter 加载的延迟。")
+	for _, g := range groups {
+		mw.histogram("groupcache_local_load_duration_seconds", []string{"group", g.Name()}, g.LocalLoadLatency())
+	}
+
+	peerStats := make([]map[string]groupcache.PeerStats, len(groups))
+	for i, g := range groups {
+		peerStats[i] = g.PeerStats()
+	}
+	peerFamily := func(name, typ, help string, fn func(labels []string, st groupcache.PeerStats)) {
+		mw.family(name, typ, help)
+		for i, g := range groups {
+			peers := make([]string, 0, len(peerStats[i]))
+			for peer := range peerStats[i] {
+				peers = append(peers, peer)
+			}
+			sort.Strings(peers)
+			for _, peer := range peers {
+				fn([]string{"group", g.Name(), "peer", peer}, peerStats[i][peer])
+			}
+		}
+	}
+	peerFamily("groupcache_peer_requests_total", "counter", "向对等体发出的加载请求。", func(labels []string, st groupcache.PeerStats) {
+		mw.sample("groupcache_peer_requests_total", labels, float64(st.Requests))
+	})
+	peerFamily("groupcache_peer_request_errors_total", "counter", "向对等体发出的失败的加载请求。", func(labels []string, st groupcache.PeerStats) {
+		mw.sample("groupcache_peer_request_errors_total", labels, float64(st.Errors))
+	})
+	peerFamily("groupcache_peer_request_duration_seconds", "histogram", "向对等体发出的加载请求的延迟。", func(labels []string, st groupcache.PeerStats) {
+		mw.histogram("groupcache_peer_request_duration_seconds", labels, st.Latency)
+	})
+
+	if ps != nil {
+		mw.family("groupcache_peermanager_live_peers", "gauge", "当前存活的其他节点数。")
+		mw.sample("groupcache_peermanager_live_peers", nil, float64(ps.LivePeerCount()))
+		mw.family("groupcache_peermanager_heartbeat_failures_total", "counter", "发送失败的心跳次数。")
+		mw.sample("groupcache_peermanager_heartbeat_failures_total", nil, float64(ps.HeartbeatFailures()))
+
+		circuits := ps.CircuitStats()
+		peers := make([]string, 0, len(circuits))
+		for peer := range circuits {
+			peers = append(peers, peer)
+		}
+		sort.Strings(peers)
+		mw.family("groupcache_peer_circuit_state", "gauge", "对等体熔断器的状态：0 关闭，1 打开，2 半开。")
+		for _, peer := range peers {
+			mw.sample("groupcache_peer_circuit_state", []string{"peer", peer}, float64(circuits[peer].State))
+		}
+		mw.family("groupcache_peer_circuit_opens_total", "counter", "对等体熔断器打开的次数。")
+		for _, peer := range peers {
+			mw.sample("groupcache_peer_circuit_opens_total", []string{"peer", peer}, float64(circuits[peer].Opens))
+		}
+	}
+	return mw.w.Flush()
+}
+
+// metricsWriter 按 Prometheus 文本格式写出指标。
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (mw *metricsWriter) family(name, typ, help string) {
+	mw.w.WriteString("# HELP " + name + " " + help + "\n")
+	mw.w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample 写出一个样本，labels 是交替的标签名和标签值。
+func (mw *metricsWriter) sample(name string, labels []string, value float64) {
+	mw.w.WriteString(name)
+	if len(labels) > 0 {
+		mw.w.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				mw.w.WriteByte(',')
+			}
+			mw.w.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		mw.w.WriteByte('}')
+	}
+	mw.w.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+// histogram 写出直方图的累计桶、总和与计数。
+func (mw *metricsWriter) histogram(name string, labels []string, s groupcache.LatencyStats) {
+	var cum int64
+	for i, n := range s.Counts {
+		cum += n
+		le := "+Inf"
+		if i < len(s.Bounds) {
+			le = strconv.FormatFloat(s.Bounds[i], 'g', -1, 64)
+		}
+		mw.sample(name+"_bucket", append(labels[:len(labels):len(labels)], "le", le), float64(cum))
+	}
+	mw.sample(name+"_sum", labels, s.Sum.Seconds())
+	mw.sample(name+"_count", labels, float64(cum))
+}
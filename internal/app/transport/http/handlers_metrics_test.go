@@ -0,0 +1,73 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/golang/groupcache"
+	pm "github.com/golang/groupcache/internal/app/peermanager"
+)
+
+// sampleLine matches one sample of the Prometheus text format.
+var sampleLine = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*(\{([a-zA-Z_][a-zA-Z0-9_]*="([^"\\]|\\.)*",?)*\})? \S+$`)
+
+func TestMetricsHandler(t *testing.T) {
+	g := groupcache.NewGroup("metrics-test", 1<<20, groupcache.GetterFunc(func(_ context.Context, key string, dest groupcache.Sink) error {
+		return dest.SetString("v")
+	}))
+	defer g.Close()
+	for _, key := range []string{"a", "b", "a"} {
+		var s string
+		if err := g.Get(context.Background(), key, groupcache.StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewApiHandlers(g, pm.NewPeerStore("http://api", "http://self", nil, nil, 0, 1), nil)
+	w := httptest.NewRecorder()
+	h.MetricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	body := w.Body.String()
+	typed := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			name := strings.Fields(line)[2]
+			if typed[name] {
+				t.Errorf("metric family %s declared twice", name)
+			}
+			typed[name] = true
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		if !sampleLine.MatchString(line) {
+			t.Errorf("malformed sample line %q", line)
+		}
+	}
+
+	for _, want := range []string{
+		`groupcache_group_gets_total{group="metrics-test"} 3`,
+		`groupcache_group_cache_hits_total{group="metrics-test"} 1`,
+		`groupcache_cache_items{group="metrics-test",cache="main"} 2`,
+		`groupcache_cache_items{group="metrics-test",cache="hot"} 0`,
+		`groupcache_local_load_duration_seconds_bucket{group="metrics-test",le="+Inf"} 2`,
+		`groupcache_local_load_duration_seconds_count{group="metrics-test"} 2`,
+		`groupcache_peermanager_live_peers 0`,
+		`groupcache_peermanager_heartbeat_failures_total 0`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics output lacks %q", want)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/golang/groupcache/internal/app/config"
+	"github.com/golang/groupcache/internal/app/gcache"
 )
 
 // Server 代表了应用程序的组合 HTTP 服务器功能。
@@ -54,8 +55,14 @@ func (s *Server) registerRoutes() {
 
 	// API 路由
 	s.apiMux.HandleFunc("/get", s.ApiHandlers.GetHandler)
+	s.apiMux.HandleFunc("/mget", s.ApiHandlers.MGetHandler)
+	s.apiMux.HandleFunc("/set", s.ApiHandlers.SetHandler)
+	s.apiMux.HandleFunc("/remove", s.ApiHandlers.RemoveHandler)
 	s.apiMux.HandleFunc("/ping_api", s.ApiHandlers.PingApiHandler)
 	s.apiMux.HandleFunc("/admin/known_peers", s.ApiHandlers.KnownPeersHandler) // 调试/信息端点
+	s.apiMux.HandleFunc("/admin/cache_bytes", s.ApiHandlers.CacheBytesHandler)
+	s.apiMux.HandleFunc("/admin/circuits", s.ApiHandlers.CircuitsHandler)
+	s.apiMux.HandleFunc("/metrics", s.ApiHandlers.MetricsHandler) // Prometheus 抓取端点
 
 	// 用于对等节点管理的管理路由
 	s.apiMux.HandleFunc("/admin/announce_self", s.AdminHandlers.AnnounceSelfHandler)
@@ -128,5 +135,14 @@ func (s *Server) StartHttpServers() {
 		log.Println("Groupcache 对等服务器已优雅关闭。")
 	}
 
+	// 服务器关闭后缓存不再变化，写入快照供重启后恢复。
+	if path := s.appConfig.SnapshotPath; path != "" && s.ApiHandlers != nil && s.ApiHandlers.Group != nil {
+		if err := gcache.SaveSnapshot(s.ApiHandlers.Group, path); err != nil {
+			log.Printf("保存缓存快照失败: %v", err)
+		} else {
+			log.Printf("缓存快照已保存到 %s。", path)
+		}
+	}
+
 	log.Println("所有 HTTP 服务器关闭过程已完成。")
 }
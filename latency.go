@@ -0,0 +1,160 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// latencyBuckets 是延迟直方图各桶的上界，单位为秒。
+var latencyBuckets = [...]float64{
+	0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05,
+	0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// latencyHistogram 是固定分桶的延迟直方图，可以并发更新。
+// 零值可以直接使用。
+type latencyHistogram struct {
+	counts [len(latencyBuckets) + 1]AtomicInt // 最后一个桶没有上界
+	sum    AtomicInt                          // 纳秒
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d.Seconds() > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *latencyHistogram) snapshot() LatencyStats {
+	s := LatencyStats{
+		Bounds: latencyBuckets[:],
+		Counts: make([]int64, len(h.counts)),
+		Sum:    time.Duration(h.sum.Get()),
+	}
+	for i := range h.counts {
+		s.Counts[i] = h.counts[i].Get()
+	}
+	return s
+}
+
+// LatencyStats 是延迟直方图的快照。
+type LatencyStats struct {
+	Bounds []float64     // 各桶的上界，单位为秒，递增；调用者不应修改
+	Counts []int64       // 每个桶的观测次数，最后一个元素是超过所有上界的次数
+	Sum    time.Duration // 所有观测值之和
+}
+
+// Count 返回观测的总次数。
+func (s LatencyStats) Count() int64 {
+	var n int64
+	for _, c := range s.Counts {
+		n += c
+	}
+	return n
+}
+
+// Quantile 返回分位数 q（0 到 1 之间）的估计值，在 q 所在的桶内线性
+// 插值。落在最后一个没有上界的桶中时返回最大的上界。没有观测时返回零。
+func (s LatencyStats) Quantile(q float64) time.Duration {
+	total := s.Count()
+	if total == 0 || len(s.Bounds) == 0 {
+		return 0
+	}
+	seconds := s.Bounds[len(s.Bounds)-1]
+	rank := q * float64(total)
+	var cum float64
+	for i, c := range s.Counts {
+		if c == 0 || cum+float64(c) < rank {
+			cum += float64(c)
+			continue
+		}
+		if i < len(s.Bounds) {
+			lower := 0.0
+			if i > 0 {
+				lower = s.Bounds[i-1]
+			}
+			seconds = lower + (s.Bounds[i]-lower)*(rank-cum)/float64(c)
+		}
+		break
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// PeerStats 是组向一个对等体发出的加载请求的统计信息。
+type PeerStats struct {
+	Requests int64        // 发出的 Get 和 GetMulti 请求
+	Errors   int64        // 失败的请求，不含键不存在
+	Latency  LatencyStats // 请求的延迟
+}
+
+// peerStats 是 PeerStats 的可并发更新的形式。
+type peerStats struct {
+	requests AtomicInt
+	errors   AtomicInt
+	latency  latencyHistogram
+}
+
+// peerName 返回统计信息中标识对等体的名称。实现了 fmt.Stringer
+// 的 ProtoGetter（例如 HTTPPool 和 GRPCPool 的对等体）以 String()
+// 的结果标识，其他的都记在 "unknown" 名下。
+func peerName(peer ProtoGetter) string {
+	if s, ok := peer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return "unknown"
+}
+
+// observePeer 记录一次向 peer 发出的请求。
+func (g *Group) observePeer(peer ProtoGetter, start time.Time, err error) {
+	name := peerName(peer)
+	v, ok := g.peerStats.Load(name)
+	if !ok {
+		v, _ = g.peerStats.LoadOrStore(name, new(peerStats))
+	}
+	s := v.(*peerStats)
+	s.requests.Add(1)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		s.errors.Add(1)
+	}
+	s.latency.observe(time.Since(start))
+}
+
+// LocalLoadLatency 返回本地调用 Getter 加载的延迟直方图。
+func (g *Group) LocalLoadLatency() LatencyStats {
+	return g.localLatency.snapshot()
+}
+
+// PeerStats 返回组向每个对等体发出的请求的统计信息，
+// 键是对等体的名称。对等体离开后，其统计信息仍会保留。
+func (g *Group) PeerStats() map[string]PeerStats {
+	m := make(map[string]PeerStats)
+	g.peerStats.Range(func(k, v interface{}) bool {
+		s := v.(*peerStats)
+		m[k.(string)] = PeerStats{
+			Requests: s.requests.Get(),
+			Errors:   s.errors.Get(),
+			Latency:  s.latency.snapshot(),
+		}
+		return true
+	})
+	return m
+}
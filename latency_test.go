@@ -0,0 +1,102 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// namedPeer is a fakePeer that identifies itself in PeerStats.
+type namedPeer struct {
+	*fakePeer
+	name string
+}
+
+func (p namedPeer) String() string { return p.name }
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	h.observe(200 * time.Microsecond)
+	h.observe(3 * time.Millisecond)
+	h.observe(time.Minute)
+	s := h.snapshot()
+	if s.Count() != 3 || s.Sum != time.Minute+3200*time.Microsecond {
+		t.Fatalf("count = %d, sum = %v", s.Count(), s.Sum)
+	}
+	if s.Counts[0] != 1 || s.Counts[3] != 1 || s.Counts[len(s.Counts)-1] != 1 {
+		t.Errorf("bucket counts = %v; want one each in the 0.5ms, 5ms and +Inf buckets", s.Counts)
+	}
+}
+
+func TestLatencyQuantile(t *testing.T) {
+	var h latencyHistogram
+	if q := h.snapshot().Quantile(0.95); q != 0 {
+		t.Errorf("empty Quantile = %v; want 0", q)
+	}
+	// 90 requests in (1ms, 2.5ms] and 10 in (5ms, 10ms].
+	for i := 0; i < 90; i++ {
+		h.observe(2 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.observe(8 * time.Millisecond)
+	}
+	s := h.snapshot()
+	if q := s.Quantile(0.5); q <= time.Millisecond || q > 2500*time.Microsecond {
+		t.Errorf("p50 = %v; want within (1ms, 2.5ms]", q)
+	}
+	if q := s.Quantile(0.95); q != 7500*time.Microsecond {
+		t.Errorf("p95 = %v; want 7.5ms, halfway through (5ms, 10ms]", q)
+	}
+	h.observe(time.Minute)
+	if q := h.snapshot().Quantile(1); q != 10*time.Second {
+		t.Errorf("p100 = %v; want the largest bound", q)
+	}
+}
+
+func TestPeerStats(t *testing.T) {
+	up := namedPeer{&fakePeer{}, "up"}
+	down := namedPeer{&fakePeer{fail: true}, "down"}
+	reg := NewRegistry()
+	g := reg.newGroup("TestPeerStats-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	}), fakePeers([]ProtoGetter{up, down, nil}), nil)
+
+	for i := 0; i < 30; i++ {
+		var s string
+		if err := g.Get(dummyCtx, fmt.Sprintf("key-%d", i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := g.PeerStats()
+	if st := stats["up"]; st.Requests != int64(up.hits) || st.Errors != 0 || st.Latency.Count() != st.Requests {
+		t.Errorf("up: %+v; want %d requests and no errors", st, up.hits)
+	}
+	if st := stats["down"]; st.Requests != int64(down.hits) || st.Errors != st.Requests {
+		t.Errorf("down: %+v; want %d failed requests", st, down.hits)
+	}
+	// Keys of the failing peer and of this process are loaded locally.
+	if n, want := g.LocalLoadLatency().Count(), g.Stats.LocalLoads.Get(); n != want {
+		t.Errorf("local load latency has %d observations; want %d", n, want)
+	}
+
+	if groups := reg.Groups(); len(groups) != 1 || groups[0] != g {
+		t.Errorf("Groups() = %v; want the one group", groups)
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lfu 实现了一个 LFU 缓存。
+package lfu
+
+import (
+	"container/list"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// Cache 是一个 LFU 缓存：淘汰访问次数最少的条目，
+// 次数相同时淘汰其中最久未使用的。它不是并发安全的。
+type Cache struct {
+	// MaxEntries 是在项目被淘汰前的最大缓存条目数。
+	// 零表示没有限制。
+	MaxEntries int
+
+	// OnEvicted 可选地指定一个回调函数，在条目
+	// 从缓存中清除时执行。
+	OnEvicted func(key Key, value interface{})
+
+	// freqs 按访问次数升序排列，每个元素是一个 *freqNode。
+	freqs *list.List
+	cache map[interface{}]*entry
+}
+
+// Key 可以是任何可比较的值，与 lru.Key 相同。
+type Key = lru.Key
+
+// freqNode 持有访问次数相同的所有条目，最近使用的在前。
+type freqNode struct {
+	freq  int
+	items *list.List
+}
+
+type entry struct {
+	key   Key
+	value interface{}
+	freq  *list.Element // 所在的 freqNode
+	item  *list.Element // 在 freqNode.items 中的位置
+}
+
+// New 创建一个新的 Cache。
+// 如果 maxEntries 为零，则缓存没有限制，假定
+// 淘汰由调用者完成。
+func New(maxEntries int) *Cache {
+	return &Cache{
+		MaxEntries: maxEntries,
+		freqs:      list.New(),
+		cache:      make(map[interface{}]*entry),
+	}
+}
+
+// Add 向缓存添加一个值。更新已有的键也算作一次访问。
+func (c *Cache) Add(key Key, value interface{}) {
+	if c.cache == nil {
+		c.cache = make(map[interface{}]*entry)
+		c.freqs = list.New()
+	}
+	if e, ok := c.cache[key]; ok {
+		e.value = value
+		c.touch(e)
+		return
+	}
+	e := &entry{key: key, value: value}
+	front := c.freqs.Front()
+	if front == nil || front.Value.(*freqNode).freq != 1 {
+		front = c.freqs.PushFront(&freqNode{freq: 1, items: list.New()})
+	}
+	e.freq = front
+	e.item = front.Value.(*freqNode).items.PushFront(e)
+	c.cache[key] = e
+	if c.MaxEntries != 0 && len(c.cache) > c.MaxEntries {
+		c.RemoveOldest()
+	}
+}
+
+// Get 从缓存中查找键的值。
+func (c *Cache) Get(key Key) (value interface{}, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if e, hit := c.cache[key]; hit {
+		c.touch(e)
+		return e.value, true
+	}
+	return
+}
+
+// touch 将 e 的访问次数加一，把它移到下一个 freqNode。
+func (c *Cache) touch(e *entry) {
+	cur := e.freq.Value.(*freqNode)
+	next := e.freq.Next()
+	if next == nil || next.Value.(*freqNode).freq != cur.freq+1 {
+		next = c.freqs.InsertAfter(&freqNode{freq: cur.freq + 1, items: list.New()}, e.freq)
+	}
+	cur.items.Remove(e.item)
+	if cur.items.Len() == 0 {
+		c.freqs.Remove(e.freq)
+	}
+	e.freq = next
+	e.item = next.Value.(*freqNode).items.PushFront(e)
+}
+
+// Peek 查找键的值，但不改变条目的访问次数。
+func (c *Cache) Peek(key Key) (value interface{}, ok bool) {
+	if e, hit := c.cache[key]; hit {
+		return e.value, true
+	}
+	return
+}
+
+// Remove 从缓存中移除提供的键。
+func (c *Cache) Remove(key Key) {
+	if c.cache == nil {
+		return
+	}
+	if e, hit := c.cache[key]; hit {
+		c.removeEntry(e)
+	}
+}
+
+// RemoveOldest 移除访问次数最少的条目中最久未使用的一个。
+func (c *Cache) RemoveOldest() {
+	if c.cache == nil {
+		return
+	}
+	if front := c.freqs.Front(); front != nil {
+		c.removeEntry(front.Value.(*freqNode).items.Back().Value.(*entry))
+	}
+}
+
+func (c *Cache) removeEntry(e *entry) {
+	node := e.freq.Value.(*freqNode)
+	node.items.Remove(e.item)
+	if node.items.Len() == 0 {
+		c.freqs.Remove(e.freq)
+	}
+	delete(c.cache, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Range 按淘汰的先后顺序对每个条目调用 f，直到 f 返回 false：
+// 访问次数少的在前，次数相同时最久未使用的在前。它不改变条目的
+// 访问次数，f 不能修改缓存。
+func (c *Cache) Range(f func(key Key, value interface{}) bool) {
+	if c.cache == nil {
+		return
+	}
+	for fe := c.freqs.Front(); fe != nil; fe = fe.Next() {
+		for ie := fe.Value.(*freqNode).items.Back(); ie != nil; ie = ie.Prev() {
+			e := ie.Value.(*entry)
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// Len 返回缓存中的项目数。
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Clear 清除缓存中所有存储的项目。
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, e := range c.cache {
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+	c.freqs = nil
+	c.cache = nil
+}
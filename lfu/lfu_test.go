@@ -0,0 +1,173 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lfu
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type simpleStruct struct {
+	int
+	string
+}
+
+type complexStruct struct {
+	int
+	simpleStruct
+}
+
+var getTests = []struct {
+	name       string
+	keyToAdd   interface{}
+	keyToGet   interface{}
+	expectedOk bool
+}{
+	{"string_hit", "myKey", "myKey", true},
+	{"string_miss", "myKey", "nonsense", false},
+	{"simple_struct_hit", simpleStruct{1, "two"}, simpleStruct{1, "two"}, true},
+	{"simple_struct_miss", simpleStruct{1, "two"}, simpleStruct{0, "noway"}, false},
+	{"complex_struct_hit", complexStruct{1, simpleStruct{2, "three"}},
+		complexStruct{1, simpleStruct{2, "three"}}, true},
+}
+
+func TestGet(t *testing.T) {
+	for _, tt := range getTests {
+		c := New(0)
+		c.Add(tt.keyToAdd, 1234)
+		val, ok := c.Get(tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("%s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	c := New(0)
+	c.Add("myKey", 1234)
+	if val, ok := c.Get("myKey"); !ok {
+		t.Fatal("TestRemove returned no match")
+	} else if val != 1234 {
+		t.Fatalf("TestRemove failed.  Expected %d, got %v", 1234, val)
+	}
+
+	c.Remove("myKey")
+	if _, ok := c.Get("myKey"); ok {
+		t.Fatal("TestRemove returned a removed entry")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	evictedKeys := make([]Key, 0)
+	onEvictedFun := func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+
+	c := New(20)
+	c.OnEvicted = onEvictedFun
+	for i := 0; i < 22; i++ {
+		c.Add(fmt.Sprintf("myKey%d", i), 1234)
+	}
+
+	if len(evictedKeys) != 2 {
+		t.Fatalf("got %d evicted keys; want 2", len(evictedKeys))
+	}
+	if evictedKeys[0] != Key("myKey0") {
+		t.Fatalf("got %v in first evicted key; want %s", evictedKeys[0], "myKey0")
+	}
+	if evictedKeys[1] != Key("myKey1") {
+		t.Fatalf("got %v in second evicted key; want %s", evictedKeys[1], "myKey1")
+	}
+	if c.Len() != 20 {
+		t.Fatalf("Len = %d; want 20", c.Len())
+	}
+}
+
+func TestEvictLeastFrequent(t *testing.T) {
+	var evicted []Key
+	c := New(2)
+	c.OnEvicted = func(key Key, value interface{}) { evicted = append(evicted, key) }
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Get("a")
+	c.Add("c", 3) // evicts b, the least frequently used
+	if len(evicted) != 1 || evicted[0] != Key("b") {
+		t.Fatalf("evicted %v; want [b]", evicted)
+	}
+	c.Add("d", 4) // c and d tie at one use; the older c goes
+	if len(evicted) != 2 || evicted[1] != Key("c") {
+		t.Fatalf("evicted %v; want [b c]", evicted)
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("frequently used key a was evicted")
+	}
+}
+
+func TestRange(t *testing.T) {
+	c := New(0)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("c", 3)
+	c.Get("a")
+	var keys []string
+	c.Range(func(key Key, value interface{}) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	if got := strings.Join(keys, " "); got != "b c a" {
+		t.Errorf("Range visited %q; want %q", got, "b c a")
+	}
+	n := 0
+	c.Range(func(Key, interface{}) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("Range continued after f returned false: %d calls", n)
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	c := New(1000)
+	for i := 0; i < b.N; i++ {
+		c.Add(i, i)
+	}
+}
+
+func BenchmarkGetHit(b *testing.B) {
+	c := New(1000)
+	for i := 0; i < 1000; i++ {
+		c.Add(i, i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get(i % 1000)
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	c := New(1000)
+	for i := 0; i < b.N; i++ {
+		key := i % 4000
+		if _, ok := c.Get(key); !ok {
+			c.Add(key, i)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// Logger 是 groupcache 使用的分级结构化日志接口。
+//
+// 它的方法与 *slog.Logger 的同名方法签名相同，因此 slog.Default()
+// 或任何 *slog.Logger 都可以直接使用。args 是交替的键和值，
+// groupcache 使用的键有 "group"、"key"、"peer"、"cache" 和 "err"。
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// debugEnabler 由可以报告是否输出某一级别日志的 Logger 实现，
+// 例如 *slog.Logger。
+type debugEnabler interface {
+	Enabled(ctx context.Context, level slog.Level) bool
+}
+
+// debugEnabled 报告 l 是否输出 Debug 日志。Debug 日志在每次加载和
+// 填充缓存时都会输出，调用者先检查它，关闭时就不必构造参数。
+// 没有实现 Enabled 的 Logger 视为输出。
+func debugEnabled(l Logger) bool {
+	switch l := l.(type) {
+	case nopLogger:
+		return false
+	case debugEnabler:
+		return l.Enabled(context.Background(), slog.LevelDebug)
+	}
+	return true
+}
+
+// nopLogger 丢弃所有日志，是默认的 Logger。
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// loggerBox 使不同动态类型的 Logger 可以存入同一个 atomic.Value。
+type loggerBox struct{ Logger }
+
+var pkgLogger atomic.Value // loggerBox
+
+// SetLogger 设置包级别的 Logger，没有在 GroupOptions 中指定 Logger
+// 的组以及对等体的传输层都使用它。l 为 nil 时恢复默认的静默行为。
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	pkgLogger.Store(loggerBox{l})
+}
+
+// logger 返回包级别的 Logger。
+func logger() Logger {
+	if b, ok := pkgLogger.Load().(loggerBox); ok {
+		return b.Logger
+	}
+	return nopLogger{}
+}
+
+// logger 返回组使用的 Logger。
+func (g *Group) logger() Logger {
+	if g.opts.Logger != nil {
+		return g.opts.Logger
+	}
+	return logger()
+}
+
+// debugEnabled 报告组的 Logger 是否输出 Debug 日志。
+func (g *Group) debugEnabled() bool {
+	return debugEnabled(g.logger())
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+type logRecord struct {
+	level, msg string
+	fields     map[string]interface{}
+}
+
+// recordLogger is a Logger that keeps every record in memory.
+type recordLogger struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+func (l *recordLogger) log(level, msg string, args []interface{}) {
+	r := logRecord{level: level, msg: msg, fields: make(map[string]interface{})}
+	for i := 0; i+1 < len(args); i += 2 {
+		r.fields[args[i].(string)] = args[i+1]
+	}
+	l.mu.Lock()
+	l.records = append(l.records, r)
+	l.mu.Unlock()
+}
+
+func (l *recordLogger) Debug(msg string, args ...interface{}) { l.log("debug", msg, args) }
+func (l *recordLogger) Info(msg string, args ...interface{})  { l.log("info", msg, args) }
+func (l *recordLogger) Warn(msg string, args ...interface{})  { l.log("warn", msg, args) }
+func (l *recordLogger) Error(msg string, args ...interface{}) { l.log("error", msg, args) }
+
+// find returns the first record with the given level whose fields include want.
+func (l *recordLogger) find(level string, want map[string]interface{}) (logRecord, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, r := range l.records {
+		if r.level != level {
+			continue
+		}
+		match := true
+		for k, v := range want {
+			if r.fields[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return r, true
+		}
+	}
+	return logRecord{}, false
+}
+
+func TestGroupLogger(t *testing.T) {
+	rl := new(recordLogger)
+	down := namedPeer{&fakePeer{fail: true}, "down"}
+	getter := GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value-" + key)
+	})
+	g := NewRegistry().newGroup("TestGroupLogger-group", cacheSize, getter, fakePeers([]ProtoGetter{down}), &GroupOptions{Logger: rl})
+
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.logger().(*recordLogger); !ok {
+		t.Fatalf("group logger = %T; want the one from GroupOptions", g.logger())
+	}
+	if _, ok := rl.find("warn", map[string]interface{}{"group": "TestGroupLogger-group", "key": "k", "peer": "down"}); !ok {
+		t.Errorf("no warning for the failed peer load; records = %+v", rl.records)
+	}
+	if _, ok := rl.find("debug", map[string]interface{}{"group": "TestGroupLogger-group", "key": "k", "cache": "main"}); !ok {
+		t.Errorf("no debug record for populating mainCache; records = %+v", rl.records)
+	}
+}
+
+func TestPackageLogger(t *testing.T) {
+	if _, ok := logger().(nopLogger); !ok {
+		t.Fatalf("default logger = %T; want nopLogger", logger())
+	}
+	rl := new(recordLogger)
+	SetLogger(rl)
+	defer SetLogger(nil)
+
+	g := NewRegistry().newGroup("TestPackageLogger-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return ErrNotFound
+	}), fakePeers(nil), nil)
+	var s string
+	if err := g.Get(dummyCtx, "missing", StringSink(&s)); err != ErrNotFound {
+		t.Fatalf("Get = %v; want ErrNotFound", err)
+	}
+	if _, ok := rl.find("debug", map[string]interface{}{"group": "TestPackageLogger-group", "key": "missing"}); !ok {
+		t.Errorf("package logger got no record; records = %+v", rl.records)
+	}
+}
+
+func TestDebugEnabled(t *testing.T) {
+	info := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	debug := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	for _, tc := range []struct {
+		l    Logger
+		want bool
+	}{
+		{nopLogger{}, false},
+		{info, false},
+		{debug, true},
+		{new(recordLogger), true},
+	} {
+		if got := debugEnabled(tc.l); got != tc.want {
+			t.Errorf("debugEnabled(%T) = %v; want %v", tc.l, got, tc.want)
+		}
+	}
+
+	// With debug logging off, the per-key debug calls cost no allocations.
+	g := NewRegistry().newGroup("TestDebugEnabled-group", cacheSize, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	}), fakePeers(nil), &GroupOptions{Logger: info})
+	if n := testing.AllocsPerRun(100, func() { g.localRemove("key") }); n != 0 {
+		t.Errorf("localRemove with debug logging off allocated %v times", n)
+	}
+}
@@ -18,6 +18,7 @@ package lru
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -95,3 +96,55 @@ func TestEvict(t *testing.T) {
 		t.Fatalf("got %v in second evicted key; want %s", evictedKeys[1], "myKey1")
 	}
 }
+
+func TestRange(t *testing.T) {
+	lru := New(0)
+	lru.Add("a", 1)
+	lru.Add("b", 2)
+	lru.Add("c", 3)
+	lru.Get("a")
+	var keys []string
+	lru.Range(func(key Key, value interface{}) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	if got := strings.Join(keys, " "); got != "b c a" {
+		t.Errorf("Range visited %q; want %q", got, "b c a")
+	}
+	n := 0
+	lru.Range(func(Key, interface{}) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("Range continued after f returned false: %d calls", n)
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	lru := New(1000)
+	for i := 0; i < b.N; i++ {
+		lru.Add(i, i)
+	}
+}
+
+func BenchmarkGetHit(b *testing.B) {
+	lru := New(1000)
+	for i := 0; i < 1000; i++ {
+		lru.Add(i, i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lru.Get(i % 1000)
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	lru := New(1000)
+	for i := 0; i < b.N; i++ {
+		key := i % 4000
+		if _, ok := lru.Get(key); !ok {
+			lru.Add(key, i)
+		}
+	}
+}
@@ -20,6 +20,7 @@ package groupcache
 
 import (
 	"context"
+	"time"
 
 	pb "github.com/golang/groupcache/groupcachepb"
 )
@@ -28,10 +29,39 @@ import (
 type Context = context.Context
 
 // ProtoGetter 是必须由对等体实现的接口。
+//
+// 对等体可以选择实现 Remover、SetterPeer、MultiGetter 和 HandoffPeer，
+// 组在调用前用类型断言检查它们。
 type ProtoGetter interface {
 	Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error
 }
 
+// Remover 是可以清除键的 ProtoGetter。Group.Remove 和 Group.Set 让
+// 它从本地缓存中清除键；作为所有者的对等体没有实现 Remover 时
+// Group.Remove 返回错误，其余没有实现的对等体被跳过。
+type Remover interface {
+	Remove(ctx context.Context, in *pb.RemoveRequest) error
+}
+
+// SetterPeer 是可以接收写入的 ProtoGetter。作为键的所有者时，它写穿
+// 该值并更新 mainCache；所有者没有实现 SetterPeer 时 Group.Set 返回错误。
+type SetterPeer interface {
+	Set(ctx context.Context, in *pb.SetRequest) error
+}
+
+// MultiGetter 是可以在一次请求中获取多个键的 ProtoGetter，每个键的
+// 结果单独报告。没有实现它的对等体的键由 Group.GetMulti 逐个 Get。
+type MultiGetter interface {
+	GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error
+}
+
+// HandoffPeer 是可以接收交接的 ProtoGetter：成员变化后改由它保存的
+// 条目被交给它，它只把按自己的 PeerPicker 保存的键加入 mainCache。
+// 没有实现它的对等体不参与交接。
+type HandoffPeer interface {
+	Handoff(ctx context.Context, in *pb.HandoffRequest, out *pb.HandoffResponse) error
+}
+
 // PeerPicker 是必须实现的接口，用于定位
 // 拥有特定键的对等体。
 type PeerPicker interface {
@@ -41,24 +71,63 @@ type PeerPicker interface {
 	PickPeer(key string) (peer ProtoGetter, ok bool)
 }
 
+// PeerLister 是可以列出所有对等体的 PeerPicker。Remove 和 Set 只能
+// 把清除广播到实现了它的 PeerPicker 列出的对等体。
+type PeerLister interface {
+	// GetAll 返回除当前对等体以外的所有对等体。
+	GetAll() []ProtoGetter
+}
+
+// ReplicaPicker 是可以为键选出多个副本的 PeerPicker。
+// GroupOptions.ReplicationFactor 大于 1 时，组在所有者失败后依次
+// 从其余副本加载。
+type ReplicaPicker interface {
+	PeerPicker
+
+	// PickPeers 返回键的至多 n 个副本，按优先级排列，第一个是
+	// PickPeer 选出的所有者。当前对等体以 nil 表示。
+	PickPeers(key string, n int) []ProtoGetter
+}
+
+// OwnerPicker 是可以给出键在环上真正所有者的 PeerPicker。PickPeer
+// 可能在所有者不可用时回退到其他对等体；Set 改用 PickOwner，使写入
+// 只发送到真正的所有者，而不会写进回退节点的 mainCache。
+type OwnerPicker interface {
+	PeerPicker
+
+	// PickOwner 返回键的所有者，不跳过熔断器打开的对等体。
+	// 如果键所有者是当前对等体，则返回 nil, false。
+	PickOwner(key string) (peer ProtoGetter, ok bool)
+}
+
+// HedgingPicker 是支持对冲加载请求的 PeerPicker。向对等体的加载请求
+// 超过 HedgeDelay 仍未返回时，组向下一个副本发出第二个请求，没有其他
+// 副本时改为本地加载，采用先返回的结果并通过 ctx 取消另一个请求。
+type HedgingPicker interface {
+	PeerPicker
+
+	// HedgeDelay 返回向 peer 的加载请求等待多久之后发出对冲请求，
+	// latency 是组观测到的 peer 的延迟。ok 为 false 表示不对冲。
+	HedgeDelay(peer ProtoGetter, latency LatencyStats) (delay time.Duration, ok bool)
+
+	// AllowHedge 在发出对冲请求之前调用，从重试预算中扣除一次。
+	// 预算用尽时返回 false，不发出对冲请求。
+	AllowHedge() bool
+}
+
 // NoPeers 是 PeerPicker 的一个实现，它永远不会找到对等体。
 type NoPeers struct{}
 
 func (NoPeers) PickPeer(key string) (peer ProtoGetter, ok bool) { return }
 
-var (
-	portPicker func(groupName string) PeerPicker
-)
-
 // RegisterPeerPicker 注册对等体初始化函数。
 // 它在创建第一个组时被调用一次。
 // RegisterPeerPicker 或 RegisterPerGroupPeerPicker 应该
 // 正好被调用一次，但不能同时调用两者。
+//
+// 它在 DefaultRegistry 中注册；独立的集群应使用各自的 Registry。
 func RegisterPeerPicker(fn func() PeerPicker) {
-	if portPicker != nil {
-		panic("RegisterPeerPicker called more than once")
-	}
-	portPicker = func(_ string) PeerPicker { return fn() }
+	DefaultRegistry.RegisterPeerPicker(fn)
 }
 
 // RegisterPerGroupPeerPicker 注册对等体初始化函数，
@@ -67,19 +136,5 @@ func RegisterPeerPicker(fn func() PeerPicker) {
 // RegisterPeerPicker 或 RegisterPerGroupPeerPicker 应该
 // 正好被调用一次，但不能同时调用两者。
 func RegisterPerGroupPeerPicker(fn func(groupName string) PeerPicker) {
-	if portPicker != nil {
-		panic("RegisterPeerPicker called more than once")
-	}
-	portPicker = fn
-}
-
-func getPeers(groupName string) PeerPicker {
-	if portPicker == nil {
-		return NoPeers{}
-	}
-	pk := portPicker(groupName)
-	if pk == nil {
-		pk = NoPeers{}
-	}
-	return pk
+	DefaultRegistry.RegisterPerGroupPeerPicker(fn)
 }
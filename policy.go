@@ -0,0 +1,102 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"github.com/golang/groupcache/arc"
+	"github.com/golang/groupcache/lfu"
+	"github.com/golang/groupcache/lru"
+	"github.com/golang/groupcache/tinylfu"
+)
+
+// EvictionPolicy 是 Group 的 mainCache 和 hotCache 使用的淘汰策略。
+// 缓存的大小由 Group 按字节数控制：超出限制时它反复调用
+// RemoveOldest，由策略决定淘汰哪个条目。
+//
+// 实现不需要是并发安全的。lru.Cache、lfu.Cache、arc.Cache
+// 和 tinylfu.Cache 都实现了该接口。
+type EvictionPolicy interface {
+	Add(key lru.Key, value interface{})
+	Get(key lru.Key) (value interface{}, ok bool)
+	Remove(key lru.Key)
+	// RemoveOldest 按策略淘汰一个条目；缓存非空时必须移除一个条目。
+	RemoveOldest()
+	Len() int
+}
+
+// RangePolicy 是可以遍历条目的 EvictionPolicy，Group.Snapshot 需要它。
+// 内置的四个策略都实现了它。
+type RangePolicy interface {
+	EvictionPolicy
+
+	// Range 大致按淘汰的先后顺序对每个条目调用 f，直到 f 返回 false。
+	// 它不改变条目的顺序或访问次数，f 不能修改缓存。
+	Range(f func(key lru.Key, value interface{}) bool)
+}
+
+// PeekPolicy 是可以不改变条目的顺序或访问次数就查看条目的
+// EvictionPolicy。缓存在覆盖或交接条目之前用 Peek 检查键是否存在，
+// 没有实现它的策略改用 Get，这次检查会被当作一次访问。
+// 内置的四个策略都实现了它。
+type PeekPolicy interface {
+	EvictionPolicy
+
+	// Peek 查找键的值，但不改变条目的顺序或访问次数。
+	Peek(key lru.Key) (value interface{}, ok bool)
+}
+
+var (
+	_ RangePolicy = (*lru.Cache)(nil)
+	_ RangePolicy = (*lfu.Cache)(nil)
+	_ RangePolicy = (*arc.Cache)(nil)
+	_ RangePolicy = (*tinylfu.Cache)(nil)
+
+	_ PeekPolicy = (*lru.Cache)(nil)
+	_ PeekPolicy = (*lfu.Cache)(nil)
+	_ PeekPolicy = (*arc.Cache)(nil)
+	_ PeekPolicy = (*tinylfu.Cache)(nil)
+)
+
+// PolicyFunc 创建一个不限条目数的 EvictionPolicy。
+// 策略必须在移除任何条目时调用 onEvicted。
+type PolicyFunc func(onEvicted func(key lru.Key, value interface{})) EvictionPolicy
+
+// LRUPolicy 淘汰最久未使用的条目。它是默认策略。
+func LRUPolicy(onEvicted func(key lru.Key, value interface{})) EvictionPolicy {
+	return &lru.Cache{OnEvicted: onEvicted}
+}
+
+// LFUPolicy 淘汰访问次数最少的条目。
+func LFUPolicy(onEvicted func(key lru.Key, value interface{})) EvictionPolicy {
+	c := lfu.New(0)
+	c.OnEvicted = onEvicted
+	return c
+}
+
+// ARCPolicy 使用自适应替换缓存，兼顾最近性和频率。
+func ARCPolicy(onEvicted func(key lru.Key, value interface{})) EvictionPolicy {
+	c := arc.New(0)
+	c.OnEvicted = onEvicted
+	return c
+}
+
+// TinyLFUPolicy 使用 W-TinyLFU，适合扫描较多的负载。
+func TinyLFUPolicy(onEvicted func(key lru.Key, value interface{})) EvictionPolicy {
+	c := tinylfu.New(0)
+	c.OnEvicted = onEvicted
+	return c
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/golang/groupcache/lru"
+)
+
+var policies = []struct {
+	name   string
+	policy PolicyFunc
+}{
+	{"lru", LRUPolicy},
+	{"lfu", LFUPolicy},
+	{"arc", ARCPolicy},
+	{"tinylfu", TinyLFUPolicy},
+}
+
+func TestPolicies(t *testing.T) {
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			const maxBytes = 1 << 9
+			getter := GetterFunc(func(_ context.Context, key string, dest Sink) error {
+				return dest.SetString("value-of-" + key)
+			})
+			g := NewRegistry().NewGroupOpts("TestPolicies", maxBytes, getter, &GroupOptions{Policy: p.policy})
+			// Half the requests go to a small hot set, the rest cycle
+			// through more keys than fit in the cache.
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("key-%d", i%5)
+				if i%2 == 1 {
+					key = fmt.Sprintf("key-%d", i%50)
+				}
+				var got string
+				if err := g.Get(dummyCtx, key, StringSink(&got)); err != nil {
+					t.Fatal(err)
+				}
+				if want := "value-of-" + key; got != want {
+					t.Fatalf("Get(%q) = %q; want %q", key, got, want)
+				}
+			}
+			main, hot := g.CacheStats(MainCache), g.CacheStats(HotCache)
+			if total := main.Bytes + hot.Bytes; total > maxBytes {
+				t.Errorf("caches hold %d bytes; want at most %d", total, maxBytes)
+			}
+			if main.Evictions == 0 {
+				t.Error("no evictions from a cache over its byte budget")
+			}
+			if main.Hits == 0 {
+				t.Error("no cache hits")
+			}
+		})
+	}
+}
+
+// TestPolicyPeek checks that Peek does not count as an access: a cache whose
+// entry was peeked at evicts the same entry as one left untouched.
+func TestPolicyPeek(t *testing.T) {
+	for _, p := range policies {
+		peeked, untouched := p.policy(nil).(PeekPolicy), p.policy(nil).(PeekPolicy)
+		for _, c := range []PeekPolicy{peeked, untouched} {
+			c.Add("a", 1)
+			c.Add("b", 2)
+		}
+		for i := 0; i < 3; i++ {
+			if v, ok := peeked.Peek("a"); !ok || v != 1 {
+				t.Fatalf("%s: Peek(a) = %v, %v", p.name, v, ok)
+			}
+		}
+		if _, ok := peeked.Peek("missing"); ok {
+			t.Errorf("%s: Peek(missing) found an entry", p.name)
+		}
+		peeked.RemoveOldest()
+		untouched.RemoveOldest()
+		for _, key := range []string{"a", "b"} {
+			_, got := peeked.Peek(key)
+			_, want := untouched.Peek(key)
+			if got != want {
+				t.Errorf("%s: after Peek and RemoveOldest, %q cached = %v; want %v", p.name, key, got, want)
+			}
+		}
+	}
+}
+
+// BenchmarkPolicyHitRatio replays a workload of a skewed hot set mixed
+// with one-off scan keys against each policy and reports the hit ratio.
+func BenchmarkPolicyHitRatio(b *testing.B) {
+	const (
+		capacity = 1000
+		hotKeys  = 2000
+	)
+	for _, p := range policies {
+		b.Run(p.name, func(b *testing.B) {
+			c := p.policy(nil)
+			r := rand.New(rand.NewSource(1))
+			zipf := rand.NewZipf(r, 1.1, 1, hotKeys-1)
+			var hits, gets int
+			scan := 0
+			for i := 0; i < b.N; i++ {
+				var key lru.Key
+				if i%3 == 0 {
+					scan++
+					key = fmt.Sprint("scan-", scan)
+				} else {
+					key = zipf.Uint64()
+				}
+				gets++
+				if _, ok := c.Get(key); ok {
+					hits++
+					continue
+				}
+				c.Add(key, i)
+				for c.Len() > capacity {
+					c.RemoveOldest()
+				}
+			}
+			b.ReportMetric(float64(hits)/float64(gets), "hits/op")
+		})
+	}
+}
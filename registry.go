@@ -0,0 +1,204 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/golang/groupcache/singleflight"
+)
+
+// Registry 是一组组及其对等体选择器的作用域。
+//
+// 同一个进程中的不同 Registry 相互独立：每个 Registry 有自己的
+// 组名空间、PeerPicker 和钩子，因此一个二进制文件可以加入多个
+// 独立的集群，测试也可以在单个进程内启动多节点集群。
+// 包级别的函数（NewGroup、GetGroup、RegisterPeerPicker 等）
+// 作用于 DefaultRegistry。
+type Registry struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+
+	portPicker func(groupName string) PeerPicker
+
+	initPeerServerOnce sync.Once
+	initPeerServer     func()
+
+	// newGroupHook，如果非 nil，会在创建新组后立即被调用。
+	newGroupHook func(*Group)
+}
+
+// DefaultRegistry 是包级别函数使用的 Registry。
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry 返回一个新的空 Registry。
+func NewRegistry() *Registry {
+	return &Registry{groups: make(map[string]*Group)}
+}
+
+// GetGroup 返回之前在 r 中用 NewGroup 创建的命名组，
+// 如果没有这样的组，则返回 nil。
+func (r *Registry) GetGroup(name string) *Group {
+	r.mu.RLock()
+	g := r.groups[name]
+	r.mu.RUnlock()
+	return g
+}
+
+// Groups 返回 r 中所有的组，按名称排序。
+func (r *Registry) Groups() []*Group {
+	r.mu.RLock()
+	groups := make([]*Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, g)
+	}
+	r.mu.RUnlock()
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups
+}
+
+// NewGroup 与包级别的 NewGroup 相同，但在 r 中创建组。
+// 组名在每个 Registry 内必须是唯一的。
+func (r *Registry) NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+	return r.newGroup(name, cacheBytes, getter, nil, nil)
+}
+
+// NewGroupOpts 与包级别的 NewGroupOpts 相同，但在 r 中创建组。
+func (r *Registry) NewGroupOpts(name string, cacheBytes int64, getter Getter, o *GroupOptions) *Group {
+	return r.newGroup(name, cacheBytes, getter, nil, o)
+}
+
+// 如果 peers 为 nil，则通过 sync.Once 调用 r 的 peerPicker 来初始化它。
+func (r *Registry) newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker, o *GroupOptions) *Group {
+	if getter == nil {
+		panic("nil Getter")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.initPeerServerOnce.Do(r.callInitPeerServer)
+	if _, dup := r.groups[name]; dup {
+		panic("duplicate registration of group " + name)
+	}
+	g := &Group{
+		name:      name,
+		registry:  r,
+		getter:    getter,
+		peers:     peers,
+		loadGroup: &singleflight.Group{},
+	}
+	g.cacheBytes.Store(cacheBytes)
+	if o != nil {
+		g.opts = *o
+	}
+	if g.opts.CacheShards == 0 {
+		g.opts.CacheShards = runtime.GOMAXPROCS(0)
+	}
+	g.mainCache.init("main", g.opts.CacheShards, g.opts.Policy)
+	g.hotCache.init("hot", g.opts.CacheShards, g.opts.Policy)
+	if g.opts.NotFoundTTL == 0 {
+		g.opts.NotFoundTTL = defaultNotFoundTTL
+	}
+	if g.opts.HotKeyQPS == 0 {
+		g.opts.HotKeyQPS = defaultHotKeyQPS
+	}
+	if g.opts.HotKeyLocalQPS == 0 {
+		g.opts.HotKeyLocalQPS = g.opts.HotKeyQPS / 10
+	}
+	if g.opts.CompressMinBytes == 0 {
+		g.opts.CompressMinBytes = defaultCompressMinBytes
+	}
+	if fn := r.newGroupHook; fn != nil {
+		fn(g)
+	}
+	r.groups[name] = g
+	return g
+}
+
+// DeregisterGroup 关闭并注销 r 中的命名组，参见 Group.Close。
+// 如果没有这样的组，则返回 false。
+func (r *Registry) DeregisterGroup(name string) bool {
+	g := r.GetGroup(name)
+	if g == nil {
+		return false
+	}
+	g.Close()
+	return true
+}
+
+// deregister 从 r 中移除 g；如果该名字已经被新组占用，则不做任何事。
+func (r *Registry) deregister(g *Group) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.groups[g.name] == g {
+		delete(r.groups, g.name)
+	}
+}
+
+// RegisterNewGroupHook 注册一个在 r 中每次创建组时运行的钩子。
+func (r *Registry) RegisterNewGroupHook(fn func(*Group)) {
+	if r.newGroupHook != nil {
+		panic("RegisterNewGroupHook called more than once")
+	}
+	r.newGroupHook = fn
+}
+
+// RegisterServerStart 注册一个在 r 中创建第一个组时运行的钩子。
+func (r *Registry) RegisterServerStart(fn func()) {
+	if r.initPeerServer != nil {
+		panic("RegisterServerStart called more than once")
+	}
+	r.initPeerServer = fn
+}
+
+func (r *Registry) callInitPeerServer() {
+	if r.initPeerServer != nil {
+		r.initPeerServer()
+	}
+}
+
+// RegisterPeerPicker 为 r 注册对等体初始化函数。
+// 它在 r 中创建第一个组时被调用一次。每个 Registry 上
+// RegisterPeerPicker 或 RegisterPerGroupPeerPicker 应该
+// 正好被调用一次，但不能同时调用两者。
+func (r *Registry) RegisterPeerPicker(fn func() PeerPicker) {
+	if r.portPicker != nil {
+		panic("RegisterPeerPicker called more than once")
+	}
+	r.portPicker = func(_ string) PeerPicker { return fn() }
+}
+
+// RegisterPerGroupPeerPicker 为 r 注册对等体初始化函数，
+// 该函数接受 groupName 参数，用于选择 PeerPicker。
+func (r *Registry) RegisterPerGroupPeerPicker(fn func(groupName string) PeerPicker) {
+	if r.portPicker != nil {
+		panic("RegisterPeerPicker called more than once")
+	}
+	r.portPicker = fn
+}
+
+func (r *Registry) getPeers(groupName string) PeerPicker {
+	if r.portPicker == nil {
+		return NoPeers{}
+	}
+	pk := r.portPicker(groupName)
+	if pk == nil {
+		pk = NoPeers{}
+	}
+	return pk
+}
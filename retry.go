@@ -0,0 +1,116 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// retryBudgetBurst 是重试预算中最多积累的令牌数，也是初始的令牌数，
+// 使流量很小时也能重试。
+const retryBudgetBurst = 10
+
+// retryBudget 限制重试和对冲请求占原始请求的比例，使它们不会在对等体
+// 故障时成倍放大负载。每个原始请求存入 ratio 个令牌，每个重试或对冲
+// 请求取出一个。nil 的 *retryBudget 不限制。
+type retryBudget struct {
+	ratio float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+func newRetryBudget(ratio float64) *retryBudget {
+	return &retryBudget{ratio: ratio, tokens: retryBudgetBurst}
+}
+
+// deposit 记录一个原始请求。
+func (b *retryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > retryBudgetBurst {
+		b.tokens = retryBudgetBurst
+	}
+}
+
+// withdraw 为一个重试或对冲请求取出一个令牌，令牌不足时返回 false。
+func (b *retryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// isRetryable 报告 err 是否值得重试：网络错误、无法解析的响应和对等体
+// 暂时不可用的 502、503、504 响应。对等体转达的 Getter 或后端数据源的
+// 错误不重试，否则会成倍放大已经故障的数据源的负载。
+func isRetryable(err error) bool {
+	var se *statusError
+	switch {
+	case !isPeerFailure(err), errors.Is(err, ErrCircuitOpen):
+		return false
+	case errors.As(err, &se):
+		switch se.code {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return !se.getter
+		}
+		return false
+	}
+	return true
+}
+
+// retry 调用 fn，失败可以重试时按指数退避重试至多 retries 次，每次等待
+// backoff 的两倍并加上至多一半的随机抖动。预算用尽、熔断器打开或
+// ctx 结束时停止重试。
+func retry(ctx context.Context, retries int, backoff time.Duration, budget *retryBudget, fn func() error) error {
+	budget.deposit()
+	err := fn()
+	for i := 0; i < retries && isRetryable(err); i++ {
+		if ctx.Err() != nil || !budget.withdraw() {
+			break
+		}
+		wait := backoff
+		if backoff > 1 {
+			wait += time.Duration(rand.Int63n(int64(backoff / 2)))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+		err = fn()
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(0.5)
+	for i := 0; i < retryBudgetBurst; i++ {
+		if !b.withdraw() {
+			t.Fatalf("withdraw %d failed within the initial burst", i)
+		}
+	}
+	if b.withdraw() {
+		t.Fatal("withdraw succeeded with an empty budget")
+	}
+	b.deposit()
+	b.deposit()
+	if !b.withdraw() || b.withdraw() {
+		t.Error("two requests at ratio 0.5 should pay for exactly one retry")
+	}
+	for i := 0; i < 100; i++ {
+		b.deposit()
+	}
+	if b.tokens != retryBudgetBurst {
+		t.Errorf("tokens = %v; want capped at %d", b.tokens, retryBudgetBurst)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	failure := errors.New("connection reset")
+	calls := 0
+	fail := func(n int) func() error {
+		calls = 0
+		return func() error {
+			calls++
+			if calls <= n {
+				return failure
+			}
+			return nil
+		}
+	}
+
+	if err := retry(dummyCtx, 3, time.Millisecond, nil, fail(2)); err != nil || calls != 3 {
+		t.Errorf("retry = %v after %d calls; want success after 3", err, calls)
+	}
+	if err := retry(dummyCtx, 1, time.Millisecond, nil, fail(5)); err != failure || calls != 2 {
+		t.Errorf("retry = %v after %d calls; want failure after 2", err, calls)
+	}
+
+	// Answers from a healthy peer, Getter errors passed on by the owner,
+	// other 5xx answers and open circuits are not retried.
+	for _, want := range []error{
+		ErrNotFound,
+		ErrCircuitOpen,
+		&statusError{code: 400, status: "400 Bad Request"},
+		&statusError{code: 500, status: "500 Internal Server Error"},
+		&statusError{code: 502, status: "502 Bad Gateway", getter: true},
+	} {
+		calls = 0
+		err := retry(dummyCtx, 3, time.Millisecond, nil, func() error { calls++; return want })
+		if err != want || calls != 1 {
+			t.Errorf("retry(%v) called fn %d times; want 1", want, calls)
+		}
+	}
+
+	unavailable := &statusError{code: 503, status: "503 Service Unavailable"}
+	calls = 0
+	if err := retry(dummyCtx, 2, time.Millisecond, nil, func() error { calls++; return unavailable }); err != unavailable || calls != 3 {
+		t.Errorf("retry(503) = %v after %d calls; want 3 calls", err, calls)
+	}
+
+	// An empty budget stops retries.
+	b := newRetryBudget(0.1)
+	b.tokens = 0
+	if err := retry(dummyCtx, 3, time.Millisecond, b, fail(1)); err != failure || calls != 1 {
+		t.Errorf("retry with an empty budget = %v after %d calls; want 1 call", err, calls)
+	}
+
+	// So does the end of the context.
+	ctx, cancel := context.WithCancel(dummyCtx)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if err := retry(ctx, 3, time.Hour, nil, fail(5)); err != failure || time.Since(start) > time.Second {
+		t.Errorf("retry = %v after %v; want to stop when ctx is done", err, time.Since(start))
+	}
+}
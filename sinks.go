@@ -18,6 +18,9 @@ package groupcache
 
 import (
 	"errors"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -37,6 +40,28 @@ type Sink interface {
 	// 调用者保留 m 的所有权。
 	SetProto(m proto.Message) error
 
+	// SetStringWithExpiry 与 SetString 相同，但值在 e 时刻过期。
+	// 零值 e 表示永不过期。
+	SetStringWithExpiry(s string, e time.Time) error
+
+	// SetBytesWithExpiry 与 SetBytes 相同，但值在 e 时刻过期。
+	// 零值 e 表示永不过期。
+	SetBytesWithExpiry(v []byte, e time.Time) error
+
+	// SetProtoWithExpiry 与 SetProto 相同，但值在 e 时刻过期。
+	// 零值 e 表示永不过期。
+	SetProtoWithExpiry(m proto.Message, e time.Time) error
+
+	// SetReader 将值设置为从 r 读到 EOF 的内容。值被直接读入为它
+	// 分配的内存，不经过中间缓冲区；r 实现了 Len() int 时（例如
+	// *bytes.Reader）按它预先分配，长度准确时只分配一次。StringSink
+	// 在 r 没有实现 io.WriterTo 时还要把读到的字节复制成字符串。
+	SetReader(r io.Reader) error
+
+	// SetReaderWithExpiry 与 SetReader 相同，但值在 e 时刻过期。
+	// 零值 e 表示永不过期。
+	SetReaderWithExpiry(r io.Reader, e time.Time) error
+
 	// view 返回用于缓存的字节的冻结视图。
 	view() (ByteView, error)
 }
@@ -54,13 +79,26 @@ func setSinkView(s Sink, v ByteView) error {
 	type viewSetter interface {
 		setView(v ByteView) error
 	}
+	// encodedViewSetter 是接收压缩的视图而不解压的 Sink。
+	type encodedViewSetter interface {
+		setEncodedView(v ByteView) error
+	}
+	if v.codec != nil {
+		if es, ok := s.(encodedViewSetter); ok {
+			return es.setEncodedView(v)
+		}
+		var err error
+		if v, err = v.decode(); err != nil {
+			return err
+		}
+	}
 	if vs, ok := s.(viewSetter); ok {
 		return vs.setView(v)
 	}
 	if v.b != nil {
-		return s.SetBytes(v.b)
+		return s.SetBytesWithExpiry(v.b, v.e)
 	}
-	return s.SetString(v.s)
+	return s.SetStringWithExpiry(v.s, v.e)
 }
 
 // StringSink 返回一个填充提供的字符串指针的 Sink。
@@ -80,8 +118,7 @@ func (s *stringSink) view() (ByteView, error) {
 }
 
 func (s *stringSink) SetString(v string) error {
-	s.v.b = nil
-	s.v.s = v
+	s.v = ByteView{s: v}
 	*s.sp = v
 	return nil
 }
@@ -95,11 +132,60 @@ func (s *stringSink) SetProto(m proto.Message) error {
 	if err != nil {
 		return err
 	}
-	s.v.b = b
+	s.v = ByteView{b: b}
 	*s.sp = string(b)
 	return nil
 }
 
+func (s *stringSink) SetStringWithExpiry(v string, e time.Time) error {
+	s.SetString(v)
+	s.v.e = e
+	return nil
+}
+
+func (s *stringSink) SetBytesWithExpiry(v []byte, e time.Time) error {
+	return s.SetStringWithExpiry(string(v), e)
+}
+
+func (s *stringSink) SetProtoWithExpiry(m proto.Message, e time.Time) error {
+	if err := s.SetProto(m); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
+func (s *stringSink) SetReader(r io.Reader) error {
+	wt, ok := r.(io.WriterTo)
+	if !ok {
+		// 字符串不能被原地填充，先读入字节再复制一次。
+		b, err := readValue(r)
+		if err != nil {
+			return err
+		}
+		s.v = ByteView{b: b}
+		*s.sp = string(b)
+		return nil
+	}
+	// r 直接写入预先分配的 strings.Builder，String 不再复制。
+	var b strings.Builder
+	if l, ok := r.(lener); ok {
+		b.Grow(l.Len())
+	}
+	if _, err := wt.WriteTo(&b); err != nil {
+		return err
+	}
+	return s.SetString(b.String())
+}
+
+func (s *stringSink) SetReaderWithExpiry(r io.Reader, e time.Time) error {
+	if err := s.SetReader(r); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
 // ByteViewSink 返回一个填充 ByteView 的 Sink。
 func ByteViewSink(dst *ByteView) Sink {
 	if dst == nil {
@@ -148,6 +234,37 @@ func (s *byteViewSink) SetString(v string) error {
 	return nil
 }
 
+func (s *byteViewSink) SetProtoWithExpiry(m proto.Message, e time.Time) error {
+	if err := s.SetProto(m); err != nil {
+		return err
+	}
+	s.dst.e = e
+	return nil
+}
+
+func (s *byteViewSink) SetBytesWithExpiry(b []byte, e time.Time) error {
+	*s.dst = ByteView{b: cloneBytes(b), e: e}
+	return nil
+}
+
+func (s *byteViewSink) SetStringWithExpiry(v string, e time.Time) error {
+	*s.dst = ByteView{s: v, e: e}
+	return nil
+}
+
+func (s *byteViewSink) SetReader(r io.Reader) error {
+	return s.SetReaderWithExpiry(r, time.Time{})
+}
+
+func (s *byteViewSink) SetReaderWithExpiry(r io.Reader, e time.Time) error {
+	b, err := readValue(r)
+	if err != nil {
+		return err
+	}
+	*s.dst = ByteView{b: b, e: e}
+	return nil
+}
+
 // ProtoSink 返回一个 sink，将二进制 proto 值解组到 m 中。
 func ProtoSink(m proto.Message) Sink {
 	return &protoSink{
@@ -171,8 +288,7 @@ func (s *protoSink) SetBytes(b []byte) error {
 	if err != nil {
 		return err
 	}
-	s.v.b = cloneBytes(b)
-	s.v.s = ""
+	s.v = ByteView{b: cloneBytes(b)}
 	return nil
 }
 
@@ -182,8 +298,7 @@ func (s *protoSink) SetString(v string) error {
 	if err != nil {
 		return err
 	}
-	s.v.b = b
-	s.v.s = ""
+	s.v = ByteView{b: b}
 	return nil
 }
 
@@ -199,8 +314,51 @@ func (s *protoSink) SetProto(m proto.Message) error {
 	if err != nil {
 		return err
 	}
-	s.v.b = b
-	s.v.s = ""
+	s.v = ByteView{b: b}
+	return nil
+}
+
+func (s *protoSink) SetBytesWithExpiry(b []byte, e time.Time) error {
+	if err := s.SetBytes(b); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
+func (s *protoSink) SetStringWithExpiry(v string, e time.Time) error {
+	if err := s.SetString(v); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
+func (s *protoSink) SetProtoWithExpiry(m proto.Message, e time.Time) error {
+	if err := s.SetProto(m); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
+func (s *protoSink) SetReader(r io.Reader) error {
+	b, err := readValue(r)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(b, s.dst); err != nil {
+		return err
+	}
+	s.v = ByteView{b: b}
+	return nil
+}
+
+func (s *protoSink) SetReaderWithExpiry(r io.Reader, e time.Time) error {
+	if err := s.SetReader(r); err != nil {
+		return err
+	}
+	s.v.e = e
 	return nil
 }
 
@@ -247,8 +405,7 @@ func (s *allocBytesSink) setBytesOwned(b []byte) error {
 		return errors.New("nil AllocatingByteSliceSink *[]byte dst")
 	}
 	*s.dst = cloneBytes(b) // 另一个副本，保护只读的 s.v.b 视图
-	s.v.b = b
-	s.v.s = ""
+	s.v = ByteView{b: b}
 	return nil
 }
 
@@ -257,8 +414,47 @@ func (s *allocBytesSink) SetString(v string) error {
 		return errors.New("nil AllocatingByteSliceSink *[]byte dst")
 	}
 	*s.dst = []byte(v)
-	s.v.b = nil
-	s.v.s = v
+	s.v = ByteView{s: v}
+	return nil
+}
+
+func (s *allocBytesSink) SetProtoWithExpiry(m proto.Message, e time.Time) error {
+	if err := s.SetProto(m); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
+func (s *allocBytesSink) SetBytesWithExpiry(b []byte, e time.Time) error {
+	if err := s.SetBytes(b); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
+func (s *allocBytesSink) SetStringWithExpiry(v string, e time.Time) error {
+	if err := s.SetString(v); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
+func (s *allocBytesSink) SetReader(r io.Reader) error {
+	b, err := readValue(r)
+	if err != nil {
+		return err
+	}
+	return s.setBytesOwned(b)
+}
+
+func (s *allocBytesSink) SetReaderWithExpiry(r io.Reader, e time.Time) error {
+	if err := s.SetReader(r); err != nil {
+		return err
+	}
+	s.v.e = e
 	return nil
 }
 
@@ -298,8 +494,7 @@ func (s *truncBytesSink) setBytesOwned(b []byte) error {
 	if n < len(*s.dst) {
 		*s.dst = (*s.dst)[:n]
 	}
-	s.v.b = b
-	s.v.s = ""
+	s.v = ByteView{b: b}
 	return nil
 }
 
@@ -311,7 +506,46 @@ func (s *truncBytesSink) SetString(v string) error {
 	if n < len(*s.dst) {
 		*s.dst = (*s.dst)[:n]
 	}
-	s.v.b = nil
-	s.v.s = v
+	s.v = ByteView{s: v}
+	return nil
+}
+
+func (s *truncBytesSink) SetProtoWithExpiry(m proto.Message, e time.Time) error {
+	if err := s.SetProto(m); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
+func (s *truncBytesSink) SetBytesWithExpiry(b []byte, e time.Time) error {
+	if err := s.SetBytes(b); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
+func (s *truncBytesSink) SetStringWithExpiry(v string, e time.Time) error {
+	if err := s.SetString(v); err != nil {
+		return err
+	}
+	s.v.e = e
+	return nil
+}
+
+func (s *truncBytesSink) SetReader(r io.Reader) error {
+	b, err := readValue(r)
+	if err != nil {
+		return err
+	}
+	return s.setBytesOwned(b)
+}
+
+func (s *truncBytesSink) SetReaderWithExpiry(r io.Reader, e time.Time) error {
+	if err := s.SetReader(r); err != nil {
+		return err
+	}
+	s.v.e = e
 	return nil
 }
@@ -0,0 +1,272 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+const (
+	snapshotMagic   = "GCSNAP"
+	snapshotVersion = 1
+
+	// snapshotHasExpire 是条目的 flags 中表示有过期时间的位。
+	snapshotHasExpire = 1 << 0
+
+	// maxSnapshotEntryBytes 是快照中键或值的最大字节数。Snapshot 不写出
+	// 更大的条目，Restore 把更大的长度视为快照损坏，不按它分配内存。
+	maxSnapshotEntryBytes = 64 << 20
+)
+
+var snapshotTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrBadSnapshot 表示 Restore 读到的快照格式错误、版本不受支持或
+// 校验和不符。
+var ErrBadSnapshot = errors.New("groupcache: bad snapshot")
+
+// Snapshot 把 mainCache 中未过期的条目写到 w，供节点重启后用 Restore
+// 预热缓存。hotCache、缓存的否定结果以及键或值超过 64MB 的条目不写入；
+// 压缩的值解压后写入，恢复时可以使用不同的 CacheCodec。组的淘汰策略
+// 必须实现 RangePolicy。
+//
+// 快照的格式为：
+//
+//	snapshot := "GCSNAP" version entry* end
+//	version  := byte(1)
+//	entry    := uvarint(len(key)+1) key uvarint(flags) [varint(expire)] uvarint(len(value)) value
+//	end      := uvarint(0) uvarint(entries) crc
+//
+// flags 的最低位表示条目有过期时间，expire 是 Unix 纳秒；crc 是之前
+// 所有字节的 CRC-32C（Castagnoli），大端序。条目大致按淘汰的先后
+// 顺序排列，恢复后最近使用的条目仍然最后被淘汰。
+func (g *Group) Snapshot(w io.Writer) error {
+	entries, err := g.mainCache.entries()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	sw := &snapshotWriter{w: bw, crc: crc32.New(snapshotTable)}
+	io.WriteString(sw, snapshotMagic)
+	sw.Write([]byte{snapshotVersion})
+	n := 0
+	for _, e := range entries {
+		if e.value.notFound {
+			continue
+		}
+		value, err := e.value.decode()
+		if err != nil {
+			return err
+		}
+		if len(e.key) > maxSnapshotEntryBytes || value.Len() > maxSnapshotEntryBytes {
+			continue
+		}
+		sw.uvarint(uint64(len(e.key)) + 1)
+		io.WriteString(sw, e.key)
+		if exp := value.Expire(); !exp.IsZero() {
+			sw.uvarint(snapshotHasExpire)
+			sw.varint(exp.UnixNano())
+		} else {
+			sw.uvarint(0)
+		}
+		sw.uvarint(uint64(value.Len()))
+		value.WriteTo(sw)
+		n++
+	}
+	sw.uvarint(0)
+	sw.uvarint(uint64(n))
+	if sw.err != nil {
+		return sw.err
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], sw.crc.Sum32())
+	if _, err := bw.Write(sum[:]); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	g.logger().Info("写入快照", "group", g.name, "entries", n)
+	return nil
+}
+
+// Restore 把 Snapshot 写出的快照中的条目加入 mainCache。只恢复按当前的
+// PeerPicker 仍由本节点保存的键，即本节点是键的所有者，或者是
+// ReplicationFactor 个副本之一，因此应该在节点得知其他对等体之后调用。
+// 已过期的条目和已经在缓存中的键被跳过，超出 cacheBytes 时按淘汰策略
+// 淘汰。
+//
+// 条目在整个快照的校验和验证之后才加入缓存；快照损坏时返回包装了
+// ErrBadSnapshot 的错误，缓存保持不变。
+func (g *Group) Restore(r io.Reader) error {
+	g.peersOnce.Do(g.initPeers)
+	// 不大于零的 cacheBytes 不缓存任何条目；max 也不超过
+	// maxSnapshotEntryBytes，损坏的长度不会导致巨大的分配。
+	max := g.cacheBytes.Load()
+	if max < 0 {
+		max = 0
+	} else if max > maxSnapshotEntryBytes {
+		max = maxSnapshotEntryBytes
+	}
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.New(snapshotTable), max: max}
+	var header [len(snapshotMagic) + 1]byte
+	sr.read(header[:])
+	if sr.err == nil && (string(header[:len(snapshotMagic)]) != snapshotMagic || header[len(snapshotMagic)] != snapshotVersion) {
+		return fmt.Errorf("%w: unknown header %q", ErrBadSnapshot, header[:])
+	}
+
+	var entries []cacheEntry
+	n := 0
+	now := time.Now()
+	for sr.err == nil {
+		keyLen := sr.uvarint()
+		if keyLen == 0 {
+			break
+		}
+		key := sr.bytes(keyLen - 1)
+		var value ByteView
+		if sr.uvarint()&snapshotHasExpire != 0 {
+			value.e = time.Unix(0, sr.varint())
+		}
+		value.b = sr.bytes(sr.uvarint())
+		n++
+		if sr.err != nil || key == nil || value.b == nil || value.expired(now) {
+			// 大于 cacheBytes 的条目不可能被缓存，已被跳过。
+			continue
+		}
+		entries = append(entries, cacheEntry{string(key), value})
+	}
+	count := sr.uvarint()
+	sum := sr.crc.Sum32()
+	var tail [4]byte
+	if sr.err == nil {
+		_, sr.err = io.ReadFull(sr.r, tail[:])
+	}
+	if sr.err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSnapshot, sr.err)
+	}
+	if count != uint64(n) || binary.BigEndian.Uint32(tail[:]) != sum {
+		return fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+
+	restored := 0
+	for _, e := range entries {
+		if added, _ := g.addOwned(e.key, e.value, now); added {
+			restored++
+		}
+	}
+	g.logger().Info("恢复快照", "group", g.name, "entries", n, "restored", restored)
+	return nil
+}
+
+// snapshotWriter 写出快照并计算校验和，记住第一个错误。
+type snapshotWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (w *snapshotWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.crc.Write(p)
+	var n int
+	n, w.err = w.w.Write(p)
+	return n, w.err
+}
+
+func (w *snapshotWriter) uvarint(x uint64) {
+	w.Write(w.buf[:binary.PutUvarint(w.buf[:], x)])
+}
+
+func (w *snapshotWriter) varint(x int64) {
+	w.Write(w.buf[:binary.PutVarint(w.buf[:], x)])
+}
+
+// snapshotReader 读取快照并计算校验和，记住第一个错误。
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error
+	max int64 // 读入内存的键或值的最大字节数，在 0 和 maxSnapshotEntryBytes 之间
+}
+
+// ReadByte 实现 io.ByteReader，供 binary.ReadUvarint 使用。
+func (r *snapshotReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (r *snapshotReader) read(p []byte) {
+	if r.err != nil {
+		return
+	}
+	if _, r.err = io.ReadFull(r.r, p); r.err == nil {
+		r.crc.Write(p)
+	}
+}
+
+func (r *snapshotReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	var x uint64
+	x, r.err = binary.ReadUvarint(r)
+	return x
+}
+
+func (r *snapshotReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	var x int64
+	x, r.err = binary.ReadVarint(r)
+	return x
+}
+
+// bytes 读取 n 个字节。n 超过 maxSnapshotEntryBytes 时快照已损坏，
+// 不分配内存就返回错误；n 超过 max 时跳过这些字节并返回 nil。
+func (r *snapshotReader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > maxSnapshotEntryBytes {
+		r.err = fmt.Errorf("length %d exceeds %d bytes", n, maxSnapshotEntryBytes)
+		return nil
+	}
+	if n > uint64(r.max) {
+		_, r.err = io.CopyN(r.crc, r.r, int64(n))
+		if r.err == io.EOF {
+			r.err = io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	b := make([]byte, n)
+	r.read(b)
+	return b
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	expire := time.Now().Add(time.Hour).Round(0)
+	src := newGroup("TestSnapshot-src", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "missing" {
+			return ErrNotFound
+		}
+		if key == "expiring" {
+			return dest.SetStringWithExpiry("v-"+key, expire)
+		}
+		return dest.SetString("v-" + key)
+	}), nil)
+	src.opts.NotFoundTTL = time.Minute
+	keys := []string{"expiring", "missing"}
+	for i := 0; i < 20; i++ {
+		keys = append(keys, "key-"+strconv.Itoa(i))
+	}
+	for _, key := range keys {
+		var s string
+		src.Get(context.Background(), key, StringSink(&s))
+	}
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snap := buf.Bytes()
+
+	// The destination owns only the keys that fakePeers maps to its nil slot.
+	loads := 0
+	peers := fakePeers{nil, new(fakePeer)}
+	dst := newGroup("TestSnapshot-dst", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("loaded")
+	}), peers)
+	if err := dst.Restore(bytes.NewReader(snap)); err != nil {
+		t.Fatal(err)
+	}
+	owned := 0
+	for _, key := range keys {
+		if _, remote := peers.PickPeer(key); remote || key == "missing" {
+			continue
+		}
+		owned++
+		var v ByteView
+		if err := dst.Get(context.Background(), key, ByteViewSink(&v)); err != nil || v.String() != "v-"+key {
+			t.Errorf("Get(%q) = %q, %v; want restored value", key, v, err)
+		}
+		if key == "expiring" && !v.Expire().Equal(expire) {
+			t.Errorf("expiry = %v; want %v", v.Expire(), expire)
+		}
+	}
+	if loads != 0 {
+		t.Errorf("%d loads after restore; want 0", loads)
+	}
+	if got := dst.CacheStats(MainCache).Items; got != int64(owned) || owned == 0 {
+		t.Errorf("restored %d items; want %d", got, owned)
+	}
+
+	noLoad := GetterFunc(func(context.Context, string, Sink) error { return ErrNotFound })
+	for name, corrupt := range map[string]func([]byte){
+		"version":  func(b []byte) { b[len(snapshotMagic)]++ },
+		"checksum": func(b []byte) { b[len(b)-1]++ },
+		"value":    func(b []byte) { b[len(b)/2]++ },
+	} {
+		b := append([]byte(nil), snap...)
+		corrupt(b)
+		g := newGroup("TestSnapshot-"+name, 1<<20, noLoad, nil)
+		if err := g.Restore(bytes.NewReader(b)); !errors.Is(err, ErrBadSnapshot) {
+			t.Errorf("%s: Restore = %v; want ErrBadSnapshot", name, err)
+		}
+		if n := g.CacheStats(MainCache).Items; n != 0 {
+			t.Errorf("%s: %d items after failed restore", name, n)
+		}
+	}
+	g := newGroup("TestSnapshot-truncated", 1<<20, noLoad, nil)
+	if err := g.Restore(bytes.NewReader(snap[:len(snap)-10])); !errors.Is(err, ErrBadSnapshot) {
+		t.Errorf("truncated: Restore = %v; want ErrBadSnapshot", err)
+	}
+
+	// A corrupt length is rejected before anything is allocated for it,
+	// even when the group's cacheBytes does not bound it.
+	huge := []byte(snapshotMagic + string(rune(snapshotVersion)))
+	huge = binary.AppendUvarint(huge, 1<<40)
+	for _, cacheBytes := range []int64{-1, 0, 1 << 62} {
+		g := newGroup("TestSnapshot-huge-"+strconv.FormatInt(cacheBytes, 10), 1<<20, noLoad, nil)
+		g.SetCacheBytes(cacheBytes)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		err := g.Restore(bytes.NewReader(huge))
+		runtime.ReadMemStats(&after)
+		if !errors.Is(err, ErrBadSnapshot) {
+			t.Errorf("cacheBytes %d: Restore of a huge length = %v; want ErrBadSnapshot", cacheBytes, err)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+			t.Errorf("cacheBytes %d: Restore allocated %d bytes", cacheBytes, n)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+// ErrValueTooLarge 表示 Getter 设置的值超过了 GroupOptions.MaxValueBytes。
+var ErrValueTooLarge = errors.New("groupcache: value too large")
+
+// 流式的 Get 响应。请求在 Accept 头中列出 streamContentType 时，
+// 对等体把值本身作为响应体直接写出，而不是编码成 GetResponse，
+// 其余字段放在响应头中。不支持的对等体仍返回 GetResponse。
+const (
+	streamContentType = "application/x-groupcache-value"
+	protoContentType  = "application/x-protobuf"
+	minuteQPSHeader   = "Groupcache-Minute-Qps"
+	expireHeader      = "Groupcache-Expire"
+)
+
+// lener 由报告剩余字节数的 io.Reader 实现，例如 *bytes.Reader。
+type lener interface {
+	Len() int
+}
+
+// readValue 读取 r 到 EOF。r 实现了 lener 时按它的长度预先分配，长度
+// 准确时只分配一次；长度只是提示，多报或少报都按实际读到的内容返回。
+func readValue(r io.Reader) ([]byte, error) {
+	l, ok := r.(lener)
+	if !ok {
+		return io.ReadAll(r)
+	}
+	// 多留一个字节，读完 Len 个字节后不必扩容就能读到 EOF。
+	b := make([]byte, 0, max(l.Len(), 0)+1)
+	for {
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(b) == cap(b) {
+			b = append(b, 0)[:len(b)]
+		}
+	}
+}
+
+// sizedReader 把 n 作为 readValue 的大小提示，n 不必准确。
+type sizedReader struct {
+	io.Reader
+	n int
+}
+
+func (r sizedReader) Len() int {
+	return r.n
+}
+
+// limitSink 包装传给 Getter 的 Sink，拒绝超过 max 字节的值。
+// 通过 SetReader 设置的值在读到第 max+1 个字节时就停止读取。
+type limitSink struct {
+	Sink
+	max int64
+}
+
+func (s *limitSink) check(n int) error {
+	if int64(n) > s.max {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+func (s *limitSink) SetString(v string) error {
+	return s.SetStringWithExpiry(v, time.Time{})
+}
+
+func (s *limitSink) SetBytes(v []byte) error {
+	return s.SetBytesWithExpiry(v, time.Time{})
+}
+
+func (s *limitSink) SetProto(m proto.Message) error {
+	return s.SetProtoWithExpiry(m, time.Time{})
+}
+
+func (s *limitSink) SetReader(r io.Reader) error {
+	return s.SetReaderWithExpiry(r, time.Time{})
+}
+
+func (s *limitSink) SetStringWithExpiry(v string, e time.Time) error {
+	if err := s.check(len(v)); err != nil {
+		return err
+	}
+	return s.Sink.SetStringWithExpiry(v, e)
+}
+
+func (s *limitSink) SetBytesWithExpiry(v []byte, e time.Time) error {
+	if err := s.check(len(v)); err != nil {
+		return err
+	}
+	return s.Sink.SetBytesWithExpiry(v, e)
+}
+
+func (s *limitSink) SetProtoWithExpiry(m proto.Message, e time.Time) error {
+	if err := s.check(proto.Size(m)); err != nil {
+		return err
+	}
+	return s.Sink.SetProtoWithExpiry(m, e)
+}
+
+func (s *limitSink) SetReaderWithExpiry(r io.Reader, e time.Time) error {
+	mr := &maxReader{r: r, n: s.max, err: ErrValueTooLarge}
+	if l, ok := r.(lener); ok {
+		// Len 可能少报，只用来提前拒绝和预先分配，读取仍受 max 限制。
+		if err := s.check(l.Len()); err != nil {
+			return err
+		}
+		return s.Sink.SetReaderWithExpiry(sizedReader{mr, l.Len()}, e)
+	}
+	return s.Sink.SetReaderWithExpiry(mr, e)
+}
+
+// maxReader 从 r 读取至多 n 个字节，超过时返回 err。
+type maxReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (m *maxReader) Read(p []byte) (int, error) {
+	// 多读一个字节，以区分恰好 n 个字节和超过 n 个字节。
+	if int64(len(p)) > m.n+1 {
+		p = p[:m.n+1]
+	}
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	if m.n < 0 {
+		return n, m.err
+	}
+	return n, err
+}
+
+// acceptsStream 报告请求是否接受流式的 Get 响应。
+func acceptsStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), streamContentType)
+}
+
+// writeStream 把 value 作为流式的 Get 响应写出。值直接从缓存写到
+// 响应中，不复制，也不编码成 GetResponse。
+func writeStream(w http.ResponseWriter, value ByteView, qps float64, codec Codec) {
+	h := w.Header()
+	h.Set("Content-Type", streamContentType)
+	h.Set("Content-Length", strconv.Itoa(value.Len()))
+	h.Set(minuteQPSHeader, strconv.FormatFloat(qps, 'g', -1, 64))
+	if e := value.Expire(); !e.IsZero() {
+		h.Set(expireHeader, strconv.FormatInt(e.UnixNano(), 10))
+	}
+	if codec != nil {
+		h.Set(valueEncodingHeader, codec.Name())
+	}
+	value.WriteTo(w)
+}
+
+// isStream 报告响应是否是流式的 Get 响应。
+func isStream(res *http.Response) bool {
+	return res.Header.Get("Content-Type") == streamContentType
+}
+
+// readStream 把流式的 Get 响应直接从响应体读入 out.Value，不经过
+// readBody 的缓冲区：未编码的值按 Content-Length 一次分配，编码的值在
+// Codec 支持时边读边解压。max 大于零时，读到的字节一旦超过 max 就停止
+// 并返回 ErrResponseTooLarge。其余字段取自响应头。
+func readStream(res *http.Response, codecs []Codec, max int64, out *pb.GetResponse) error {
+	if err := decodeStreamHeader(res.Header, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	if max > 0 && res.ContentLength > max {
+		return ErrResponseTooLarge
+	}
+	var c Codec
+	if name := res.Header.Get(valueEncodingHeader); name != "" {
+		if c = findCodec(codecs, name); c == nil {
+			return fmt.Errorf("peer used unknown value encoding %q", name)
+		}
+	}
+	body := limitReader(res.Body, res.ContentLength, max)
+	rc, ok := c.(readerCodec)
+	if c != nil && !ok {
+		// 只能整块解压的 Codec 先读入压缩的值。
+		b, err := readValue(body)
+		if err != nil {
+			return readError(err)
+		}
+		out.Value, err = decodeValue(c, b, max)
+		return err
+	}
+	if ok {
+		zr, err := rc.decodeReader(body)
+		if err != nil {
+			return fmt.Errorf("decoding value: %v", err)
+		}
+		defer zr.Close()
+		body = limitReader(zr, -1, max)
+	}
+	v, err := readValue(body)
+	if err != nil {
+		return readError(err)
+	}
+	out.Value = v
+	return nil
+}
+
+// limitReader 把 r 限制为至多 max 个字节（max 大于零时），超过时返回
+// ErrResponseTooLarge。size 不小于零时作为 readValue 的大小提示。
+func limitReader(r io.Reader, size, max int64) io.Reader {
+	if max > 0 {
+		r = &maxReader{r: r, n: max, err: ErrResponseTooLarge}
+	}
+	if size >= 0 {
+		r = sizedReader{r, int(size)}
+	}
+	return r
+}
+
+// readError 为读取响应体的错误加上说明，ErrResponseTooLarge 原样返回。
+func readError(err error) error {
+	if err == ErrResponseTooLarge {
+		return err
+	}
+	return fmt.Errorf("reading response body: %v", err)
+}
+
+// decodeStreamHeader 把流式的 Get 响应头中的字段解码到 out。
+func decodeStreamHeader(h http.Header, out *pb.GetResponse) error {
+	out.Reset()
+	if v := h.Get(minuteQPSHeader); v != "" {
+		qps, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		out.MinuteQps = &qps
+	}
+	if v := h.Get(expireHeader); v != "" {
+		expire, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		out.Expire = &expire
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestSinkSetReader(t *testing.T) {
+	const want = "streamed value"
+	expire := time.Now().Add(time.Hour)
+	readers := map[string]func() io.Reader{
+		"sized":   func() io.Reader { return strings.NewReader(want) },
+		"unsized": func() io.Reader { return iotest.OneByteReader(strings.NewReader(want)) },
+	}
+	for name, newReader := range readers {
+		var (
+			s  string
+			v  ByteView
+			b  []byte
+			tb = make([]byte, 8)
+		)
+		sinks := map[string]Sink{
+			"string": StringSink(&s),
+			"view":   ByteViewSink(&v),
+			"alloc":  AllocatingByteSliceSink(&b),
+			"trunc":  TruncatingByteSliceSink(&tb),
+		}
+		for sinkName, sink := range sinks {
+			if err := sink.SetReaderWithExpiry(newReader(), expire); err != nil {
+				t.Fatalf("%s/%s: SetReaderWithExpiry: %v", name, sinkName, err)
+			}
+			view, _ := sink.view()
+			if view.String() != want || !view.Expire().Equal(expire) {
+				t.Errorf("%s/%s: view = %q expiring %v", name, sinkName, view.String(), view.Expire())
+			}
+		}
+		if s != want || v.String() != want || string(b) != want || string(tb) != want[:8] {
+			t.Errorf("%s: sinks got %q, %q, %q, %q", name, s, v.String(), b, tb)
+		}
+	}
+
+	m := &pb.GetResponse{Value: []byte(want)}
+	enc, _ := proto.Marshal(m)
+	got := new(pb.GetResponse)
+	if err := ProtoSink(got).SetReader(bytes.NewReader(enc)); err != nil || !proto.Equal(got, m) {
+		t.Errorf("ProtoSink.SetReader = %v, %v", got, err)
+	}
+}
+
+// shortLener reports fewer bytes than it holds.
+type shortLener struct{ *strings.Reader }
+
+func (r shortLener) Len() int { return r.Reader.Len() / 2 }
+
+func TestReadValue(t *testing.T) {
+	b, err := readValue(shortLener{strings.NewReader("0123456789")})
+	if err != nil || string(b) != "0123456789" {
+		t.Errorf("readValue with a short Len = %q, %v", b, err)
+	}
+	b, err = readValue(sizedReader{strings.NewReader("0123456789"), 100})
+	if err != nil || string(b) != "0123456789" {
+		t.Errorf("readValue with a long Len = %q, %v", b, err)
+	}
+}
+
+// countingReader is an endless reader that counts the bytes read from it.
+type countingReader struct{ n int }
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.n += len(p)
+	return len(p), nil
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	var endless countingReader
+	g := NewRegistry().NewGroupOpts("maxValue", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		switch key {
+		case "endless":
+			return dest.SetReader(&endless)
+		case "big":
+			return dest.SetString(strings.Repeat("x", 11))
+		case "sized":
+			return dest.SetReader(strings.NewReader(strings.Repeat("x", 11)))
+		case "short":
+			return dest.SetReader(shortLener{strings.NewReader(strings.Repeat("x", 20))})
+		}
+		return dest.SetReader(iotest.OneByteReader(strings.NewReader("0123456789")))
+	}), &GroupOptions{MaxValueBytes: 10})
+
+	for _, key := range []string{"endless", "big", "sized", "short"} {
+		var s string
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != ErrValueTooLarge {
+			t.Errorf("Get(%q) = %v; want ErrValueTooLarge", key, err)
+		}
+	}
+	if endless.n > 11 {
+		t.Errorf("read %d bytes of an endless value; want at most 11", endless.n)
+	}
+	var s string
+	if err := g.Get(dummyCtx, "exact", StringSink(&s)); err != nil || s != "0123456789" {
+		t.Errorf("Get of a value at the limit = %q, %v", s, err)
+	}
+}
+
+// TestHTTPPoolStream checks that a pool streams values to peers that accept
+// it and still answers other peers with a GetResponse.
+func TestHTTPPoolStream(t *testing.T) {
+	reg := NewRegistry()
+	expire := time.Now().Add(time.Hour).Round(0)
+	var server *HTTPPool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	server = NewHTTPPoolOpts(ts.URL, &HTTPPoolOptions{Registry: reg})
+	server.Set(ts.URL)
+	reg.NewGroup("stream", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetStringWithExpiry("value:"+key, expire)
+	}))
+
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry()})
+	p.Set(ts.URL)
+	peer, _ := p.PickPeer("key")
+	req := &pb.GetRequest{Group: proto.String("stream"), Key: proto.String("key")}
+	res := &pb.GetResponse{}
+	if err := peer.Get(dummyCtx, req, res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Value) != "value:key" || res.GetExpire() != expire.UnixNano() || res.MinuteQps == nil {
+		t.Errorf("streamed Get = %v", res)
+	}
+
+	hres, err := http.Get(ts.URL + defaultBasePath + "stream/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hres.Body.Close()
+	body, _ := io.ReadAll(hres.Body)
+	legacy := &pb.GetResponse{}
+	if ct := hres.Header.Get("Content-Type"); ct != protoContentType {
+		t.Errorf("Content-Type without Accept = %q; want %q", ct, protoContentType)
+	}
+	if err := proto.Unmarshal(body, legacy); err != nil || !bytes.Equal(legacy.Value, res.Value) || legacy.GetExpire() != res.GetExpire() {
+		t.Errorf("GetResponse = %v, %v; want %v", legacy, err, res)
+	}
+}
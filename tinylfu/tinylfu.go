@@ -0,0 +1,327 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tinylfu 实现了一个 W-TinyLFU 缓存。
+//
+// 新条目先进入一个很小的 LRU 窗口，窗口之外是分段 LRU
+// （probation 和 protected）。需要淘汰时，窗口中最旧的候选者
+// 与主缓存中的淘汰对象比较由 count-min sketch 估计的访问频率，
+// 频率较低的一方被淘汰，因此一次性扫描的键很难挤掉热点工作集。
+package tinylfu
+
+import (
+	"container/list"
+	"fmt"
+	"hash/maphash"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// Cache 是一个 W-TinyLFU 缓存。它不是并发安全的。
+type Cache struct {
+	// MaxEntries 是在项目被淘汰前的最大缓存条目数。
+	// 零表示没有限制，假定淘汰由调用者完成。
+	MaxEntries int
+
+	// OnEvicted 可选地指定一个回调函数，在条目
+	// 从缓存中清除时执行。
+	OnEvicted func(key Key, value interface{})
+
+	sketch    *sketch
+	window    *list.List // 新条目，元素为 *entry
+	probation *list.List // 主缓存中只被访问过一次的条目
+	protected *list.List // 主缓存中被再次访问过的条目
+	cache     map[interface{}]*list.Element
+}
+
+// Key 可以是任何可比较的值，与 lru.Key 相同。
+type Key = lru.Key
+
+const (
+	inWindow = iota
+	inProbation
+	inProtected
+)
+
+type entry struct {
+	key     Key
+	value   interface{}
+	segment int
+}
+
+// New 创建一个新的 Cache。
+func New(maxEntries int) *Cache {
+	c := &Cache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *Cache) init() {
+	c.sketch = newSketch(c.MaxEntries)
+	c.window = list.New()
+	c.probation = list.New()
+	c.protected = list.New()
+	c.cache = make(map[interface{}]*list.Element)
+}
+
+// Add 向缓存添加一个值。
+func (c *Cache) Add(key Key, value interface{}) {
+	if c.cache == nil {
+		c.init()
+	}
+	c.sketch.increment(key)
+	if ele, ok := c.cache[key]; ok {
+		ele.Value.(*entry).value = value
+		c.hit(ele)
+		return
+	}
+	c.cache[key] = c.window.PushFront(&entry{key: key, value: value})
+	c.sketch.grow(len(c.cache))
+	// 超出容量时，窗口中最旧的条目须经过准入比较才能进入主缓存。
+	if c.MaxEntries != 0 && len(c.cache) > c.MaxEntries {
+		c.RemoveOldest()
+	}
+	// 窗口占全部条目的约 1%，溢出的条目进入主缓存的 probation 段。
+	if c.window.Len() > max(1, len(c.cache)/100) {
+		c.move(c.window.Back(), c.probation, inProbation)
+	}
+}
+
+// Get 从缓存中查找键的值。未命中也会被计入访问频率。
+func (c *Cache) Get(key Key) (value interface{}, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	c.sketch.increment(key)
+	if ele, hit := c.cache[key]; hit {
+		c.hit(ele)
+		return c.cache[key].Value.(*entry).value, true
+	}
+	return
+}
+
+func (c *Cache) hit(ele *list.Element) {
+	switch ele.Value.(*entry).segment {
+	case inWindow:
+		c.window.MoveToFront(ele)
+	case inProtected:
+		c.protected.MoveToFront(ele)
+	case inProbation:
+		// 再次访问的条目晋升到 protected 段，protected 段最多占主缓存的 80%。
+		c.move(ele, c.protected, inProtected)
+		if limit := max(1, (c.probation.Len()+c.protected.Len())*8/10); c.protected.Len() > limit {
+			c.move(c.protected.Back(), c.probation, inProbation)
+		}
+	}
+}
+
+// move 将 ele 移到列表 to 的前端。
+func (c *Cache) move(ele *list.Element, to *list.List, segment int) {
+	e := ele.Value.(*entry)
+	c.segmentList(e.segment).Remove(ele)
+	e.segment = segment
+	c.cache[e.key] = to.PushFront(e)
+}
+
+func (c *Cache) segmentList(segment int) *list.List {
+	switch segment {
+	case inWindow:
+		return c.window
+	case inProbation:
+		return c.probation
+	default:
+		return c.protected
+	}
+}
+
+// Peek 查找键的值，但不改变条目的顺序或访问次数。
+func (c *Cache) Peek(key Key) (value interface{}, ok bool) {
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// Remove 从缓存中移除提供的键。
+func (c *Cache) Remove(key Key) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveOldest 淘汰一个条目。窗口中最旧的候选者与主缓存的淘汰对象
+// 比较访问频率，只有频率更高时候选者才被接纳，否则候选者被淘汰。
+func (c *Cache) RemoveOldest() {
+	if c.cache == nil {
+		return
+	}
+	candidate := c.window.Back()
+	victim := c.probation.Back()
+	if victim == nil {
+		victim = c.protected.Back()
+	}
+	switch {
+	case candidate != nil && victim != nil:
+		cf := c.sketch.estimate(candidate.Value.(*entry).key)
+		vf := c.sketch.estimate(victim.Value.(*entry).key)
+		if cf > vf {
+			c.removeElement(victim)
+			c.move(candidate, c.probation, inProbation)
+		} else {
+			c.removeElement(candidate)
+		}
+	case candidate != nil:
+		c.removeElement(candidate)
+	case victim != nil:
+		c.removeElement(victim)
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	e := ele.Value.(*entry)
+	c.segmentList(e.segment).Remove(ele)
+	delete(c.cache, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Range 对每个条目调用 f，直到 f 返回 false：依次是窗口、probation
+// 和 protected 段，各自从最久未使用的开始，大致是淘汰的先后顺序。
+// 它不改变条目的位置或访问频率，f 不能修改缓存。
+func (c *Cache) Range(f func(key Key, value interface{}) bool) {
+	if c.cache == nil {
+		return
+	}
+	for _, l := range []*list.List{c.window, c.probation, c.protected} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			e := ele.Value.(*entry)
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// Len 返回缓存中的项目数。
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Clear 清除缓存中所有存储的项目。
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, ele := range c.cache {
+			e := ele.Value.(*entry)
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+	c.cache = nil
+}
+
+// sketch 是一个 4 行的 count-min sketch，计数器上限为 15。
+// 每行的计数器数量是条目数的 16 倍，以降低哈希冲突带来的高估；
+// 每累计 10 倍条目数的访问，所有计数器减半，使频率随时间衰减。
+type sketch struct {
+	seed       maphash.Seed
+	rows       [4][]uint8
+	mask       uint64
+	entries    int // 当前宽度所能容纳的条目数
+	additions  int
+	sampleSize int
+}
+
+const minSketchEntries = 16
+
+func newSketch(entries int) *sketch {
+	s := &sketch{seed: maphash.MakeSeed()}
+	s.resize(entries)
+	return s
+}
+
+func (s *sketch) resize(entries int) {
+	n := minSketchEntries
+	for n < entries {
+		n *= 2
+	}
+	width := 16 * n
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	s.mask = uint64(width - 1)
+	s.entries = n
+	s.additions = 0
+	s.sampleSize = 10 * n
+}
+
+// grow 在条目数超过宽度时扩大 sketch。宽度是 2 的幂，键在新行中的
+// 下标的低位就是它在旧行中的下标，因此把旧的计数器平铺到新的各行中，
+// 已有的频率估计保持不变。
+func (s *sketch) grow(entries int) {
+	if entries <= s.entries {
+		return
+	}
+	old, additions := s.rows, s.additions
+	s.resize(entries)
+	for i := range s.rows {
+		for j := 0; j < len(s.rows[i]); j += len(old[i]) {
+			copy(s.rows[i][j:], old[i])
+		}
+	}
+	s.additions = additions
+}
+
+func (s *sketch) hash(key Key) uint64 {
+	if k, ok := key.(string); ok {
+		return maphash.String(s.seed, k)
+	}
+	return maphash.String(s.seed, fmt.Sprintf("%T:%v", key, key))
+}
+
+func (s *sketch) increment(key Key) {
+	h := s.hash(key)
+	h1, h2 := h, h>>32|1
+	for i := range s.rows {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *sketch) estimate(key Key) uint8 {
+	h := s.hash(key)
+	h1, h2 := h, h>>32|1
+	min := uint8(15)
+	for i := range s.rows {
+		if v := s.rows[i][(h1+uint64(i)*h2)&s.mask]; v < min {
+			min = v
+		}
+	}
+	return min
+}
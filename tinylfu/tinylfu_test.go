@@ -0,0 +1,211 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tinylfu
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type simpleStruct struct {
+	int
+	string
+}
+
+type complexStruct struct {
+	int
+	simpleStruct
+}
+
+var getTests = []struct {
+	name       string
+	keyToAdd   interface{}
+	keyToGet   interface{}
+	expectedOk bool
+}{
+	{"string_hit", "myKey", "myKey", true},
+	{"string_miss", "myKey", "nonsense", false},
+	{"simple_struct_hit", simpleStruct{1, "two"}, simpleStruct{1, "two"}, true},
+	{"simple_struct_miss", simpleStruct{1, "two"}, simpleStruct{0, "noway"}, false},
+	{"complex_struct_hit", complexStruct{1, simpleStruct{2, "three"}},
+		complexStruct{1, simpleStruct{2, "three"}}, true},
+}
+
+func TestGet(t *testing.T) {
+	for _, tt := range getTests {
+		c := New(0)
+		c.Add(tt.keyToAdd, 1234)
+		val, ok := c.Get(tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("%s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	c := New(0)
+	c.Add("myKey", 1234)
+	if val, ok := c.Get("myKey"); !ok {
+		t.Fatal("TestRemove returned no match")
+	} else if val != 1234 {
+		t.Fatalf("TestRemove failed.  Expected %d, got %v", 1234, val)
+	}
+
+	c.Remove("myKey")
+	if _, ok := c.Get("myKey"); ok {
+		t.Fatal("TestRemove returned a removed entry")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	evictedKeys := make([]Key, 0)
+	onEvictedFun := func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+
+	c := New(20)
+	c.OnEvicted = onEvictedFun
+	for i := 0; i < 22; i++ {
+		c.Add(fmt.Sprintf("myKey%d", i), 1234)
+	}
+
+	if len(evictedKeys) != 2 {
+		t.Fatalf("got %d evicted keys; want 2", len(evictedKeys))
+	}
+	if c.Len() != 20 {
+		t.Fatalf("Len = %d; want 20", c.Len())
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	c := New(10)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("hot%d", i)
+		c.Add(key, i)
+		for j := 0; j < 5; j++ {
+			c.Get(key)
+		}
+	}
+	// A scan of one-off keys must not displace the keys that keep being
+	// used, although an LRU cache of this size would lose all of them.
+	for i := 0; i < 1000; i++ {
+		c.Add(fmt.Sprintf("scan%d", i), i)
+		c.Get(fmt.Sprintf("hot%d", i%10))
+	}
+	hits := 0
+	for i := 0; i < 10; i++ {
+		if _, ok := c.Get(fmt.Sprintf("hot%d", i)); ok {
+			hits++
+		}
+	}
+	if hits < 8 {
+		t.Errorf("%d of 10 hot keys survived the scan; want at least 8", hits)
+	}
+	if c.Len() != 10 {
+		t.Errorf("Len = %d; want 10", c.Len())
+	}
+}
+
+// TestSketchGrow checks that growing the sketch of an unbounded cache keeps
+// the frequencies it has already counted.
+func TestSketchGrow(t *testing.T) {
+	s := newSketch(minSketchEntries)
+	for i := 0; i < 5; i++ {
+		s.increment("hot")
+	}
+	s.increment("cold")
+	s.grow(100 * minSketchEntries)
+	if s.entries < 100*minSketchEntries {
+		t.Fatalf("sketch holds %d entries after grow; want at least %d", s.entries, 100*minSketchEntries)
+	}
+	if got := s.estimate("hot"); got < 5 {
+		t.Errorf("estimate(hot) = %d after grow; want at least 5", got)
+	}
+	if got := s.estimate("cold"); got < 1 {
+		t.Errorf("estimate(cold) = %d after grow; want at least 1", got)
+	}
+}
+
+// TestPeek checks that Peek leaves the frequency sketch alone, so checking
+// for a key before adding it does not make a one-off key look popular.
+func TestPeek(t *testing.T) {
+	c := New(0)
+	c.Peek("a")
+	c.Add("a", 1)
+	before := c.sketch.estimate("a")
+	if v, ok := c.Peek("a"); !ok || v != 1 {
+		t.Fatalf("Peek(a) = %v, %v", v, ok)
+	}
+	if after := c.sketch.estimate("a"); after != before || before != 1 {
+		t.Errorf("estimate(a) = %d after Peek, %d before; want 1", after, before)
+	}
+}
+
+func TestRange(t *testing.T) {
+	c := New(0)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("c", 3)
+	c.Get("a")
+	var keys []string
+	c.Range(func(key Key, value interface{}) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	if got := strings.Join(keys, " "); got != "c b a" {
+		t.Errorf("Range visited %q; want %q", got, "c b a")
+	}
+	n := 0
+	c.Range(func(Key, interface{}) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("Range continued after f returned false: %d calls", n)
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	c := New(1000)
+	for i := 0; i < b.N; i++ {
+		c.Add(i, i)
+	}
+}
+
+func BenchmarkGetHit(b *testing.B) {
+	c := New(1000)
+	for i := 0; i < 1000; i++ {
+		c.Add(i, i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get(i % 1000)
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	c := New(1000)
+	for i := 0; i < b.N; i++ {
+		key := i % 4000
+		if _, ok := c.Get(key); !ok {
+			c.Add(key, i)
+		}
+	}
+}
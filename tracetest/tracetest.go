@@ -0,0 +1,133 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracetest 提供一个在内存中记录 span 的 groupcache.Tracer，
+// 用于在测试中检查 groupcache 产生的 span。
+package tracetest
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache"
+)
+
+// SpanStub 是一个已结束的 span 的记录。
+type SpanStub struct {
+	Name        string
+	SpanContext groupcache.SpanContext
+	Parent      groupcache.SpanContext // 没有父 span 时为零值
+	Attributes  map[string]interface{}
+	Errors      []error
+	StartTime   time.Time
+	EndTime     time.Time
+}
+
+// Recorder 是在内存中记录已结束的 span 的 groupcache.Tracer。
+// 它可以被并发使用，零值可以直接使用。
+type Recorder struct {
+	mu    sync.Mutex
+	ended []SpanStub
+}
+
+// NewRecorder 返回一个新的 Recorder。
+func NewRecorder() *Recorder {
+	return new(Recorder)
+}
+
+// Start 开始一个 span。ctx 中有有效的 SpanContext 时，新 span 是它的子 span，
+// 否则开始一个新的 trace。
+func (r *Recorder) Start(ctx context.Context, name string) (context.Context, groupcache.Span) {
+	parent := groupcache.SpanContextFromContext(ctx)
+	s := &span{
+		recorder: r,
+		stub: SpanStub{
+			Name:       name,
+			Parent:     parent,
+			Attributes: make(map[string]interface{}),
+			StartTime:  time.Now(),
+		},
+	}
+	sc := &s.stub.SpanContext
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	sc.Sampled = true
+	return groupcache.ContextWithSpanContext(ctx, *sc), s
+}
+
+// Ended 按结束的顺序返回已结束的 span。
+func (r *Recorder) Ended() []SpanStub {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SpanStub(nil), r.ended...)
+}
+
+// Reset 丢弃已记录的 span。
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ended = nil
+}
+
+// span 实现 groupcache.Span。
+type span struct {
+	recorder *Recorder
+	mu       sync.Mutex
+	stub     SpanStub
+	ended    bool
+}
+
+func (s *span) SpanContext() groupcache.SpanContext {
+	return s.stub.SpanContext
+}
+
+func (s *span) SetAttributes(kv ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		if k, ok := kv[i].(string); ok {
+			s.stub.Attributes[k] = kv[i+1]
+		}
+	}
+}
+
+func (s *span) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stub.Errors = append(s.stub.Errors, err)
+}
+
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.stub.EndTime = time.Now()
+	stub := s.stub
+	s.mu.Unlock()
+
+	s.recorder.mu.Lock()
+	s.recorder.ended = append(s.recorder.ended, stub)
+	s.recorder.mu.Unlock()
+}
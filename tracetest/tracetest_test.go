@@ -0,0 +1,157 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracetest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/golang/groupcache"
+)
+
+func findSpan(t *testing.T, spans []SpanStub, name string) SpanStub {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no %q span in %+v", name, spans)
+	return SpanStub{}
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder()
+	ctx, parent := r.Start(context.Background(), "parent")
+	_, child := r.Start(ctx, "child")
+	child.SetAttributes("key", "k", "odd")
+	child.End()
+	child.End()
+	parent.End()
+
+	spans := r.Ended()
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "parent" {
+		t.Fatalf("ended spans = %+v; want child then parent", spans)
+	}
+	if spans[0].Parent != spans[1].SpanContext || spans[0].SpanContext.TraceID != spans[1].SpanContext.TraceID {
+		t.Errorf("child is not in the parent's trace: %+v", spans)
+	}
+	if spans[1].Parent.IsValid() {
+		t.Errorf("root span has parent %+v", spans[1].Parent)
+	}
+	if len(spans[0].Attributes) != 1 || spans[0].Attributes["key"] != "k" {
+		t.Errorf("attributes = %v; want only key=k", spans[0].Attributes)
+	}
+	r.Reset()
+	if n := len(r.Ended()); n != 0 {
+		t.Errorf("%d spans after Reset", n)
+	}
+}
+
+// TestPeerSpans runs two HTTPPools in one process and checks that a Get
+// forwarded to the owner produces one trace across both nodes.
+func TestPeerSpans(t *testing.T) {
+	var (
+		pools   [2]*groupcache.HTTPPool
+		recs    [2]*Recorder
+		servers [2]*httptest.Server
+		groups  [2]*groupcache.Group
+		urls    []string
+	)
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pools[i].ServeHTTP(w, r)
+		}))
+		defer servers[i].Close()
+		urls = append(urls, servers[i].URL)
+	}
+	for i := range pools {
+		reg := groupcache.NewRegistry()
+		pools[i] = groupcache.NewHTTPPoolOpts(urls[i], &groupcache.HTTPPoolOptions{Registry: reg})
+		pools[i].Set(urls...)
+		recs[i] = NewRecorder()
+		groups[i] = reg.NewGroupOpts("traceTest", 1<<20, groupcache.GetterFunc(func(_ context.Context, key string, dest groupcache.Sink) error {
+			return dest.SetString(key)
+		}), &groupcache.GroupOptions{Tracer: recs[i]})
+	}
+
+	// Find a key that node 0 forwards to node 1.
+	var key string
+	for i := 0; ; i++ {
+		key = "key-" + strconv.Itoa(i)
+		if _, ok := pools[0].PickPeer(key); ok {
+			break
+		}
+	}
+	var value string
+	if err := groups[0].Get(context.Background(), key, groupcache.StringSink(&value)); err != nil || value != key {
+		t.Fatalf("Get = %q, %v; want %q", value, err, key)
+	}
+
+	local := recs[0].Ended()
+	get := findSpan(t, local, "groupcache.Get")
+	load := findSpan(t, local, "groupcache.load")
+	fetch := findSpan(t, local, "groupcache.getFromPeer")
+	if get.Parent.IsValid() || load.Parent != get.SpanContext || fetch.Parent != load.SpanContext {
+		t.Errorf("local spans are not nested Get > load > getFromPeer: %+v", local)
+	}
+	if get.Attributes["group"] != "traceTest" || get.Attributes["key"] != key || get.Attributes["cache_hit"] != false {
+		t.Errorf("Get attributes = %v", get.Attributes)
+	}
+	if fetch.Attributes["peer"] != urls[1]+"/_groupcache/" {
+		t.Errorf("getFromPeer peer = %v; want %v", fetch.Attributes["peer"], urls[1])
+	}
+
+	remote := recs[1].Ended()
+	rget := findSpan(t, remote, "groupcache.Get")
+	rload := findSpan(t, remote, "groupcache.load")
+	getter := findSpan(t, remote, "groupcache.getLocally")
+	if want := fetch.SpanContext; rget.Parent.TraceID != want.TraceID || rget.Parent.SpanID != want.SpanID || !rget.Parent.Remote {
+		t.Errorf("owner's Get parent = %+v; want remote %+v", rget.Parent, want)
+	}
+	if rload.Parent != rget.SpanContext || getter.Parent != rload.SpanContext {
+		t.Errorf("owner spans are not nested Get > load > getLocally: %+v", remote)
+	}
+	if rload.Attributes["deduplicated"] != false {
+		t.Errorf("owner load deduplicated = %v; want false", rload.Attributes["deduplicated"])
+	}
+}
+
+func TestNotFoundSpan(t *testing.T) {
+	rec := NewRecorder()
+	g := groupcache.NewRegistry().NewGroupOpts("notFoundTrace", 1<<20, groupcache.GetterFunc(func(context.Context, string, groupcache.Sink) error {
+		return groupcache.ErrNotFound
+	}), &groupcache.GroupOptions{Tracer: rec})
+
+	parent := groupcache.SpanContext{TraceID: [16]byte{1}, SpanID: [8]byte{2}, Sampled: true}
+	ctx := groupcache.ContextWithSpanContext(context.Background(), parent)
+	var s string
+	if err := g.Get(ctx, "missing", groupcache.StringSink(&s)); err != groupcache.ErrNotFound {
+		t.Fatalf("Get = %v; want ErrNotFound", err)
+	}
+	get := findSpan(t, rec.Ended(), "groupcache.Get")
+	if get.Parent != parent || get.SpanContext.TraceID != parent.TraceID {
+		t.Errorf("Get span parent = %+v; want %+v", get.Parent, parent)
+	}
+	if get.Attributes["not_found"] != true || len(get.Errors) != 0 {
+		t.Errorf("Get span attributes = %v, errors = %v; want not_found without errors", get.Attributes, get.Errors)
+	}
+}
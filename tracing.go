@@ -0,0 +1,225 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Tracer 创建跟踪 span。groupcache 为 Get、GetMulti、加载（包括
+// singleflight 等待）、从对等体获取和本地调用 Getter 各创建一个 span，
+// 名称分别为 "groupcache.Get"、"groupcache.GetMulti"、"groupcache.load"、
+// "groupcache.getFromPeer" 和 "groupcache.getLocally"。
+//
+// Start 应该以 SpanContextFromContext(ctx) 为父 span（如果有效）。
+// 返回的 span 的 SpanContext 会被放入 ctx，并通过 traceparent 请求头
+// （gRPC 中为同名的元数据）传播给对等体，因此对等体上的 span 与本地的属于同一个 trace。
+// 将 OpenTelemetry 等跟踪库适配为 Tracer 时，Start 也可以把
+// 自己的 span 放入返回的 context 中。
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span 是一个进行中的操作。除 SpanContext 外的方法只在 End 之前调用。
+type Span interface {
+	// SpanContext 返回 span 的标识。不传播的实现可以返回零值。
+	SpanContext() SpanContext
+
+	// SetAttributes 添加属性，kv 是交替的键和值，
+	// groupcache 使用的键有 "group"、"key"、"peer"、"keys"、
+	// "cache_hit"、"not_found" 和 "deduplicated"。
+	SetAttributes(kv ...interface{})
+
+	// RecordError 记录操作失败的原因。
+	RecordError(err error)
+
+	// End 结束 span。
+	End()
+}
+
+// SpanContext 是 W3C Trace Context 中标识一个 span 的部分。
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+	Remote  bool // 从对等体的请求中解析得到
+}
+
+// IsValid 报告 TraceID 和 SpanID 是否都不为零。
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParentHeader 是传播 SpanContext 的 HTTP 请求头。
+const TraceParentHeader = "traceparent"
+
+// TraceParent 返回 sc 的 traceparent 请求头的值，
+// 例如 "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"。
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+var errBadTraceParent = errors.New("groupcache: malformed traceparent")
+
+// ParseTraceParent 解析 traceparent 请求头的值。
+// 返回的 SpanContext 的 Remote 为 true。
+func ParseTraceParent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errBadTraceParent
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, errBadTraceParent
+	}
+	var version, flags [1]byte
+	if _, err := hex.Decode(version[:], []byte(parts[0])); err != nil {
+		return sc, errBadTraceParent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errBadTraceParent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errBadTraceParent
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, errBadTraceParent
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, errBadTraceParent
+	}
+	sc.Sampled = flags[0]&1 != 0
+	sc.Remote = true
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext 返回带有 sc 的 ctx 的副本。
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext 返回 ctx 中的 SpanContext，没有时返回零值。
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// InjectTraceContext 将 ctx 中有效的 SpanContext 写入 h 的 traceparent 请求头。
+// 对等体的传输层用它传播 trace，调用其他服务的 Getter 也可以使用。
+func InjectTraceContext(ctx context.Context, h http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		h.Set(TraceParentHeader, sc.TraceParent())
+	}
+}
+
+// ExtractTraceContext 返回带有 h 中 traceparent 请求头的 SpanContext
+// 的 ctx 的副本。请求头不存在或格式错误时返回 ctx。
+func ExtractTraceContext(ctx context.Context, h http.Header) context.Context {
+	v := h.Get(TraceParentHeader)
+	if v == "" {
+		return ctx
+	}
+	sc, err := ParseTraceParent(v)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// nopTracer 不创建任何 span，是默认的 Tracer。
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SpanContext() SpanContext        { return SpanContext{} }
+func (nopSpan) SetAttributes(kv ...interface{}) {}
+func (nopSpan) RecordError(err error)           {}
+func (nopSpan) End()                            {}
+
+// tracerBox 使不同动态类型的 Tracer 可以存入同一个 atomic.Value。
+type tracerBox struct{ Tracer }
+
+var pkgTracer atomic.Value // tracerBox
+
+// SetTracer 设置包级别的 Tracer，没有在 GroupOptions 中指定 Tracer
+// 的组使用它。t 为 nil 时恢复默认的不跟踪行为；此时对等体之间
+// 仍会传递收到的 traceparent。
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = nopTracer{}
+	}
+	pkgTracer.Store(tracerBox{t})
+}
+
+// tracer 返回组使用的 Tracer。
+func (g *Group) tracer() Tracer {
+	if g.opts.Tracer != nil {
+		return g.opts.Tracer
+	}
+	if b, ok := pkgTracer.Load().(tracerBox); ok {
+		return b.Tracer
+	}
+	return nopTracer{}
+}
+
+// startSpan 开始一个带有 group 属性和 kv 属性的 span，
+// 并把它的 SpanContext 放入返回的 ctx。
+func (g *Group) startSpan(ctx context.Context, name string, kv ...interface{}) (context.Context, Span) {
+	t := g.tracer()
+	if _, ok := t.(nopTracer); ok {
+		return ctx, nopSpan{}
+	}
+	ctx, span := t.Start(ctx, name)
+	if sc := span.SpanContext(); sc.IsValid() {
+		ctx = ContextWithSpanContext(ctx, sc)
+	}
+	span.SetAttributes(append([]interface{}{"group", g.name}, kv...)...)
+	return ctx, span
+}
+
+// spanRecording 报告 span 是否来自真正的 Tracer。热路径上的调用者
+// 用它避免在不跟踪时为属性分配内存。
+func spanRecording(span Span) bool {
+	_, nop := span.(nopSpan)
+	return !nop
+}
+
+// endSpan 按 err 记录结果并结束 span。键不存在不视为失败。
+func endSpan(span Span, err error) {
+	if errors.Is(err, ErrNotFound) {
+		span.SetAttributes("not_found", true)
+	} else if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+func TestTraceParent(t *testing.T) {
+	const s = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceParent(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.IsValid() || !sc.Sampled || !sc.Remote || sc.SpanID[7] != 0xb7 {
+		t.Errorf("ParseTraceParent(%q) = %+v", s, sc)
+	}
+	if got := sc.TraceParent(); got != s {
+		t.Errorf("TraceParent() = %q; want %q", got, s)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, err := ParseTraceParent(bad); err == nil {
+			t.Errorf("ParseTraceParent(%q) succeeded", bad)
+		}
+	}
+	// Later versions may append fields.
+	if _, err := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Errorf("future version: %v", err)
+	}
+}
+
+// TestTraceContextPassthrough checks that an untraced group still forwards
+// the caller's trace context to its peers.
+func TestTraceContextPassthrough(t *testing.T) {
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(TraceParentHeader)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	sc := SpanContext{TraceID: [16]byte{1}, SpanID: [8]byte{2}}
+	ctx := ContextWithSpanContext(context.Background(), sc)
+	h := &httpGetter{baseURL: ts.URL + defaultBasePath}
+	if err := h.Get(ctx, &pb.GetRequest{Group: new(string), Key: new(string)}, &pb.GetResponse{}); err == nil {
+		t.Fatal("Get succeeded against a failing peer")
+	}
+	if got != sc.TraceParent() {
+		t.Errorf("peer got traceparent %q; want %q", got, sc.TraceParent())
+	}
+	if sc2 := SpanContextFromContext(ExtractTraceContext(context.Background(), http.Header{"Traceparent": {got}})); sc2.SpanID != sc.SpanID {
+		t.Errorf("ExtractTraceContext = %+v; want span %x", sc2, sc.SpanID)
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2013 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package groupcache
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	defaultMaxIdleConnsPerPeer = 64
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultPingInterval        = 30 * time.Second
+	defaultMaxResponseBytes    = 64 << 20
+	defaultMaxRequestBytes     = 64 << 20
+)
+
+// ErrResponseTooLarge 表示对等体的响应体或其中解压后的值超过了
+// HTTPPoolOptions.MaxResponseBytes。
+// 它不计入对等体的熔断器，也不触发重试。
+var ErrResponseTooLarge = errors.New("groupcache: peer response too large")
+
+// H2CHandler 包装 h，使服务器接受不加密的 HTTP/2（h2c）连接。
+// 启用 HTTPPoolOptions.H2C 时，对等体的服务器必须用它包装根处理程序，
+// 例如 http.DefaultServeMux，而不是只包装池：h2c 的连接前言不带路径，
+// 不会被路由到池注册的路径上。
+func H2CHandler(h http.Handler) http.Handler {
+	return h2c.NewHandler(h, &http2.Server{})
+}
+
+// closeIdler 由能关闭空闲连接的 http.RoundTripper 实现。
+type closeIdler interface {
+	CloseIdleConnections()
+}
+
+// newTransport 返回池发往一个对等体的请求使用的 http.RoundTripper。
+// 每个对等体有自己的连接池，一个慢对等体不会占满其他对等体的空闲连接。
+func (p *HTTPPool) newTransport() http.RoundTripper {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if p.opts.H2C {
+		// 以先验知识直接使用 HTTP/2，所有请求复用同一个连接。
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			ReadIdleTimeout: p.opts.PingInterval,
+		}
+	}
+	t := &http.Transport{
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          p.opts.MaxIdleConnsPerPeer,
+		MaxIdleConnsPerHost:   p.opts.MaxIdleConnsPerPeer,
+		MaxConnsPerHost:       p.opts.MaxConnsPerPeer,
+		IdleConnTimeout:       p.opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	// https 的对等体协商 HTTP/2，空闲的连接定期用 PING 检查。
+	if h2, err := http2.ConfigureTransports(t); err == nil {
+		h2.ReadIdleTimeout = p.opts.PingInterval
+	}
+	return t
+}
+
+// transportFor 返回发往 peer 的请求使用的 Transport，Set 时保留。
+// 使用 HTTPPool.Transport 时返回 nil。
+func (p *HTTPPool) transportFor(peer string) http.RoundTripper {
+	if p.Transport != nil || peer == p.self {
+		return nil
+	}
+	t := p.transports[peer]
+	if t == nil {
+		t = p.newTransport()
+		p.transports[peer] = t
+	}
+	return t
+}
+
+// dropTransport 关闭已移除的对等体的空闲连接。
+func (p *HTTPPool) dropTransport(peer string) {
+	if t, ok := p.transports[peer].(closeIdler); ok {
+		t.CloseIdleConnections()
+	}
+	delete(p.transports, peer)
+}
+
+// readBody 读取至多 max 字节的响应体，max 不大于零时不限制。
+// 长度已知时一次分配恰好大小的缓冲区。返回的切片不会被复用，
+// 解码出的值可以直接引用它。
+func readBody(res *http.Response, max int64) ([]byte, error) {
+	if max > 0 && res.ContentLength > max {
+		return nil, ErrResponseTooLarge
+	}
+	if res.ContentLength >= 0 {
+		b := make([]byte, res.ContentLength)
+		if _, err := io.ReadFull(res.Body, b); err != nil {
+			return nil, fmt.Errorf("reading response body: %v", err)
+		}
+		return b, nil
+	}
+	r := io.Reader(res.Body)
+	if max > 0 {
+		r = io.LimitReader(r, max+1)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %v", err)
+	}
+	if max > 0 && int64(len(b)) > max {
+		return nil, ErrResponseTooLarge
+	}
+	return b, nil
+}
+
+// unmarshalGetResponse 把 b 解码到 out。与 proto.Unmarshal 不同，
+// out.Value 直接引用 b 而不复制，调用方之后不能修改 b。
+// 未知字段被忽略。
+func unmarshalGetResponse(b []byte, out *pb.GetResponse) error {
+	out.Reset()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			out.Value = v[:len(v):len(v)]
+			b = b[n:]
+		case num == 2 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			qps := math.Float64frombits(v)
+			out.MinuteQps = &qps
+			b = b[n:]
+		case (num == 3 || num == 4) && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if num == 3 {
+				expire := int64(v)
+				out.Expire = &expire
+			} else {
+				notFound := v != 0
+				out.NotFound = &notFound
+			}
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}